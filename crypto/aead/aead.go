@@ -0,0 +1,172 @@
+// Package aead encrypts data at rest with AES-GCM or ChaCha20-Poly1305:
+// messages and streams of authenticated chunks, under the keys of a KeyRing
+// for rotation, or of data keys wrapped by a KeyProvider, envelope
+// encryption.
+//
+// Ciphertexts start with a header of their format version, algorithm and
+// key ID, authenticated as associated data.
+package aead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"github.com/searKing/golib/crypto/rand_"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithm is an AEAD algorithm, as in ciphertext headers.
+type Algorithm uint8
+
+const (
+	AES256GCM        Algorithm = 1
+	ChaCha20Poly1305 Algorithm = 2
+)
+
+// formats of ciphertexts, their first byte
+const (
+	formatMessage        byte = 1
+	formatStream         byte = 2
+	formatEnvelope       byte = 3
+	formatEnvelopeStream byte = 4
+)
+
+const (
+	// nonceSize is the nonce size of both algorithms.
+	nonceSize = 12
+	// headerSize is the size of the header of messages and streams:
+	// format, algorithm and key ID.
+	headerSize = 1 + 1 + 4
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("aead: unsupported algorithm")
+	ErrUnsupportedFormat    = errors.New("aead: unsupported ciphertext format")
+	ErrMalformedCiphertext  = errors.New("aead: malformed ciphertext")
+	ErrDecryption           = errors.New("aead: message authentication failed")
+	ErrUnknownKey           = errors.New("aead: unknown key")
+	ErrNoPrimaryKey         = errors.New("aead: no primary key")
+)
+
+func (alg Algorithm) String() string {
+	switch alg {
+	case AES256GCM:
+		return "AES-256-GCM"
+	case ChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	}
+	return "unknown"
+}
+
+// KeySize returns the key size of alg, 0 if unsupported.
+func (alg Algorithm) KeySize() int {
+	switch alg {
+	case AES256GCM:
+		return 32
+	case ChaCha20Poly1305:
+		return chacha20poly1305.KeySize
+	}
+	return 0
+}
+
+// New returns the cipher.AEAD of alg and key.
+func (alg Algorithm) New(key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case AES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// Key is a symmetric key of an Algorithm, identified in the ciphertexts it
+// encrypts by its ID.
+type Key struct {
+	ID        uint32
+	Algorithm Algorithm
+	Material  []byte
+}
+
+// NewKey returns a random key of alg.
+func NewKey(id uint32, alg Algorithm) (*Key, error) {
+	if alg.KeySize() == 0 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return &Key{ID: id, Algorithm: alg, Material: rand_.Crypto.Bytes(alg.KeySize())}, nil
+}
+
+func (k *Key) aead() (cipher.AEAD, error) {
+	return k.Algorithm.New(k.Material)
+}
+
+// header returns the header of format of ciphertexts of k.
+func (k *Key) header(format byte) []byte {
+	h := make([]byte, headerSize)
+	h[0] = format
+	h[1] = byte(k.Algorithm)
+	binary.BigEndian.PutUint32(h[2:], k.ID)
+	return h
+}
+
+// parseHeader returns the format, algorithm and key ID of the header of
+// ciphertext.
+func parseHeader(ciphertext []byte) (format byte, alg Algorithm, id uint32, err error) {
+	if len(ciphertext) < headerSize {
+		return 0, 0, 0, ErrMalformedCiphertext
+	}
+	return ciphertext[0], Algorithm(ciphertext[1]), binary.BigEndian.Uint32(ciphertext[2:]), nil
+}
+
+// Encrypt encrypts and authenticates plaintext, and authenticates
+// additionalData, which Decrypt must be given too, with a random nonce.
+// The ciphertext is header || nonce || sealed plaintext.
+func (k *Key) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	a, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	out := k.header(formatMessage)
+	ad := append(append([]byte{}, out...), additionalData...)
+	nonce := rand_.Crypto.Bytes(nonceSize)
+	out = append(out, nonce...)
+	return a.Seal(out, nonce, plaintext, ad), nil
+}
+
+// Decrypt decrypts and authenticates the ciphertext of Encrypt.
+func (k *Key) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	format, alg, id, err := parseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if format != formatMessage {
+		return nil, ErrUnsupportedFormat
+	}
+	if alg != k.Algorithm || id != k.ID {
+		return nil, ErrUnknownKey
+	}
+	return k.open(ciphertext, additionalData)
+}
+
+func (k *Key) open(ciphertext, additionalData []byte) ([]byte, error) {
+	a, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < headerSize+nonceSize+a.Overhead() {
+		return nil, ErrMalformedCiphertext
+	}
+	ad := append(append([]byte{}, ciphertext[:headerSize]...), additionalData...)
+	nonce := ciphertext[headerSize : headerSize+nonceSize]
+	plaintext, err := a.Open(nil, nonce, ciphertext[headerSize+nonceSize:], ad)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
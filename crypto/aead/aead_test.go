@@ -0,0 +1,119 @@
+package aead
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestKeyRing(t *testing.T) {
+	ring := NewKeyRing()
+	if _, err := ring.Encrypt([]byte("x"), nil); err != ErrNoPrimaryKey {
+		t.Fatalf("Encrypt without a key: %v", err)
+	}
+	old, _ := ring.Rotate(AES256GCM)
+	ct, err := ring.Encrypt([]byte("secret"), []byte("row 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := ring.Rotate(ChaCha20Poly1305)
+	if current.ID != old.ID+1 || ring.Primary() != current {
+		t.Fatalf("Rotate: key %d, primary %v", current.ID, ring.Primary())
+	}
+	ct2, _ := ring.Encrypt([]byte("secret"), nil)
+
+	if pt, err := ring.Decrypt(ct, []byte("row 1")); err != nil || string(pt) != "secret" {
+		t.Errorf("Decrypt with the former key = %q, %v", pt, err)
+	}
+	if pt, err := ring.Decrypt(ct2, nil); err != nil || string(pt) != "secret" {
+		t.Errorf("Decrypt with the primary key = %q, %v", pt, err)
+	}
+	if _, err := ring.Decrypt(ct, []byte("row 2")); err != ErrDecryption {
+		t.Errorf("Decrypt with other associated data: %v", err)
+	}
+	tampered := append([]byte{}, ct...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := ring.Decrypt(tampered, []byte("row 1")); err != ErrDecryption {
+		t.Errorf("Decrypt of a tampered ciphertext: %v", err)
+	}
+	ring.Remove(old.ID)
+	if _, err := ring.Decrypt(ct, []byte("row 1")); err != ErrUnknownKey {
+		t.Errorf("Decrypt with a removed key: %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	ring := NewKeyRing()
+	ring.Rotate(ChaCha20Poly1305)
+	ad := []byte("file.bin")
+
+	for _, size := range []int{0, 1, DefaultChunkSize, DefaultChunkSize + 1, 3*DefaultChunkSize + 17} {
+		plaintext := bytes.Repeat([]byte{0xa5}, size)
+		var buf bytes.Buffer
+		w, err := NewEncryptingWriter(&buf, ring.Primary(), ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, bytes.NewReader(plaintext))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ct := buf.Bytes()
+
+		r, err := NewDecryptingReader(bytes.NewReader(ct), ring, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: ReadAll = %d bytes, %v", size, len(got), err)
+		}
+
+		// truncated at a chunk boundary, or at all
+		for _, cut := range []int{streamHeaderSize + DefaultChunkSize + 16, len(ct) - 1} {
+			if cut >= len(ct) || cut <= streamHeaderSize {
+				continue
+			}
+			r, _ := NewDecryptingReader(bytes.NewReader(ct[:cut]), ring, ad)
+			if _, err := ioutil.ReadAll(r); err != ErrDecryption && err != ErrMalformedCiphertext {
+				t.Errorf("size %d: ReadAll of a stream truncated at %d: %v", size, cut, err)
+			}
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	master := NewKeyRing()
+	master.Rotate(AES256GCM)
+	e := &Envelope{Provider: master}
+	ctx := context.Background()
+
+	ct, err := e.Encrypt(ctx, []byte("payload"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	master.Rotate(AES256GCM) // older data keys stay unwrappable
+	if pt, err := e.Decrypt(ctx, ct, []byte("ad")); err != nil || string(pt) != "payload" {
+		t.Errorf("Decrypt = %q, %v", pt, err)
+	}
+	if _, err := e.Decrypt(ctx, ct, nil); err != ErrDecryption {
+		t.Errorf("Decrypt without the associated data: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w, err := e.NewEncryptingWriter(ctx, &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := bytes.Repeat([]byte("0123456789"), DefaultChunkSize/4)
+	w.Write(plaintext)
+	w.Close()
+	r, err := e.NewDecryptingReader(ctx, &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("envelope stream: %d bytes, %v", len(got), err)
+	}
+}
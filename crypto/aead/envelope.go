@@ -0,0 +1,135 @@
+package aead
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+)
+
+// maxWrappedKeySize bounds the size of the wrapped data keys decrypted.
+const maxWrappedKeySize = 64 * 1024
+
+// KeyProvider wraps and unwraps data keys with master keys it holds, as a
+// KMS does. The wrapped key identifies its master key. A KeyRing is a
+// local KeyProvider.
+type KeyProvider interface {
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Envelope encrypts each message or stream with a new random data key,
+// stored wrapped by Provider along with the ciphertext: the master keys
+// never leave Provider, and encrypt little.
+type Envelope struct {
+	Provider KeyProvider
+	// Algorithm is the algorithm of the data keys, AES256GCM if zero.
+	Algorithm Algorithm
+}
+
+// dataKey returns a new data key and the prologue of format of its
+// ciphertexts: format, wrapped key size and wrapped key.
+func (e *Envelope) dataKey(ctx context.Context, format byte) (*Key, []byte, error) {
+	alg := e.Algorithm
+	if alg == 0 {
+		alg = AES256GCM
+	}
+	k, err := NewKey(0, alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := e.Provider.WrapKey(ctx, k.Material)
+	if err != nil {
+		return nil, nil, err
+	}
+	prologue := make([]byte, 1+4, 1+4+len(wrapped))
+	prologue[0] = format
+	binary.BigEndian.PutUint32(prologue[1:], uint32(len(wrapped)))
+	return k, append(prologue, wrapped...), nil
+}
+
+// unwrap returns the data key of alg wrapped in wrapped.
+func (e *Envelope) unwrap(ctx context.Context, wrapped []byte, alg Algorithm) (*Key, error) {
+	material, err := e.Provider.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(material) != alg.KeySize() {
+		return nil, ErrMalformedCiphertext
+	}
+	return &Key{Algorithm: alg, Material: material}, nil
+}
+
+// Encrypt encrypts plaintext with a new data key; the ciphertext is
+// format || wrapped key size || wrapped key || message.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext, additionalData []byte) ([]byte, error) {
+	k, prologue, err := e.dataKey(ctx, formatEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	// the wrapped key is authenticated too
+	msg, err := k.Encrypt(plaintext, append(append([]byte{}, prologue...), additionalData...))
+	if err != nil {
+		return nil, err
+	}
+	return append(prologue, msg...), nil
+}
+
+// Decrypt decrypts the ciphertext of Encrypt.
+func (e *Envelope) Decrypt(ctx context.Context, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < 1+4 {
+		return nil, ErrMalformedCiphertext
+	}
+	if ciphertext[0] != formatEnvelope {
+		return nil, ErrUnsupportedFormat
+	}
+	n := binary.BigEndian.Uint32(ciphertext[1:])
+	if n > maxWrappedKeySize || uint64(len(ciphertext)) < 1+4+uint64(n) {
+		return nil, ErrMalformedCiphertext
+	}
+	prologue, msg := ciphertext[:1+4+n], ciphertext[1+4+n:]
+	_, alg, _, err := parseHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	k, err := e.unwrap(ctx, prologue[1+4:], alg)
+	if err != nil {
+		return nil, err
+	}
+	return k.Decrypt(msg, append(append([]byte{}, prologue...), additionalData...))
+}
+
+// NewEncryptingWriter returns a writer encrypting what is written to it
+// with a new data key to w, see NewEncryptingWriter.
+func (e *Envelope) NewEncryptingWriter(ctx context.Context, w io.Writer, additionalData []byte) (io.WriteCloser, error) {
+	k, prologue, err := e.dataKey(ctx, formatEnvelopeStream)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptingWriter(w, k, formatEnvelopeStream, prologue, additionalData)
+}
+
+// NewDecryptingReader returns a reader decrypting the stream of
+// NewEncryptingWriter read from r, see NewDecryptingReader.
+func (e *Envelope) NewDecryptingReader(ctx context.Context, r io.Reader, additionalData []byte) (io.Reader, error) {
+	var head [1 + 4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	if head[0] != formatEnvelopeStream {
+		return nil, ErrUnsupportedFormat
+	}
+	n := binary.BigEndian.Uint32(head[1:])
+	if n > maxWrappedKeySize {
+		return nil, ErrMalformedCiphertext
+	}
+	prologue := make([]byte, 1+4+n)
+	copy(prologue, head[:])
+	if _, err := io.ReadFull(r, prologue[1+4:]); err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+
+	key := func(alg Algorithm, id uint32) (*Key, error) {
+		return e.unwrap(ctx, prologue[1+4:], alg)
+	}
+	return newDecryptingReader(r, formatEnvelopeStream, key, prologue, additionalData)
+}
@@ -0,0 +1,141 @@
+package aead
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// KeyRing is a set of keys indexed by ID: it encrypts with its primary key
+// and decrypts with the key of the ID of the ciphertext, so that keys can
+// be rotated while older ciphertexts are still readable.
+// A KeyRing is safe for concurrent use.
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[uint32]*Key
+	primary *Key
+}
+
+// NewKeyRing returns a KeyRing of keys, the last one primary.
+func NewKeyRing(keys ...*Key) *KeyRing {
+	r := &KeyRing{keys: make(map[uint32]*Key)}
+	for _, k := range keys {
+		r.keys[k.ID] = k
+		r.primary = k
+	}
+	return r
+}
+
+// Add adds k, replacing the key of the same ID.
+func (r *KeyRing) Add(k *Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[k.ID] = k
+	if r.primary != nil && r.primary.ID == k.ID {
+		r.primary = k
+	}
+}
+
+// Remove removes the key of ID id, once nothing is encrypted by it anymore.
+func (r *KeyRing) Remove(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, id)
+	if r.primary != nil && r.primary.ID == id {
+		r.primary = nil
+	}
+}
+
+// Get returns the key of ID id, or nil.
+func (r *KeyRing) Get(id uint32) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[id]
+}
+
+// KeyIDs returns the IDs of the keys, sorted.
+func (r *KeyRing) KeyIDs() []uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]uint32, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// SetPrimary makes the key of ID id the key to encrypt with.
+func (r *KeyRing) SetPrimary(id uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[id]
+	if !ok {
+		return ErrUnknownKey
+	}
+	r.primary = k
+	return nil
+}
+
+// Primary returns the key to encrypt with, or nil.
+func (r *KeyRing) Primary() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.primary
+}
+
+// Rotate adds a random key of alg, of the ID following the greatest one,
+// and makes it primary.
+func (r *KeyRing) Rotate(alg Algorithm) (*Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var id uint32
+	for kid := range r.keys {
+		if kid >= id {
+			id = kid + 1
+		}
+	}
+	k, err := NewKey(id, alg)
+	if err != nil {
+		return nil, err
+	}
+	r.keys[k.ID] = k
+	r.primary = k
+	return k, nil
+}
+
+// Encrypt encrypts plaintext with the primary key, see Key.Encrypt.
+func (r *KeyRing) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	k := r.Primary()
+	if k == nil {
+		return nil, ErrNoPrimaryKey
+	}
+	return k.Encrypt(plaintext, additionalData)
+}
+
+// Decrypt decrypts ciphertext with the key of its ID.
+func (r *KeyRing) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	_, _, id, err := parseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	k := r.Get(id)
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	return k.Decrypt(ciphertext, additionalData)
+}
+
+// keyWrapAD is the associated data of data keys wrapped by a KeyRing.
+var keyWrapAD = []byte("aead: data key")
+
+// WrapKey encrypts the data key dataKey with the primary key; a KeyRing is
+// a local KeyProvider.
+func (r *KeyRing) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return r.Encrypt(dataKey, keyWrapAD)
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+func (r *KeyRing) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return r.Decrypt(wrapped, keyWrapAD)
+}
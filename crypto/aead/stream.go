@@ -0,0 +1,242 @@
+package aead
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/searKing/golib/crypto/rand_"
+)
+
+const (
+	// DefaultChunkSize is the size of the plaintext of stream chunks.
+	DefaultChunkSize = 64 * 1024
+	// maxChunkSize bounds the chunk size of the streams decrypted.
+	maxChunkSize = 16 * 1024 * 1024
+
+	// noncePrefixSize is the size of the random nonce prefix of streams,
+	// followed in the nonce of each chunk by its 4 bytes counter and a
+	// last chunk flag.
+	noncePrefixSize = nonceSize - 4 - 1
+	// streamHeaderSize is the size of the header of streams: the header of
+	// messages, the chunk size and the nonce prefix.
+	streamHeaderSize = headerSize + 4 + noncePrefixSize
+)
+
+var errTooManyChunks = errors.New("aead: too many chunks")
+
+// chunkNonce returns the nonce of the chunk counter of a stream, of the
+// STREAM construction: the last chunk is authenticated as last, so that
+// truncations are detected.
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+type encryptingWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	prefix    []byte
+	ad        []byte
+	chunkSize int
+	buf       []byte
+	counter   uint32
+	err       error
+}
+
+// NewEncryptingWriter returns a writer encrypting what is written to it
+// with k, in authenticated chunks of DefaultChunkSize, to w. Close must be
+// called to write the last chunk; it does not close w.
+func NewEncryptingWriter(w io.Writer, k *Key, additionalData []byte) (io.WriteCloser, error) {
+	return newEncryptingWriter(w, k, formatStream, nil, additionalData)
+}
+
+// newEncryptingWriter writes a stream after prologue, authenticated too.
+func newEncryptingWriter(w io.Writer, k *Key, format byte, prologue, additionalData []byte) (io.WriteCloser, error) {
+	a, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := k.header(format)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[headerSize:], DefaultChunkSize)
+	prefix := rand_.Crypto.Bytes(noncePrefixSize)
+	header = append(header, prefix...)
+
+	out := append(append([]byte{}, prologue...), header...)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		w:         w,
+		aead:      a,
+		prefix:    prefix,
+		ad:        append(out, additionalData...),
+		chunkSize: DefaultChunkSize,
+	}, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	e.buf = append(e.buf, p...)
+	// a chunk is sealed once more follows, the last one on Close
+	for len(e.buf) > e.chunkSize {
+		if err := e.seal(e.buf[:e.chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = append(e.buf[:0], e.buf[e.chunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (e *encryptingWriter) seal(chunk []byte, last bool) error {
+	if e.counter == ^uint32(0) {
+		e.err = errTooManyChunks
+		return e.err
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), chunk, e.ad)
+	e.counter++
+	if _, err := e.w.Write(sealed); err != nil {
+		e.err = err
+		return err
+	}
+	return nil
+}
+
+func (e *encryptingWriter) Close() error {
+	if e.err != nil {
+		if e.err == io.ErrClosedPipe {
+			return nil
+		}
+		return e.err
+	}
+	if err := e.seal(e.buf, true); err != nil {
+		return err
+	}
+	e.buf = nil
+	e.err = io.ErrClosedPipe
+	return nil
+}
+
+type decryptingReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	ad      []byte
+	buf     []byte
+	pending bool // buf[0] is the first byte of the next chunk
+	counter uint32
+	plain   []byte
+	last    bool
+	err     error
+}
+
+// NewDecryptingReader returns a reader decrypting the stream of
+// NewEncryptingWriter read from r, with the key of its ID in ring.
+// Each chunk is authenticated before it is returned, but the stream is
+// complete only at io.EOF.
+func NewDecryptingReader(r io.Reader, ring *KeyRing, additionalData []byte) (io.Reader, error) {
+	key := func(alg Algorithm, id uint32) (*Key, error) {
+		k := ring.Get(id)
+		if k == nil || k.Algorithm != alg {
+			return nil, ErrUnknownKey
+		}
+		return k, nil
+	}
+	return newDecryptingReader(r, formatStream, key, nil, additionalData)
+}
+
+// newDecryptingReader reads a stream after prologue, authenticated too,
+// with the key returned by key for the algorithm and key ID of its header.
+func newDecryptingReader(r io.Reader, format byte, key func(alg Algorithm, id uint32) (*Key, error), prologue, additionalData []byte) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrMalformedCiphertext
+		}
+		return nil, err
+	}
+	f, alg, id, _ := parseHeader(header)
+	if f != format {
+		return nil, ErrUnsupportedFormat
+	}
+	k, err := key(alg, id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := binary.BigEndian.Uint32(header[headerSize:])
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return nil, ErrMalformedCiphertext
+	}
+	return &decryptingReader{
+		r:      r,
+		aead:   a,
+		prefix: header[headerSize+4:],
+		ad:     append(append(append([]byte{}, prologue...), header...), additionalData...),
+		buf:    make([]byte, int(chunkSize)+a.Overhead()+1),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.last {
+			return 0, io.EOF
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk; a chunk is the last one if no
+// byte follows it.
+func (d *decryptingReader) open() error {
+	start := 0
+	if d.pending {
+		start = 1
+	}
+	n, err := io.ReadFull(d.r, d.buf[start:])
+	n += start
+	full := len(d.buf) - 1
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		d.last = true
+	case err != nil:
+		return err
+	default:
+		n = full
+	}
+	if n < d.aead.Overhead() {
+		return ErrMalformedCiphertext
+	}
+	if d.counter == ^uint32(0) {
+		return errTooManyChunks
+	}
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter, d.last), d.buf[:n], d.ad)
+	if err != nil {
+		return ErrDecryption
+	}
+	d.counter++
+	if !d.last {
+		d.buf[0] = d.buf[full]
+		d.pending = true
+	}
+	d.plain = plain
+	return nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"strings"
+
+	"github.com/searKing/golib/crypto/rand_"
+)
+
+const (
+	DefaultSizeAPIKeyID     = 16
+	DefaultSizeAPIKeySecret = 32
+
+	// sizeAPIKeyChecksum is the size of the base62 CRC32 checksum of API keys.
+	sizeAPIKeyChecksum = 6
+)
+
+var (
+	ErrMalformedAPIKey = errors.New("auth: malformed api key")
+	ErrAPIKeyChecksum  = errors.New("auth: api key checksum mismatch")
+)
+
+// APIKey is an API key, "<prefix>_<id>_<secret><checksum>", as
+// "pk_live_3kTMd9fQq2LxW0bA_...": the prefix tells its kind and environment
+// apart, and lets secret scanners find it; the ID, not secret, identifies
+// it; the checksum, the CRC32 of the rest, rejects mistyped or truncated
+// keys without a lookup.
+type APIKey struct {
+	Prefix string
+	ID     string
+	Secret string
+}
+
+// NewAPIKey returns a random API key of prefix, as "pk_live", of an ID and
+// a secret of the default sizes, in base62 characters.
+func NewAPIKey(prefix string) *APIKey {
+	return NewAPIKeyWithSize(prefix, DefaultSizeAPIKeyID, DefaultSizeAPIKeySecret)
+}
+
+func NewAPIKeyWithSize(prefix string, idLen, secretLen int) *APIKey {
+	return &APIKey{
+		Prefix: prefix,
+		ID:     rand_.Crypto.StringWithCharset(idLen, rand_.CharsetAlphaNum),
+		Secret: rand_.Crypto.StringWithCharset(secretLen, rand_.CharsetAlphaNum),
+	}
+}
+
+// String returns the key to give to its owner, once.
+func (k *APIKey) String() string {
+	s := k.Prefix + "_" + k.ID + "_" + k.Secret
+	return s + apiKeyChecksum(s)
+}
+
+// ParseAPIKey parses the API key key and verifies its checksum.
+func ParseAPIKey(key string) (*APIKey, error) {
+	if len(key) <= sizeAPIKeyChecksum {
+		return nil, ErrMalformedAPIKey
+	}
+	s, sum := key[:len(key)-sizeAPIKeyChecksum], key[len(key)-sizeAPIKeyChecksum:]
+	i := strings.LastIndexByte(s, '_')
+	if i <= 0 {
+		return nil, ErrMalformedAPIKey
+	}
+	j := strings.LastIndexByte(s[:i], '_')
+	if j <= 0 || j+1 == i || i+1 == len(s) {
+		return nil, ErrMalformedAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKeyChecksum(s)), []byte(sum)) != 1 {
+		return nil, ErrAPIKeyChecksum
+	}
+	return &APIKey{Prefix: s[:j], ID: s[j+1 : i], Secret: s[i+1:]}, nil
+}
+
+// apiKeyChecksum returns the CRC32 of s in sizeAPIKeyChecksum base62 characters.
+func apiKeyChecksum(s string) string {
+	sum := crc32.ChecksumIEEE([]byte(s))
+	var b [sizeAPIKeyChecksum]byte
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = rand_.CharsetAlphaNum[sum%62]
+		sum /= 62
+	}
+	return string(b[:])
+}
+
+// LookupID returns the ID to store and look the key up by: the SHA-256 of
+// its prefix and ID, so that a leaked store does not list the IDs of keys.
+func (k *APIKey) LookupID() string {
+	sum := sha256.Sum256([]byte(k.Prefix + "_" + k.ID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash returns the hashed key to store in place of the key, which is never
+// stored. The secret has enough entropy for a fast hash.
+func (k *APIKey) Hash() *HashedAPIKey {
+	sum := sha256.Sum256([]byte(k.Secret))
+	return &HashedAPIKey{LookupID: k.LookupID(), SecretHash: sum[:]}
+}
+
+// HashedAPIKey is the stored form of an API key.
+type HashedAPIKey struct {
+	LookupID   string
+	SecretHash []byte
+}
+
+// Verify reports whether k is the key of h, in constant time.
+func (h *HashedAPIKey) Verify(k *APIKey) bool {
+	sum := sha256.Sum256([]byte(k.Secret))
+	return subtle.ConstantTimeCompare(sum[:], h.SecretHash) == 1 &&
+		subtle.ConstantTimeCompare([]byte(k.LookupID()), []byte(h.LookupID)) == 1
+}
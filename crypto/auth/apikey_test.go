@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	for _, prefix := range []string{"pk", "pk_live", "sk_test_eu"} {
+		key := NewAPIKey(prefix)
+		s := key.String()
+		if !strings.HasPrefix(s, prefix+"_"+key.ID+"_"+key.Secret) || len(s) != len(prefix)+2+DefaultSizeAPIKeyID+DefaultSizeAPIKeySecret+sizeAPIKeyChecksum {
+			t.Fatalf("key %q", s)
+		}
+		stored := key.Hash()
+
+		parsed, err := ParseAPIKey(s)
+		if err != nil || *parsed != *key {
+			t.Fatalf("ParseAPIKey(%q) = %+v, %v", s, parsed, err)
+		}
+		if parsed.LookupID() != stored.LookupID || !stored.Verify(parsed) {
+			t.Errorf("%s: parsed key does not verify", prefix)
+		}
+		if other := NewAPIKey(prefix); other.LookupID() == stored.LookupID || stored.Verify(other) {
+			t.Errorf("%s: another key verifies", prefix)
+		}
+		// the same ID under another secret
+		if stored.Verify(&APIKey{Prefix: key.Prefix, ID: key.ID, Secret: key.Secret + "x"}) {
+			t.Errorf("%s: another secret verifies", prefix)
+		}
+
+		typo := []byte(s)
+		typo[len(prefix)+2] ^= 1
+		if _, err := ParseAPIKey(string(typo)); err != ErrAPIKeyChecksum {
+			t.Errorf("ParseAPIKey of a mistyped key: %v", err)
+		}
+		if _, err := ParseAPIKey(s[:len(s)-1]); err != ErrAPIKeyChecksum {
+			t.Errorf("ParseAPIKey of a truncated key: %v", err)
+		}
+		if _, err := ParseAPIKey(s + "0"); err != ErrAPIKeyChecksum {
+			t.Errorf("ParseAPIKey of an extended key: %v", err)
+		}
+	}
+
+	for _, malformed := range []string{"", "abcdef", "pk_live_", "nounderscores0000000", "_id_secret000000", "pk__secret000000", "pk_id_000000"} {
+		if _, err := ParseAPIKey(malformed); err != ErrMalformedAPIKey {
+			t.Errorf("ParseAPIKey(%q): %v", malformed, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// https://tools.ietf.org/html/rfc6749#section-5.2
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorUnauthorizedClient      = "unauthorized_client"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorAccessDenied            = "access_denied"
+	ErrorServerError             = "server_error"
+)
+
+// Error is an OAuth 2.0 error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// Status is the HTTP status of the response; 400 if zero.
+	Status int `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "oauth2: " + e.Code
+	}
+	return "oauth2: " + e.Code + ": " + e.Description
+}
+
+func newError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// errInvalidClient is the error of failed client authentications.
+// https://tools.ietf.org/html/rfc6749#section-5.2
+var errInvalidClient = &Error{Code: ErrorInvalidClient, Description: "client authentication failed",
+	Status: http.StatusUnauthorized}
+
+// writeError writes err as an OAuth 2.0 error response; errors other than
+// *Error are server errors, not described.
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Code: ErrorServerError, Status: http.StatusInternalServerError}
+	}
+	status := e.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+	writeJSON(w, status, e)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is a Storage in memory, for tests and single instances.
+// Expired entries are dropped as they are met.
+type MemoryStorage struct {
+	mu            sync.Mutex
+	clients       map[string]*Client
+	codes         map[string]*AuthorizationCode
+	refreshTokens map[string]*RefreshToken
+	revokedAccess map[string]time.Time // expiry by jti
+}
+
+// NewMemoryStorage returns a MemoryStorage of clients.
+func NewMemoryStorage(clients ...*Client) *MemoryStorage {
+	s := &MemoryStorage{
+		clients:       make(map[string]*Client),
+		codes:         make(map[string]*AuthorizationCode),
+		refreshTokens: make(map[string]*RefreshToken),
+		revokedAccess: make(map[string]time.Time),
+	}
+	for _, c := range clients {
+		s.clients[c.ID] = c
+	}
+	return s
+}
+
+// AddClient registers c, replacing the client of the same ID.
+func (s *MemoryStorage) AddClient(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[c.ID] = c
+}
+
+func (s *MemoryStorage) GetClient(ctx context.Context, id string) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *MemoryStorage) SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *code
+	s.codes[code.Code] = &c
+	return nil
+}
+
+func (s *MemoryStorage) TakeAuthorizationCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.codes, code)
+	if time.Now().After(c.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *MemoryStorage) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := *token
+	s.refreshTokens[token.Token] = &t
+	return nil
+}
+
+// refreshToken returns the refresh token token, unless expired.
+// s.mu is held.
+func (s *MemoryStorage) refreshToken(token string) (*RefreshToken, error) {
+	t, ok := s.refreshTokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if time.Now().After(t.ExpiresAt) {
+		delete(s.refreshTokens, token)
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStorage) GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.refreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	c := *t
+	return &c, nil
+}
+
+func (s *MemoryStorage) UseRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.refreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	c := *t
+	t.Used = true
+	return &c, nil
+}
+
+func (s *MemoryStorage) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, t := range s.refreshTokens {
+		if t.Family == family {
+			delete(s.refreshTokens, token)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, exp := range s.revokedAccess {
+		if now.After(exp) {
+			delete(s.revokedAccess, id)
+		}
+	}
+	s.revokedAccess[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStorage) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revokedAccess[jti]
+	return ok, nil
+}
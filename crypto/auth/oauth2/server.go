@@ -0,0 +1,597 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/searKing/golib/crypto/auth"
+	"github.com/searKing/golib/crypto/jwt_"
+)
+
+const (
+	DefaultAccessTokenTTL       = time.Hour
+	DefaultRefreshTokenTTL      = 30 * 24 * time.Hour
+	DefaultAuthorizationCodeTTL = 10 * time.Minute
+
+	// sizeRefreshToken is the size in bytes of refresh tokens, before encoding.
+	sizeRefreshToken = 32
+
+	// ClaimClientID and ClaimScope are the claims of access tokens for
+	// their client and scope, RFC 8693, section 4.
+	ClaimClientID = "client_id"
+	ClaimScope    = "scope"
+)
+
+// https://tools.ietf.org/html/rfc7636#section-4.2
+const (
+	CodeChallengeMethodPlain = "plain"
+	CodeChallengeMethodS256  = "S256"
+)
+
+// Server implements the authorization code grant with PKCE, the client
+// credentials grant and the refresh token grant, with rotation, of OAuth
+// 2.0, and token introspection and revocation. Access tokens are JWTs
+// signed with AccessTokenKey; refresh tokens and codes are opaque.
+type Server struct {
+	// Storage stores the clients, codes and tokens. Required.
+	Storage Storage
+	// AccessTokenKey signs the access tokens. Required.
+	AccessTokenKey *jwt_.AuthKey
+	// Issuer is the "iss" of the access tokens, if not empty.
+	Issuer string
+
+	AccessTokenTTL       time.Duration
+	RefreshTokenTTL      time.Duration
+	AuthorizationCodeTTL time.Duration
+
+	// RequirePKCE requires PKCE of confidential clients too; public
+	// clients always must use it.
+	RequirePKCE bool
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// TokenResponse is a successful response of the token endpoint.
+// https://tools.ietf.org/html/rfc6749#section-5.1
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// AuthorizeRequest is an authorization request.
+// https://tools.ietf.org/html/rfc6749#section-4.1.1
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ParseAuthorizeRequest returns the authorization request of the query of r.
+func ParseAuthorizeRequest(r *http.Request) *AuthorizeRequest {
+	q := r.URL.Query()
+	return &AuthorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// Authorize grants req on behalf of subject, the resource owner the caller
+// authenticated and who consented, and returns the redirection URI to send
+// the user agent to, carrying the authorization code.
+// Errors about the client or its redirection URI are returned alone, the
+// user agent is not to be redirected; other errors are also returned in the
+// redirection URI.
+// https://tools.ietf.org/html/rfc6749#section-4.1.2
+func (s *Server) Authorize(ctx context.Context, req *AuthorizeRequest, subject string) (*url.URL, error) {
+	client, err := s.Storage.GetClient(ctx, req.ClientID)
+	if err == ErrNotFound {
+		return nil, newError(ErrorInvalidRequest, "unknown client_id")
+	}
+	if err != nil {
+		return nil, err
+	}
+	redirect, err := redirectURI(client, req.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(e *Error) (*url.URL, error) {
+		q := redirect.Query()
+		q.Set("error", e.Code)
+		if e.Description != "" {
+			q.Set("error_description", e.Description)
+		}
+		if req.State != "" {
+			q.Set("state", req.State)
+		}
+		redirect.RawQuery = q.Encode()
+		return redirect, e
+	}
+	if req.ResponseType != "code" {
+		return fail(newError(ErrorUnsupportedResponseType, ""))
+	}
+	if !client.allowsGrant(GrantTypeAuthorizationCode) {
+		return fail(newError(ErrorUnauthorizedClient, ""))
+	}
+	scopes, e := grantedScopes(client, req.Scope)
+	if e != nil {
+		return fail(e)
+	}
+	if req.CodeChallenge == "" {
+		if client.Public || s.RequirePKCE {
+			return fail(newError(ErrorInvalidRequest, "code_challenge required"))
+		}
+	} else {
+		if req.CodeChallengeMethod == "" {
+			req.CodeChallengeMethod = CodeChallengeMethodPlain
+		}
+		if req.CodeChallengeMethod != CodeChallengeMethodPlain && req.CodeChallengeMethod != CodeChallengeMethodS256 {
+			return fail(newError(ErrorInvalidRequest, "unsupported code_challenge_method"))
+		}
+	}
+
+	code := &AuthorizationCode{
+		Code:                auth.AuthorizeCode(),
+		ClientID:            client.ID,
+		RedirectURI:         req.RedirectURI,
+		Subject:             subject,
+		Scopes:              scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(durationOr(s.AuthorizationCodeTTL, DefaultAuthorizationCodeTTL)),
+	}
+	if err := s.Storage.SaveAuthorizationCode(ctx, code); err != nil {
+		return nil, err
+	}
+	q := redirect.Query()
+	q.Set("code", code.Code)
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	redirect.RawQuery = q.Encode()
+	return redirect, nil
+}
+
+// redirectURI returns the redirection endpoint of client for the
+// redirect_uri uri: uri if registered, or the only one registered if uri
+// is empty.
+// https://tools.ietf.org/html/rfc6749#section-3.1.2.3
+func redirectURI(client *Client, uri string) (*url.URL, error) {
+	if uri == "" {
+		if len(client.RedirectURIs) != 1 {
+			return nil, newError(ErrorInvalidRequest, "redirect_uri required")
+		}
+		uri = client.RedirectURIs[0]
+	} else if !contains(client.RedirectURIs, uri) {
+		return nil, newError(ErrorInvalidRequest, "unregistered redirect_uri")
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, newError(ErrorInvalidRequest, "invalid redirect_uri")
+	}
+	return u, nil
+}
+
+// grantedScopes returns the scopes of the scope parameter, all allowed to
+// client.
+func grantedScopes(client *Client, scope string) ([]string, *Error) {
+	scopes := strings.Fields(scope)
+	if len(client.Scopes) == 0 {
+		return scopes, nil
+	}
+	for _, s := range scopes {
+		if !contains(client.Scopes, s) {
+			return nil, newError(ErrorInvalidScope, "scope "+s+" not allowed")
+		}
+	}
+	return scopes, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCodeVerifier checks the PKCE verifier of the token request against
+// the challenge of code.
+// https://tools.ietf.org/html/rfc7636#section-4.6
+func verifyCodeVerifier(code *AuthorizationCode, verifier string) bool {
+	if code.CodeChallenge == "" {
+		return verifier == ""
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	challenge := verifier
+	if code.CodeChallengeMethod == CodeChallengeMethodS256 {
+		challenge = CodeChallengeS256(verifier)
+	}
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) == 1
+}
+
+// CodeChallengeS256 returns the S256 code challenge of verifier,
+// BASE64URL(SHA256(verifier)).
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authenticateClient authenticates the client of the token, introspection
+// or revocation request r, with HTTP Basic or the client_id and
+// client_secret parameters.
+// https://tools.ietf.org/html/rfc6749#section-2.3.1
+func (s *Server) authenticateClient(r *http.Request) (*Client, error) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// the credentials are form-urlencoded, RFC 6749, section 2.3.1
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return nil, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, errInvalidClient
+		}
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id == "" {
+		return nil, errInvalidClient
+	}
+	client, err := s.Storage.GetClient(r.Context(), id)
+	if err == ErrNotFound {
+		return nil, errInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.authenticate(secret) {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// HandleToken serves the token endpoint.
+// https://tools.ietf.org/html/rfc6749#section-3.2
+func (s *Server) HandleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, &Error{Code: ErrorInvalidRequest, Status: http.StatusMethodNotAllowed})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(ErrorInvalidRequest, "malformed body"))
+		return
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	grantType := r.PostFormValue("grant_type")
+	if !client.allowsGrant(grantType) {
+		switch grantType {
+		case GrantTypeAuthorizationCode, GrantTypeClientCredentials, GrantTypeRefreshToken:
+			writeError(w, newError(ErrorUnauthorizedClient, ""))
+		default:
+			writeError(w, newError(ErrorUnsupportedGrantType, ""))
+		}
+		return
+	}
+
+	var resp *TokenResponse
+	switch grantType {
+	case GrantTypeAuthorizationCode:
+		resp, err = s.exchangeCode(r, client)
+	case GrantTypeClientCredentials:
+		resp, err = s.clientCredentials(r, client)
+	case GrantTypeRefreshToken:
+		resp, err = s.refresh(r, client)
+	default:
+		err = newError(ErrorUnsupportedGrantType, "")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// https://tools.ietf.org/html/rfc6749#section-4.1.3
+func (s *Server) exchangeCode(r *http.Request, client *Client) (*TokenResponse, error) {
+	code, err := s.Storage.TakeAuthorizationCode(r.Context(), r.PostFormValue("code"))
+	if err == ErrNotFound {
+		return nil, newError(ErrorInvalidGrant, "invalid code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ID {
+		return nil, newError(ErrorInvalidGrant, "code issued to another client")
+	}
+	if code.RedirectURI != r.PostFormValue("redirect_uri") {
+		return nil, newError(ErrorInvalidGrant, "redirect_uri mismatch")
+	}
+	if !verifyCodeVerifier(code, r.PostFormValue("code_verifier")) {
+		return nil, newError(ErrorInvalidGrant, "invalid code_verifier")
+	}
+	return s.issue(r.Context(), client, code.Subject, code.Scopes, "")
+}
+
+// https://tools.ietf.org/html/rfc6749#section-4.4
+func (s *Server) clientCredentials(r *http.Request, client *Client) (*TokenResponse, error) {
+	if client.Public {
+		return nil, newError(ErrorUnauthorizedClient, "")
+	}
+	scopes, e := grantedScopes(client, r.PostFormValue("scope"))
+	if e != nil {
+		return nil, e
+	}
+	token, err := s.accessToken(client, client.ID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{AccessToken: token, TokenType: "Bearer",
+		ExpiresIn: int64(durationOr(s.AccessTokenTTL, DefaultAccessTokenTTL) / time.Second),
+		Scope:     strings.Join(scopes, " ")}, nil
+}
+
+// refresh exchanges a refresh token for a new access token and a new
+// refresh token; the reuse of a refresh token revokes its family, as it
+// may have been stolen.
+// https://tools.ietf.org/html/rfc6749#section-6
+func (s *Server) refresh(r *http.Request, client *Client) (*TokenResponse, error) {
+	ctx := r.Context()
+	old, err := s.Storage.UseRefreshToken(ctx, r.PostFormValue("refresh_token"))
+	if err == ErrNotFound {
+		return nil, newError(ErrorInvalidGrant, "invalid refresh_token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if old.ClientID != client.ID {
+		return nil, newError(ErrorInvalidGrant, "refresh_token issued to another client")
+	}
+	if old.Used {
+		if err := s.Storage.RevokeRefreshTokenFamily(ctx, old.Family); err != nil {
+			return nil, err
+		}
+		return nil, newError(ErrorInvalidGrant, "refresh_token reused")
+	}
+
+	scopes := old.Scopes
+	if scope := r.PostFormValue("scope"); scope != "" {
+		// the scope may only be narrowed
+		scopes = strings.Fields(scope)
+		for _, s := range scopes {
+			if !contains(old.Scopes, s) {
+				return nil, newError(ErrorInvalidScope, "scope "+s+" not granted")
+			}
+		}
+	}
+	return s.issue(ctx, client, old.Subject, scopes, old.Family)
+}
+
+// issue issues an access token and a refresh token of family, a new one
+// if empty, to client for subject.
+func (s *Server) issue(ctx context.Context, client *Client, subject string, scopes []string, family string) (*TokenResponse, error) {
+	accessToken, err := s.accessToken(client, subject, scopes)
+	if err != nil {
+		return nil, err
+	}
+	resp := &TokenResponse{AccessToken: accessToken, TokenType: "Bearer",
+		ExpiresIn: int64(durationOr(s.AccessTokenTTL, DefaultAccessTokenTTL) / time.Second),
+		Scope:     strings.Join(scopes, " ")}
+	if !client.allowsGrant(GrantTypeRefreshToken) {
+		return resp, nil
+	}
+
+	rt := &RefreshToken{
+		Token:     auth.AuthorizeCodeWithSize(sizeRefreshToken),
+		ClientID:  client.ID,
+		Subject:   subject,
+		Scopes:    scopes,
+		Family:    family,
+		ExpiresAt: time.Now().Add(durationOr(s.RefreshTokenTTL, DefaultRefreshTokenTTL)),
+	}
+	if rt.Family == "" {
+		rt.Family = rt.Token
+	}
+	if err := s.Storage.SaveRefreshToken(ctx, rt); err != nil {
+		return nil, err
+	}
+	resp.RefreshToken = rt.Token
+	return resp, nil
+}
+
+func (s *Server) issuer() *jwt_.Issuer {
+	return &jwt_.Issuer{
+		Signer: s.AccessTokenKey,
+		Issuer: s.Issuer,
+		TTL:    durationOr(s.AccessTokenTTL, DefaultAccessTokenTTL),
+	}
+}
+
+// accessToken returns a JWT access token for subject, of client and scopes.
+func (s *Server) accessToken(client *Client, subject string, scopes []string) (string, error) {
+	extra := map[string]interface{}{ClaimClientID: client.ID}
+	if len(scopes) > 0 {
+		extra[ClaimScope] = strings.Join(scopes, " ")
+	}
+	return s.issuer().Issue(subject, extra)
+}
+
+// Validator returns a validator of the access tokens of s, for resource
+// servers; it does not know of revocations, see HandleIntrospect.
+func (s *Server) Validator() *jwt_.Validator {
+	return &jwt_.Validator{
+		Keyfunc:        s.AccessTokenKey.GetVerifiedKey,
+		Methods:        []string{s.AccessTokenKey.GetSignedMethod().Alg()},
+		Issuer:         s.Issuer,
+		RequiredClaims: []string{jwt_.ClaimsExpirationTime, jwt_.ClaimsJWTID, ClaimClientID},
+	}
+}
+
+// introspectAccessToken returns the claims of the access token token,
+// valid and not revoked, or nil.
+func (s *Server) introspectAccessToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims, err := s.Validator().Validate(token)
+	if err != nil {
+		return nil, nil
+	}
+	jti, _ := claims[jwt_.ClaimsJWTID].(string)
+	revoked, err := s.Storage.IsAccessTokenRevoked(ctx, jti)
+	if err != nil || revoked {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IntrospectionResponse is the response of the introspection endpoint.
+// https://tools.ietf.org/html/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	ExpiresAt interface{} `json:"exp,omitempty"`
+	IssuedAt  interface{} `json:"iat,omitempty"`
+	Issuer    string      `json:"iss,omitempty"`
+	JWTID     string      `json:"jti,omitempty"`
+}
+
+// HandleIntrospect serves the token introspection endpoint, to
+// authenticated confidential clients: the client_id of a public client is
+// no secret, so public clients are rejected as unauthenticated.
+// https://tools.ietf.org/html/rfc7662#section-2.1
+func (s *Server) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, &Error{Code: ErrorInvalidRequest, Status: http.StatusMethodNotAllowed})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(ErrorInvalidRequest, "malformed body"))
+		return
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if client.Public {
+		writeError(w, errInvalidClient)
+		return
+	}
+	ctx := r.Context()
+	token := r.PostFormValue("token")
+
+	if r.PostFormValue("token_type_hint") != GrantTypeRefreshToken {
+		claims, err := s.introspectAccessToken(ctx, token)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if claims != nil {
+			resp := &IntrospectionResponse{Active: true, TokenType: "Bearer",
+				ExpiresAt: claims[jwt_.ClaimsExpirationTime], IssuedAt: claims[jwt_.ClaimsIssuedAt]}
+			resp.Scope, _ = claims[ClaimScope].(string)
+			resp.ClientID, _ = claims[ClaimClientID].(string)
+			resp.Subject, _ = claims[jwt_.ClaimsSubject].(string)
+			resp.Issuer, _ = claims[jwt_.ClaimsIssuer].(string)
+			resp.JWTID, _ = claims[jwt_.ClaimsJWTID].(string)
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+
+	rt, err := s.Storage.GetRefreshToken(ctx, token)
+	if err != nil && err != ErrNotFound {
+		writeError(w, err)
+		return
+	}
+	if err == ErrNotFound || rt.Used {
+		writeJSON(w, http.StatusOK, &IntrospectionResponse{})
+		return
+	}
+	writeJSON(w, http.StatusOK, &IntrospectionResponse{Active: true, TokenType: GrantTypeRefreshToken,
+		Scope: strings.Join(rt.Scopes, " "), ClientID: rt.ClientID, Subject: rt.Subject,
+		ExpiresAt: rt.ExpiresAt.Unix()})
+}
+
+// HandleRevoke serves the token revocation endpoint: the revocation of a
+// refresh token revokes its family, the one of an access token is recorded
+// until it expires. Clients may only revoke their tokens.
+// https://tools.ietf.org/html/rfc7009
+func (s *Server) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, &Error{Code: ErrorInvalidRequest, Status: http.StatusMethodNotAllowed})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(ErrorInvalidRequest, "malformed body"))
+		return
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ctx := r.Context()
+	token := r.PostFormValue("token")
+
+	if rt, err := s.Storage.GetRefreshToken(ctx, token); err == nil {
+		if rt.ClientID == client.ID {
+			err = s.Storage.RevokeRefreshTokenFamily(ctx, rt.Family)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	} else if err != ErrNotFound {
+		writeError(w, err)
+		return
+	} else if claims, err := s.introspectAccessToken(ctx, token); err != nil {
+		writeError(w, err)
+		return
+	} else if claims != nil && claims[ClaimClientID] == client.ID {
+		jti, _ := claims[jwt_.ClaimsJWTID].(string)
+		exp := time.Now().Add(durationOr(s.AccessTokenTTL, DefaultAccessTokenTTL))
+		if err := s.Storage.RevokeAccessToken(ctx, jti, exp); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	// invalid tokens are not errors, RFC 7009, section 2.2
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,161 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/searKing/golib/crypto/jwt_"
+)
+
+func newTestServer(t *testing.T) *Server {
+	key, err := jwt_.NewAuthKeyFromRandom(jwt_.SigningMethodEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		Storage: NewMemoryStorage(
+			&Client{ID: "app", Public: true, RedirectURIs: []string{"https://app.example/cb"}, Scopes: []string{"read", "write"}},
+			&Client{ID: "svc", Secret: "s3cret", Scopes: []string{"read"}},
+		),
+		AccessTokenKey: key,
+		Issuer:         "https://auth.example",
+	}
+}
+
+func post(t *testing.T, h http.HandlerFunc, form url.Values, id, secret string) (int, map[string]interface{}) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		r.SetBasicAuth(id, secret)
+	} else if id != "" {
+		form.Set("client_id", id)
+		r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	s := newTestServer(t)
+	verifier := strings.Repeat("v", 43)
+
+	// public clients must use PKCE
+	u, err := s.Authorize(context.Background(), &AuthorizeRequest{ResponseType: "code", ClientID: "app", State: "xyz"}, "alice")
+	if err == nil || u == nil || u.Query().Get("error") != ErrorInvalidRequest || u.Query().Get("state") != "xyz" {
+		t.Fatalf("Authorize without PKCE = %v, %v", u, err)
+	}
+	if u, err := s.Authorize(context.Background(), &AuthorizeRequest{ResponseType: "code", ClientID: "app",
+		RedirectURI: "https://evil.example/cb"}, "alice"); err == nil || u != nil {
+		t.Fatalf("Authorize to an unregistered redirect_uri = %v, %v", u, err)
+	}
+
+	u, err = s.Authorize(context.Background(), &AuthorizeRequest{ResponseType: "code", ClientID: "app", Scope: "read",
+		State: "xyz", CodeChallenge: CodeChallengeS256(verifier), CodeChallengeMethod: CodeChallengeMethodS256}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := u.Query().Get("code")
+	if code == "" || u.Query().Get("state") != "xyz" || u.Host != "app.example" {
+		t.Fatalf("redirect %v", u)
+	}
+
+	if status, body := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code},
+		"code_verifier": {strings.Repeat("w", 43)}}, "app", ""); status != http.StatusBadRequest || body["error"] != ErrorInvalidGrant {
+		t.Fatalf("exchange with a wrong verifier = %d %v", status, body)
+	}
+	// the code was consumed by the failed attempt
+	u, _ = s.Authorize(context.Background(), &AuthorizeRequest{ResponseType: "code", ClientID: "app", Scope: "read",
+		CodeChallenge: CodeChallengeS256(verifier), CodeChallengeMethod: CodeChallengeMethodS256}, "alice")
+	code = u.Query().Get("code")
+
+	status, tok := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code},
+		"code_verifier": {verifier}}, "app", "")
+	if status != http.StatusOK || tok["access_token"] == nil || tok["refresh_token"] == nil || tok["scope"] != "read" {
+		t.Fatalf("exchange = %d %v", status, tok)
+	}
+	if status, _ := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code},
+		"code_verifier": {verifier}}, "app", ""); status != http.StatusBadRequest {
+		t.Errorf("second exchange of a code = %d", status)
+	}
+
+	claims, err := s.Validator().Validate(tok["access_token"].(string))
+	if err != nil || claims["sub"] != "alice" || claims[ClaimClientID] != "app" {
+		t.Fatalf("access token claims %v, %v", claims, err)
+	}
+	// public clients can't introspect, even their own tokens
+	if status, _ := post(t, s.HandleIntrospect, url.Values{"token": {tok["access_token"].(string)}}, "app", ""); status != http.StatusUnauthorized {
+		t.Errorf("introspection by a public client of its token = %d", status)
+	}
+	if _, body := post(t, s.HandleIntrospect, url.Values{"token": {tok["access_token"].(string)}}, "svc", "s3cret"); body["active"] != true || body["sub"] != "alice" {
+		t.Errorf("introspection of a token of a public client = %v", body)
+	}
+
+	// rotation
+	rt1 := tok["refresh_token"].(string)
+	status, tok2 := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {rt1}}, "app", "")
+	if status != http.StatusOK || tok2["refresh_token"] == rt1 {
+		t.Fatalf("refresh = %d %v", status, tok2)
+	}
+	rt2 := tok2["refresh_token"].(string)
+	if status, body := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {rt2},
+		"scope": {"write"}}, "app", ""); status != http.StatusBadRequest || body["error"] != ErrorInvalidScope {
+		t.Errorf("refresh widening the scope = %d %v", status, body)
+	}
+	// reuse of rt1 revokes the family, rt2 included
+	if status, _ := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {rt1}}, "app", ""); status != http.StatusBadRequest {
+		t.Errorf("reuse of a refresh token = %d", status)
+	}
+	if status, _ := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {rt2}}, "app", ""); status != http.StatusBadRequest {
+		t.Errorf("refresh of a revoked family = %d", status)
+	}
+}
+
+func TestClientCredentialsIntrospectRevoke(t *testing.T) {
+	s := newTestServer(t)
+
+	if status, body := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeClientCredentials}}, "svc", "wrong"); status != http.StatusUnauthorized || body["error"] != ErrorInvalidClient {
+		t.Fatalf("wrong secret = %d %v", status, body)
+	}
+	if status, body := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeClientCredentials}}, "app", ""); status != http.StatusBadRequest || body["error"] != ErrorUnauthorizedClient {
+		t.Fatalf("client credentials of a public client = %d %v", status, body)
+	}
+	if status, body := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeClientCredentials}, "scope": {"write"}}, "svc", "s3cret"); status != http.StatusBadRequest || body["error"] != ErrorInvalidScope {
+		t.Fatalf("disallowed scope = %d %v", status, body)
+	}
+	status, tok := post(t, s.HandleToken, url.Values{"grant_type": {GrantTypeClientCredentials}, "scope": {"read"}}, "svc", "s3cret")
+	if status != http.StatusOK || tok["refresh_token"] != nil || tok["token_type"] != "Bearer" {
+		t.Fatalf("client credentials = %d %v", status, tok)
+	}
+	at := tok["access_token"].(string)
+
+	if status, _ := post(t, s.HandleIntrospect, url.Values{"token": {at}}, "", ""); status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated introspection = %d", status)
+	}
+	// the client_id of a public client authenticates nothing
+	if status, body := post(t, s.HandleIntrospect, url.Values{"token": {at}}, "app", ""); status != http.StatusUnauthorized || body["active"] != nil {
+		t.Errorf("introspection by a public client = %d %v", status, body)
+	}
+	_, body := post(t, s.HandleIntrospect, url.Values{"token": {at}}, "svc", "s3cret")
+	if body["active"] != true || body["client_id"] != "svc" || body["scope"] != "read" || body["iss"] != "https://auth.example" {
+		t.Errorf("introspection = %v", body)
+	}
+	if _, body := post(t, s.HandleIntrospect, url.Values{"token": {"garbage"}}, "svc", "s3cret"); body["active"] != false {
+		t.Errorf("introspection of garbage = %v", body)
+	}
+
+	if status, _ := post(t, s.HandleRevoke, url.Values{"token": {at}}, "svc", "s3cret"); status != http.StatusOK {
+		t.Errorf("revoke = %d", status)
+	}
+	if _, body := post(t, s.HandleIntrospect, url.Values{"token": {at}}, "svc", "s3cret"); body["active"] != false {
+		t.Errorf("introspection of a revoked token = %v", body)
+	}
+}
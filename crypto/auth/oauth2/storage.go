@@ -0,0 +1,118 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Storage for unknown clients, codes and tokens.
+var ErrNotFound = errors.New("oauth2: not found")
+
+// https://tools.ietf.org/html/rfc6749#section-4
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// Client is a registered client.
+type Client struct {
+	ID string
+	// Secret is the secret of confidential clients, see auth.ClientSecret.
+	Secret string
+	// Public clients, such as native and browser apps, have no secret and
+	// must use PKCE.
+	Public bool
+	// RedirectURIs are the registered redirection endpoints.
+	RedirectURIs []string
+	// GrantTypes are the grants the client may use. If empty, public
+	// clients may use authorization_code and refresh_token, confidential
+	// clients client_credentials too.
+	GrantTypes []string
+	// Scopes are the scopes the client may request. If empty, any.
+	Scopes []string
+}
+
+// authenticate reports whether secret is the secret of c.
+func (c *Client) authenticate(secret string) bool {
+	if c.Public {
+		return secret == ""
+	}
+	return c.Secret != "" && subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) == 1
+}
+
+// allowsGrant reports whether c may use grantType.
+func (c *Client) allowsGrant(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType != GrantTypeClientCredentials || !c.Public
+	}
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationCode is an authorization code issued to a client.
+type AuthorizationCode struct {
+	Code     string
+	ClientID string
+	// RedirectURI is the redirect_uri of the authorization request, if
+	// any; the token request must repeat it.
+	RedirectURI string
+	Subject     string
+	Scopes      []string
+	// CodeChallenge and CodeChallengeMethod are the PKCE challenge, RFC 7636.
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+}
+
+// RefreshToken is a refresh token issued to a client. Refresh tokens are
+// rotated: each is used once and replaced by a new one of the same Family;
+// the reuse of a used one revokes the family.
+type RefreshToken struct {
+	Token    string
+	ClientID string
+	Subject  string
+	Scopes   []string
+	// Family is the ID of the chain of rotated refresh tokens, the token
+	// of the first one.
+	Family    string
+	ExpiresAt time.Time
+	// Used reports whether the token was exchanged.
+	Used bool
+}
+
+// Storage stores the clients, authorization codes and tokens of a Server.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// GetClient returns the client of ID id.
+	GetClient(ctx context.Context, id string) (*Client, error)
+
+	// SaveAuthorizationCode stores code.
+	SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) error
+	// TakeAuthorizationCode deletes the authorization code code and returns
+	// it, so that it is used once.
+	TakeAuthorizationCode(ctx context.Context, code string) (*AuthorizationCode, error)
+
+	// SaveRefreshToken stores token.
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	// GetRefreshToken returns the refresh token token.
+	GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+	// UseRefreshToken marks the refresh token token used, and returns it as
+	// it was before: Used if it already was.
+	UseRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+	// RevokeRefreshTokenFamily deletes the refresh tokens of family.
+	RevokeRefreshTokenFamily(ctx context.Context, family string) error
+
+	// RevokeAccessToken records the access token of ID jti revoked, until
+	// its expiration.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether the access token of ID jti is
+	// revoked.
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
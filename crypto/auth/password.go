@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/searKing/golib/crypto/rand_"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Password hashing algorithms, as named in their PHC strings.
+// https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashScrypt   = "scrypt"
+)
+
+var (
+	ErrPasswordMismatch        = errors.New("auth: password mismatch")
+	ErrUnsupportedPasswordHash = errors.New("auth: unsupported password hash")
+	ErrMalformedPasswordHash   = errors.New("auth: malformed password hash")
+)
+
+// Argon2idParams are the parameters of argon2id, RFC 9106.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// ScryptParams are the parameters of scrypt, RFC 7914. N is a power of 2.
+type ScryptParams struct {
+	N, R, P    int
+	SaltLength int
+	KeyLength  int
+}
+
+// PasswordHasher hashes passwords, and client secrets, in the PHC string
+// format: "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>",
+// "$scrypt$ln=15,r=8,p=1$<salt>$<hash>", or the "$2a$12$..." of bcrypt.
+type PasswordHasher struct {
+	// Algorithm is the algorithm of new hashes, argon2id if empty.
+	Algorithm string
+
+	// Argon2id and Scrypt are the parameters of argon2id and scrypt; those
+	// zero are those of DefaultPasswordHasher.
+	Argon2id Argon2idParams
+	// BcryptCost is the cost of bcrypt, bcrypt.DefaultCost if zero.
+	// bcrypt ignores the bytes of passwords beyond 72.
+	BcryptCost int
+	Scrypt     ScryptParams
+}
+
+var (
+	defaultArgon2idParams = Argon2idParams{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	defaultScryptParams   = ScryptParams{N: 1 << 15, R: 8, P: 1, SaltLength: 16, KeyLength: 32}
+)
+
+// DefaultPasswordHasher hashes passwords with argon2id.
+var DefaultPasswordHasher = &PasswordHasher{
+	Algorithm:  PasswordHashArgon2id,
+	Argon2id:   defaultArgon2idParams,
+	BcryptCost: 12,
+	Scrypt:     defaultScryptParams,
+}
+
+// HashPassword hashes password with DefaultPasswordHasher.
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+// VerifyPassword verifies password against encoded with
+// DefaultPasswordHasher, see PasswordHasher.Verify.
+func VerifyPassword(password, encoded string) (rehash bool, err error) {
+	return DefaultPasswordHasher.Verify(password, encoded)
+}
+
+var b64 = base64.RawStdEncoding
+
+// Hash returns the PHC string of password, of a random salt.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.algorithm() {
+	case PasswordHashArgon2id:
+		p := h.argon2idParams()
+		salt := rand_.Crypto.Bytes(int(p.SaltLength))
+		key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+			p.Memory, p.Iterations, p.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case PasswordHashBcrypt:
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost())
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case PasswordHashScrypt:
+		p := h.scryptParams()
+		salt := rand_.Crypto.Bytes(p.SaltLength)
+		key, err := scrypt.Key([]byte(password), salt, p.N, p.R, p.P, p.KeyLength)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", log2(p.N), p.R, p.P,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+	return "", ErrUnsupportedPasswordHash
+}
+
+func (h *PasswordHasher) bcryptCost() int {
+	if h.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.BcryptCost
+}
+
+func (h *PasswordHasher) argon2idParams() Argon2idParams {
+	p, def := h.Argon2id, defaultArgon2idParams
+	if p.Memory == 0 {
+		p.Memory = def.Memory
+	}
+	if p.Iterations == 0 {
+		p.Iterations = def.Iterations
+	}
+	if p.Parallelism == 0 {
+		p.Parallelism = def.Parallelism
+	}
+	if p.SaltLength == 0 {
+		p.SaltLength = def.SaltLength
+	}
+	if p.KeyLength == 0 {
+		p.KeyLength = def.KeyLength
+	}
+	return p
+}
+
+func (h *PasswordHasher) scryptParams() ScryptParams {
+	p, def := h.Scrypt, defaultScryptParams
+	if p.N == 0 {
+		p.N = def.N
+	}
+	if p.R == 0 {
+		p.R = def.R
+	}
+	if p.P == 0 {
+		p.P = def.P
+	}
+	if p.SaltLength == 0 {
+		p.SaltLength = def.SaltLength
+	}
+	if p.KeyLength == 0 {
+		p.KeyLength = def.KeyLength
+	}
+	return p
+}
+
+func (h *PasswordHasher) algorithm() string {
+	if h.Algorithm == "" {
+		return PasswordHashArgon2id
+	}
+	return h.Algorithm
+}
+
+// Verify verifies password against encoded, in constant time, and returns
+// ErrPasswordMismatch if it does not match. If it does, rehash reports
+// whether encoded is not of the algorithm and parameters of h: the caller
+// should then replace it by the Hash of password, upgrading it on login.
+func (h *PasswordHasher) Verify(password, encoded string) (rehash bool, err error) {
+	if strings.HasPrefix(encoded, "$2") {
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				return false, ErrPasswordMismatch
+			}
+			return false, ErrMalformedPasswordHash
+		}
+		cost, _ := bcrypt.Cost([]byte(encoded))
+		return h.algorithm() != PasswordHashBcrypt || cost != h.bcryptCost(), nil
+	}
+
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	var key []byte
+	switch phc.id {
+	case PasswordHashArgon2id:
+		if phc.version != argon2.Version {
+			return false, ErrUnsupportedPasswordHash
+		}
+		m, t, p := phc.params["m"], phc.params["t"], phc.params["p"]
+		if m == 0 || t == 0 || p == 0 || p > 255 {
+			return false, ErrMalformedPasswordHash
+		}
+		key = argon2.IDKey([]byte(password), phc.salt, uint32(t), uint32(m), uint8(p), uint32(len(phc.hash)))
+		current := h.argon2idParams()
+		rehash = h.algorithm() != PasswordHashArgon2id || uint32(m) != current.Memory ||
+			uint32(t) != current.Iterations || uint8(p) != current.Parallelism ||
+			uint32(len(phc.salt)) != current.SaltLength || uint32(len(phc.hash)) != current.KeyLength
+	case PasswordHashScrypt:
+		ln, r, p := phc.params["ln"], phc.params["r"], phc.params["p"]
+		if ln == 0 || ln > 62 || r == 0 || p == 0 {
+			return false, ErrMalformedPasswordHash
+		}
+		key, err = scrypt.Key([]byte(password), phc.salt, 1<<uint(ln), r, p, len(phc.hash))
+		if err != nil {
+			return false, ErrMalformedPasswordHash
+		}
+		current := h.scryptParams()
+		rehash = h.algorithm() != PasswordHashScrypt || 1<<uint(ln) != current.N || r != current.R ||
+			p != current.P || len(phc.salt) != current.SaltLength || len(phc.hash) != current.KeyLength
+	default:
+		return false, ErrUnsupportedPasswordHash
+	}
+	if subtle.ConstantTimeCompare(key, phc.hash) != 1 {
+		return false, ErrPasswordMismatch
+	}
+	return rehash, nil
+}
+
+// phc is a parsed PHC string, $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*]$<salt>$<hash>.
+type phc struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(encoded string) (*phc, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 4 || fields[0] != "" {
+		return nil, ErrMalformedPasswordHash
+	}
+	p := &phc{id: fields[1], params: make(map[string]int)}
+	fields = fields[2:]
+	if strings.HasPrefix(fields[0], "v=") {
+		v, err := strconv.Atoi(fields[0][len("v="):])
+		if err != nil {
+			return nil, ErrMalformedPasswordHash
+		}
+		p.version = v
+		fields = fields[1:]
+	}
+	if len(fields) == 2 { // no parameters
+		fields = append([]string{""}, fields...)
+	}
+	if len(fields) != 3 {
+		return nil, ErrMalformedPasswordHash
+	}
+	for _, kv := range strings.Split(fields[0], ",") {
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, ErrMalformedPasswordHash
+		}
+		v, err := strconv.Atoi(kv[i+1:])
+		if err != nil || v < 0 {
+			return nil, ErrMalformedPasswordHash
+		}
+		p.params[kv[:i]] = v
+	}
+	var err error
+	if p.salt, err = b64.DecodeString(fields[1]); err != nil {
+		return nil, ErrMalformedPasswordHash
+	}
+	if p.hash, err = b64.DecodeString(fields[2]); err != nil || len(p.hash) == 0 {
+		return nil, ErrMalformedPasswordHash
+	}
+	return p, nil
+}
+
+func log2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	fast := PasswordHasher{
+		Argon2id:   Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		BcryptCost: 4,
+		Scrypt:     ScryptParams{N: 1 << 10, R: 8, P: 1, SaltLength: 16, KeyLength: 32},
+	}
+	for _, alg := range []string{PasswordHashArgon2id, PasswordHashBcrypt, PasswordHashScrypt} {
+		h := fast
+		h.Algorithm = alg
+		encoded, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if rehash, err := h.Verify("correct horse", encoded); err != nil || rehash {
+			t.Errorf("%s: Verify of %q = %t, %v", alg, encoded, rehash, err)
+		}
+		if _, err := h.Verify("battery staple", encoded); err != ErrPasswordMismatch {
+			t.Errorf("%s: Verify of a wrong password: %v", alg, err)
+		}
+
+		// upgrade on login
+		upgraded := fast
+		upgraded.Argon2id.Iterations = 2
+		if rehash, err := upgraded.Verify("correct horse", encoded); err != nil || !rehash {
+			t.Errorf("%s: Verify with upgraded parameters = %t, %v", alg, rehash, err)
+		}
+	}
+
+	if encoded, _ := fast.Hash("x"); !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("argon2id PHC string %q", encoded)
+	}
+	if _, err := fast.Verify("x", "$argon2id$v=19$m=1024"); err != ErrMalformedPasswordHash {
+		t.Errorf("Verify of a malformed hash: %v", err)
+	}
+	if _, err := fast.Verify("x", "$md5$salt$hash"); err != ErrUnsupportedPasswordHash {
+		t.Errorf("Verify of an unsupported hash: %v", err)
+	}
+
+	// a zero BcryptCost is bcrypt.DefaultCost
+	zero := &PasswordHasher{Algorithm: PasswordHashBcrypt}
+	encoded, err := zero.Hash("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rehash, err := zero.Verify("x", encoded); err != nil || rehash {
+		t.Errorf("Verify with a zero BcryptCost = %t, %v", rehash, err)
+	}
+
+	// zero parameters are those of DefaultPasswordHasher
+	for _, zero := range []*PasswordHasher{{}, {Algorithm: PasswordHashScrypt}, {Algorithm: PasswordHashScrypt, Scrypt: ScryptParams{N: 1 << 10}}} {
+		encoded, err := zero.Hash("x")
+		if err != nil {
+			t.Fatalf("%+v: %v", zero, err)
+		}
+		if rehash, err := zero.Verify("x", encoded); err != nil || rehash {
+			t.Errorf("%+v: Verify of %q = %t, %v", zero, encoded, rehash, err)
+		}
+		if zero.Algorithm == "" && !strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=2$") {
+			t.Errorf("argon2id PHC string of a zero PasswordHasher %q", encoded)
+		}
+	}
+}
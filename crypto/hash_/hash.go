@@ -0,0 +1,212 @@
+// Package hash_ computes digests of several algorithms in a single pass,
+// verifies them while reading or writing, and generates and verifies
+// sha256sum-compatible manifests of directories.
+package hash_
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algorithm is the name of a hash algorithm, as in manifests and
+// configurations.
+type Algorithm string
+
+const (
+	MD5        Algorithm = "md5"
+	SHA1       Algorithm = "sha1"
+	SHA256     Algorithm = "sha256"
+	SHA512     Algorithm = "sha512"
+	BLAKE2b256 Algorithm = "blake2b-256"
+	BLAKE2b512 Algorithm = "blake2b-512"
+	// XXH64 and CRC32C are fast checksums against accidental corruption,
+	// not cryptographic hashes.
+	XXH64  Algorithm = "xxh64"
+	CRC32C Algorithm = "crc32c"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("hash_: unknown algorithm")
+	ErrDigestMismatch   = errors.New("hash_: digest mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[Algorithm]func() hash.Hash{
+		MD5:    md5.New,
+		SHA1:   sha1.New,
+		SHA256: sha256.New,
+		SHA512: sha512.New,
+		BLAKE2b256: func() hash.Hash {
+			h, _ := blake2b.New256(nil)
+			return h
+		},
+		BLAKE2b512: func() hash.Hash {
+			h, _ := blake2b.New512(nil)
+			return h
+		},
+		XXH64:  func() hash.Hash { return NewXXH64(0) },
+		CRC32C: func() hash.Hash { return crc32.New(castagnoli) },
+	}
+)
+
+// RegisterAlgorithm registers the hash algorithm alg, replacing the one
+// of the same name.
+func RegisterAlgorithm(alg Algorithm, newHash func() hash.Hash) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	algorithms[alg] = newHash
+}
+
+// Algorithms returns the names of the registered algorithms, sorted.
+func Algorithms() []Algorithm {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	algs := make([]Algorithm, 0, len(algorithms))
+	for alg := range algorithms {
+		algs = append(algs, alg)
+	}
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+	return algs
+}
+
+// Available reports whether alg is registered.
+func (alg Algorithm) Available() bool {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	_, ok := algorithms[alg]
+	return ok
+}
+
+// New returns a new hash.Hash of alg.
+func (alg Algorithm) New() (hash.Hash, error) {
+	algorithmsMu.RLock()
+	newHash, ok := algorithms[alg]
+	algorithmsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+	return newHash(), nil
+}
+
+// SumBytes returns the digest of b by alg.
+func (alg Algorithm) SumBytes(b []byte) ([]byte, error) {
+	h, err := alg.New()
+	if err != nil {
+		return nil, err
+	}
+	h.Write(b)
+	return h.Sum(nil), nil
+}
+
+// SumReader returns the digest of the content of r by alg.
+func (alg Algorithm) SumReader(r io.Reader) ([]byte, error) {
+	digests, err := SumReader(r, alg)
+	if err != nil {
+		return nil, err
+	}
+	return digests[alg], nil
+}
+
+// SumFile returns the digest of the file name by alg.
+func (alg Algorithm) SumFile(name string) ([]byte, error) {
+	digests, err := SumFile(name, alg)
+	if err != nil {
+		return nil, err
+	}
+	return digests[alg], nil
+}
+
+// Digests are the digests of a content by several algorithms.
+type Digests map[Algorithm][]byte
+
+// Hex returns the digest by alg hex encoded, or "" if none.
+func (d Digests) Hex(alg Algorithm) string {
+	if sum, ok := d[alg]; ok {
+		return hex.EncodeToString(sum)
+	}
+	return ""
+}
+
+// MultiHash computes the digests of algorithms in a single pass over the
+// content written to it.
+type MultiHash struct {
+	hashes map[Algorithm]hash.Hash
+	w      io.Writer
+}
+
+// NewMultiHash returns a MultiHash of algs.
+func NewMultiHash(algs ...Algorithm) (*MultiHash, error) {
+	m := &MultiHash{hashes: make(map[Algorithm]hash.Hash, len(algs))}
+	var ws []io.Writer
+	for _, alg := range algs {
+		if _, ok := m.hashes[alg]; ok {
+			continue
+		}
+		h, err := alg.New()
+		if err != nil {
+			return nil, err
+		}
+		m.hashes[alg] = h
+		ws = append(ws, h)
+	}
+	m.w = io.MultiWriter(ws...)
+	return m, nil
+}
+
+// Write adds p to the running hashes. It never returns an error.
+func (m *MultiHash) Write(p []byte) (int, error) {
+	return m.w.Write(p)
+}
+
+// Reset resets the hashes to their initial state.
+func (m *MultiHash) Reset() {
+	for _, h := range m.hashes {
+		h.Reset()
+	}
+}
+
+// Sums returns the current digests.
+func (m *MultiHash) Sums() Digests {
+	d := make(Digests, len(m.hashes))
+	for alg, h := range m.hashes {
+		d[alg] = h.Sum(nil)
+	}
+	return d
+}
+
+// SumReader returns the digests of the content of r by algs, reading r once.
+func SumReader(r io.Reader, algs ...Algorithm) (Digests, error) {
+	m, err := NewMultiHash(algs...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(m, r); err != nil {
+		return nil, err
+	}
+	return m.Sums(), nil
+}
+
+// SumFile returns the digests of the file name by algs, reading it once.
+func SumFile(name string, algs ...Algorithm) (Digests, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return SumReader(f, algs...)
+}
@@ -0,0 +1,110 @@
+package hash_
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	tests := []struct {
+		alg  Algorithm
+		in   string
+		want string
+	}{
+		{SHA256, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{BLAKE2b256, "abc", "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{CRC32C, "123456789", "e3069283"},
+		{XXH64, "", "ef46db3751d8e999"},
+		{XXH64, "abc", "44bc2cf5ad770999"},
+		{XXH64, "Nobody inspects the spammish repetition", "fbcea83c8a378bf1"},
+	}
+	for _, tt := range tests {
+		d, err := SumReader(strings.NewReader(tt.in), tt.alg, SHA512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Hex(tt.alg); got != tt.want {
+			t.Errorf("%s(%q) = %s, want %s", tt.alg, tt.in, got, tt.want)
+		}
+	}
+	if _, err := Algorithm("nope").New(); err != ErrUnknownAlgorithm {
+		t.Errorf("New of an unknown algorithm: %v", err)
+	}
+
+	// streaming in pieces across the 32 bytes stripes
+	in := []byte(strings.Repeat("0123456789", 13))
+	h := NewXXH64(0)
+	for i := 0; i < len(in); i += 7 {
+		end := i + 7
+		if end > len(in) {
+			end = len(in)
+		}
+		h.Write(in[i:end])
+	}
+	if want, _ := XXH64.SumBytes(in); !bytes.Equal(h.Sum(nil), want) {
+		t.Errorf("XXH64 in pieces %x, at once %x", h.Sum(nil), want)
+	}
+}
+
+func TestVerifying(t *testing.T) {
+	want, _ := SHA256.SumBytes([]byte("abc"))
+	r, _ := NewVerifyingReader(strings.NewReader("abc"), SHA256, want)
+	if b, err := ioutil.ReadAll(r); err != nil || string(b) != "abc" {
+		t.Errorf("ReadAll = %q, %v", b, err)
+	}
+	r, _ = NewVerifyingReader(strings.NewReader("abd"), SHA256, want)
+	if _, err := ioutil.ReadAll(r); err != ErrDigestMismatch {
+		t.Errorf("ReadAll of a corrupt content: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewVerifyingWriter(&buf, SHA256, want)
+	io.WriteString(w, "ab")
+	io.WriteString(w, "c")
+	if err := w.Close(); err != nil || buf.String() != "abc" {
+		t.Errorf("Close = %v, wrote %q", err, buf.String())
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("abc"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b\\n.txt"), []byte("b"), 0600)
+
+	m, err := GenerateManifest(dir, SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if !strings.HasPrefix(buf.String(), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad  a.txt\n\\") {
+		t.Errorf("manifest\n%s", buf.String())
+	}
+	parsed, err := ParseManifest(&buf)
+	if err != nil || len(parsed) != 2 || parsed[1].Path != "sub/b\\n.txt" {
+		t.Fatalf("ParseManifest = %v, %v", parsed, err)
+	}
+	if err := parsed.Verify(dir, SHA256); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("abd"), 0600)
+	os.Remove(filepath.Join(dir, "sub", "b\\n.txt"))
+	merr, ok := parsed.Verify(dir, SHA256).(*ManifestError)
+	if !ok || len(merr.Mismatched) != 1 || len(merr.Missing) != 1 {
+		t.Errorf("Verify of a modified tree: %v", merr)
+	}
+	if err := (Manifest{{Path: "../x", Sum: nil}}).Verify(dir, SHA256); err != ErrUnsafePath {
+		t.Errorf("Verify of ../x: %v", err)
+	}
+}
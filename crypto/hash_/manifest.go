@@ -0,0 +1,178 @@
+package hash_
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrUnsafePath = errors.New("hash_: manifest path outside the root")
+
+// ManifestEntry is the digest of a file of a manifest.
+type ManifestEntry struct {
+	// Path is the slash-separated path of the file, relative to the root.
+	Path string
+	Sum  []byte
+}
+
+// Manifest lists the digests of the files of a directory, in the format of
+// sha256sum and its siblings: a line "<hex digest>  <path>" per file.
+type Manifest []ManifestEntry
+
+// GenerateManifest returns the manifest of the regular files under root,
+// sorted by path, hashed by alg. Symbolic links are not followed.
+func GenerateManifest(root string, alg Algorithm) (Manifest, error) {
+	if !alg.Available() {
+		return nil, ErrUnknownAlgorithm
+	}
+	var m Manifest
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		sum, err := alg.SumFile(name)
+		if err != nil {
+			return err
+		}
+		m = append(m, ManifestEntry{Path: filepath.ToSlash(rel), Sum: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(m, func(i, j int) bool { return m[i].Path < m[j].Path })
+	return m, nil
+}
+
+// WriteTo writes m to w, as sha256sum does: paths of backslashes or
+// newlines are escaped and their lines start with a backslash.
+func (m Manifest) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, e := range m {
+		p := e.Path
+		if strings.ContainsAny(p, "\\\n") {
+			buf.WriteByte('\\')
+			p = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(p)
+		}
+		buf.WriteString(hex.EncodeToString(e.Sum))
+		buf.WriteString("  ")
+		buf.WriteString(p)
+		buf.WriteByte('\n')
+	}
+	return buf.WriteTo(w)
+}
+
+// ParseManifest parses a manifest in the format of sha256sum, in text
+// ("  ") or binary (" *") mode.
+func ParseManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 || i+2 > len(line) || (line[i+1] != ' ' && line[i+1] != '*') {
+			return nil, fmt.Errorf("hash_: malformed manifest line %d", n)
+		}
+		sum, err := hex.DecodeString(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("hash_: malformed digest at manifest line %d", n)
+		}
+		p := line[i+2:]
+		if escaped {
+			if p, err = unescapePath(p); err != nil {
+				return nil, fmt.Errorf("hash_: malformed path at manifest line %d", n)
+			}
+		}
+		m = append(m, ManifestEntry{Path: p, Sum: sum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func unescapePath(p string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] != '\\' {
+			b.WriteByte(p[i])
+			continue
+		}
+		if i++; i == len(p) {
+			return "", errors.New("trailing backslash")
+		}
+		switch p[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", errors.New("unknown escape")
+		}
+	}
+	return b.String(), nil
+}
+
+// ManifestError lists the files that failed the verification of a manifest.
+type ManifestError struct {
+	Mismatched []string
+	Missing    []string
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("hash_: manifest verification failed: %d mismatched, %d missing: %s",
+		len(e.Mismatched), len(e.Missing), strings.Join(append(append([]string{}, e.Mismatched...), e.Missing...), ", "))
+}
+
+// Verify verifies the files of m under root by alg. It returns a
+// *ManifestError if files are missing or their digests mismatch, and
+// ErrUnsafePath if a path of m is absolute or leaves root.
+func (m Manifest) Verify(root string, alg Algorithm) error {
+	if !alg.Available() {
+		return ErrUnknownAlgorithm
+	}
+	var merr ManifestError
+	for _, e := range m {
+		p := path.Clean(e.Path)
+		if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") || filepath.IsAbs(filepath.FromSlash(p)) {
+			return ErrUnsafePath
+		}
+		sum, err := alg.SumFile(filepath.Join(root, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			merr.Missing = append(merr.Missing, e.Path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, e.Sum) {
+			merr.Mismatched = append(merr.Mismatched, e.Path)
+		}
+	}
+	if len(merr.Mismatched) > 0 || len(merr.Missing) > 0 {
+		return &merr
+	}
+	return nil
+}
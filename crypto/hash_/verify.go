@@ -0,0 +1,82 @@
+package hash_
+
+import (
+	"crypto/subtle"
+	"hash"
+	"io"
+)
+
+// VerifyingReader reads from a reader, hashing what it reads, and returns
+// ErrDigestMismatch instead of io.EOF if the digest of the content is not
+// the expected one. The content must not be trusted before EOF.
+type VerifyingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want []byte
+	err  error
+}
+
+// NewVerifyingReader returns a VerifyingReader of r, expecting the digest
+// want by alg.
+func NewVerifyingReader(r io.Reader, alg Algorithm, want []byte) (*VerifyingReader, error) {
+	h, err := alg.New()
+	if err != nil {
+		return nil, err
+	}
+	return &VerifyingReader{r: r, h: h, want: want}, nil
+}
+
+func (v *VerifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		err = verify(v.h, v.want)
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		v.err = err
+	}
+	return n, err
+}
+
+// VerifyingWriter writes to a writer, hashing what it writes, and verifies
+// the digest of the content on Close.
+type VerifyingWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	want []byte
+}
+
+// NewVerifyingWriter returns a VerifyingWriter of w, expecting the digest
+// want by alg.
+func NewVerifyingWriter(w io.Writer, alg Algorithm, want []byte) (*VerifyingWriter, error) {
+	h, err := alg.New()
+	if err != nil {
+		return nil, err
+	}
+	return &VerifyingWriter{w: w, h: h, want: want}, nil
+}
+
+func (v *VerifyingWriter) Write(p []byte) (int, error) {
+	n, err := v.w.Write(p)
+	v.h.Write(p[:n])
+	return n, err
+}
+
+// Close returns ErrDigestMismatch if the digest of the content written is
+// not the expected one. It does not close the underlying writer.
+func (v *VerifyingWriter) Close() error {
+	return verify(v.h, v.want)
+}
+
+func verify(h hash.Hash, want []byte) error {
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return ErrDigestMismatch
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package hash_
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+const (
+	prime64x1 uint64 = 11400714785074694791
+	prime64x2 uint64 = 14029467366897019727
+	prime64x3 uint64 = 1609587929392839161
+	prime64x4 uint64 = 9650029242287828579
+	prime64x5 uint64 = 2870177450012600261
+)
+
+// xxh64 is the streaming state of XXH64.
+type xxh64 struct {
+	seed           uint64
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int // bytes in buf
+}
+
+// NewXXH64 returns a hash.Hash64 computing XXH64 of seed, a fast
+// non-cryptographic hash. Its Sum is big endian.
+func NewXXH64(seed uint64) hash.Hash64 {
+	d := &xxh64{seed: seed}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	d.v1 = d.seed + prime64x1 + prime64x2
+	d.v2 = d.seed + prime64x2
+	d.v3 = d.seed
+	d.v4 = d.seed - prime64x1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func xxh64Round(acc, input uint64) uint64 {
+	acc += input * prime64x2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime64x1
+}
+
+func xxh64MergeRound(acc, val uint64) uint64 {
+	acc ^= xxh64Round(0, val)
+	return acc*prime64x1 + prime64x4
+}
+
+func (d *xxh64) stripe(b []byte) {
+	d.v1 = xxh64Round(d.v1, binary.LittleEndian.Uint64(b[0:]))
+	d.v2 = xxh64Round(d.v2, binary.LittleEndian.Uint64(b[8:]))
+	d.v3 = xxh64Round(d.v3, binary.LittleEndian.Uint64(b[16:]))
+	d.v4 = xxh64Round(d.v4, binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (d *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	d.total += uint64(n)
+	if d.n > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n < len(d.buf) {
+			return n, nil
+		}
+		d.stripe(d.buf[:])
+		d.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		d.stripe(p)
+	}
+	d.n = copy(d.buf[:], p)
+	return n, nil
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) +
+			bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = xxh64MergeRound(h, d.v1)
+		h = xxh64MergeRound(h, d.v2)
+		h = xxh64MergeRound(h, d.v3)
+		h = xxh64MergeRound(h, d.v4)
+	} else {
+		h = d.seed + prime64x5
+	}
+	h += d.total
+
+	p := d.buf[:d.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxh64Round(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*prime64x1 + prime64x4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * prime64x1
+		h = bits.RotateLeft64(h, 23)*prime64x2 + prime64x3
+		p = p[4:]
+	}
+	for _, c := range p {
+		h ^= uint64(c) * prime64x5
+		h = bits.RotateLeft64(h, 11) * prime64x1
+	}
+
+	h ^= h >> 33
+	h *= prime64x2
+	h ^= h >> 29
+	h *= prime64x3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	var s [8]byte
+	binary.BigEndian.PutUint64(s[:], d.Sum64())
+	return append(b, s[:]...)
+}
@@ -0,0 +1,106 @@
+package jwt_
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNotEdPrivateKey = errors.New("jwt_: key is not a valid Ed25519 private key")
+	ErrNotEdPublicKey  = errors.New("jwt_: key is not a valid Ed25519 public key")
+)
+
+// SigningMethodEd25519 implements the EdDSA signing method with Ed25519
+// keys: ed25519.PrivateKey to sign, ed25519.PublicKey to verify.
+// https://tools.ietf.org/html/rfc8037#section-3.1
+type SigningMethodEd25519 struct{}
+
+// SigningMethodEdDSAEd25519 is the EdDSA signing method, registered in
+// jwt-go as SigningMethodEdDSA.
+var SigningMethodEdDSAEd25519 = &SigningMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA, func() jwt.SigningMethod {
+		return SigningMethodEdDSAEd25519
+	})
+}
+
+func (m *SigningMethodEd25519) Alg() string {
+	return SigningMethodEdDSA
+}
+
+func (m *SigningMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok || len(priv) != ed25519.PrivateKeySize {
+		return "", ErrNotEdPrivateKey
+	}
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+func (m *SigningMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return ErrNotEdPublicKey
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// ParseEdPrivateKeyFromPEM parses a PKCS#8 "PRIVATE KEY" PEM block of an
+// Ed25519 key, encrypted with password if given.
+func ParseEdPrivateKeyFromPEM(key []byte, password ...string) (ed25519.PrivateKey, error) {
+	der, err := pemBytes(key, password...)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrNotEdPrivateKey
+	}
+	return priv, nil
+}
+
+// ParseEdPublicKeyFromPEM parses a PKIX "PUBLIC KEY" PEM block of an
+// Ed25519 key.
+func ParseEdPublicKeyFromPEM(key []byte) (ed25519.PublicKey, error) {
+	der, err := pemBytes(key)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrNotEdPublicKey
+	}
+	return pub, nil
+}
+
+// pemBytes returns the DER bytes of the first PEM block of key, decrypted
+// with password if given and the block is encrypted.
+func pemBytes(key []byte, password ...string) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	if len(password) > 0 && x509.IsEncryptedPEMBlock(block) {
+		return x509.DecryptPEMBlock(block, []byte(password[0]))
+	}
+	return block.Bytes, nil
+}
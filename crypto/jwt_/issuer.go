@@ -0,0 +1,79 @@
+package jwt_
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// Signer signs tokens, as AuthKey and KeySet do.
+type Signer interface {
+	SignedString(claims jwt.Claims) (string, error)
+}
+
+// Issuer mints tokens with the registered claims set: "iss", "aud", "exp",
+// "nbf", "iat" and "jti".
+type Issuer struct {
+	// Signer signs the tokens. Required.
+	Signer Signer
+	// Issuer is the "iss" of the tokens, if not empty.
+	Issuer string
+	// Audience is the "aud" of the tokens, if not empty: a string if it
+	// has a single element, an array otherwise.
+	Audience []string
+	// TTL is the lifetime of the tokens, the "exp" being "iat" + TTL. If
+	// zero, the tokens have no "exp".
+	TTL time.Duration
+	// NotBefore delays the validity of the tokens, the "nbf" being
+	// "iat" + NotBefore.
+	NotBefore time.Duration
+	// NewID returns the "jti" of the tokens. If nil, random UUIDs are.
+	NewID func() string
+	// Now returns the time tokens are issued at. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Claims returns the claims of a token for subject, if not empty, with
+// the registered claims set; claims of extra override them.
+func (iss *Issuer) Claims(subject string, extra map[string]interface{}) jwt.MapClaims {
+	now := time.Now
+	if iss.Now != nil {
+		now = iss.Now
+	}
+	iat := now()
+	claims := jwt.MapClaims{
+		ClaimsIssuedAt:  iat.Unix(),
+		ClaimsNotBefore: iat.Add(iss.NotBefore).Unix(),
+	}
+	if iss.NewID != nil {
+		claims[ClaimsJWTID] = iss.NewID()
+	} else {
+		claims[ClaimsJWTID] = uuid.New().String()
+	}
+	if iss.TTL > 0 {
+		claims[ClaimsExpirationTime] = iat.Add(iss.TTL).Unix()
+	}
+	if iss.Issuer != "" {
+		claims[ClaimsIssuer] = iss.Issuer
+	}
+	switch len(iss.Audience) {
+	case 0:
+	case 1:
+		claims[ClaimsAudience] = iss.Audience[0]
+	default:
+		claims[ClaimsAudience] = iss.Audience
+	}
+	if subject != "" {
+		claims[ClaimsSubject] = subject
+	}
+	for name, v := range extra {
+		claims[name] = v
+	}
+	return claims
+}
+
+// Issue returns a signed token for subject, see Claims.
+func (iss *Issuer) Issue(subject string, extra map[string]interface{}) (string, error) {
+	return iss.Signer.SignedString(iss.Claims(subject, extra))
+}
@@ -0,0 +1,323 @@
+package jwt_
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// JWE key management algorithms, https://tools.ietf.org/html/rfc7518#section-4.1
+const (
+	KeyAlgorithmRSAOAEP    = "RSA-OAEP"     // RSAES OAEP using SHA-1 and MGF1 with SHA-1
+	KeyAlgorithmRSAOAEP256 = "RSA-OAEP-256" // RSAES OAEP using SHA-256 and MGF1 with SHA-256
+	KeyAlgorithmECDHES     = "ECDH-ES"      // ECDH-ES using Concat KDF, direct key agreement
+)
+
+// JWE content encryption algorithms, https://tools.ietf.org/html/rfc7518#section-5.1
+const (
+	EncryptionA128GCM = "A128GCM" // AES GCM using 128-bit key
+	EncryptionA256GCM = "A256GCM" // AES GCM using 256-bit key
+)
+
+var (
+	ErrUnsupportedJWEAlgorithm = errors.New("jwt_: unsupported JWE algorithm")
+	ErrMalformedJWE            = errors.New("jwt_: malformed JWE")
+	ErrJWEDecryption           = errors.New("jwt_: JWE decryption failed")
+)
+
+// JWEHeader is the JOSE Header of a JWE, RFC 7516, section 4.
+type JWEHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	KeyID       string `json:"kid,omitempty"`
+	Type        string `json:"typ,omitempty"`
+	ContentType string `json:"cty,omitempty"`
+
+	// ECDH-ES, https://tools.ietf.org/html/rfc7518#section-4.6.1
+	EphemeralPublicKey *JSONWebKey `json:"epk,omitempty"`
+	PartyUInfo         string      `json:"apu,omitempty"` // base64url encoded
+	PartyVInfo         string      `json:"apv,omitempty"` // base64url encoded
+}
+
+// contentKeySize returns the size of the content encryption key of enc.
+func contentKeySize(enc string) (int, error) {
+	switch enc {
+	case EncryptionA128GCM:
+		return 16, nil
+	case EncryptionA256GCM:
+		return 32, nil
+	}
+	return 0, ErrUnsupportedJWEAlgorithm
+}
+
+func oaepHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case KeyAlgorithmRSAOAEP:
+		return sha1.New(), nil
+	case KeyAlgorithmRSAOAEP256:
+		return sha256.New(), nil
+	}
+	return nil, ErrUnsupportedJWEAlgorithm
+}
+
+// EncryptJWE returns the JWE Compact Serialization of plaintext encrypted
+// for the recipient key, an *rsa.PublicKey for RSA-OAEP or an
+// *ecdsa.PublicKey for ECDH-ES, with the algorithms of header.
+// https://tools.ietf.org/html/rfc7516#section-5.1
+func EncryptJWE(plaintext []byte, key crypto.PublicKey, header JWEHeader) (string, error) {
+	size, err := contentKeySize(header.Encryption)
+	if err != nil {
+		return "", err
+	}
+	var cek, encryptedKey []byte
+	switch header.Algorithm {
+	case KeyAlgorithmRSAOAEP, KeyAlgorithmRSAOAEP256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", jwt.ErrInvalidKeyType
+		}
+		cek = make([]byte, size)
+		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+			return "", err
+		}
+		h, _ := oaepHash(header.Algorithm)
+		if encryptedKey, err = rsa.EncryptOAEP(h, rand.Reader, pub, cek, nil); err != nil {
+			return "", err
+		}
+	case KeyAlgorithmECDHES:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", jwt.ErrInvalidKeyType
+		}
+		eph, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		n := curveSize(pub.Curve)
+		header.EphemeralPublicKey = &JSONWebKey{KeyType: KeyTypeEC, Curve: pub.Curve.Params().Name,
+			X: encodeBigInt(eph.X, n), Y: encodeBigInt(eph.Y, n)}
+		if cek, err = ecdhesKey(eph, pub, &header, size); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrUnsupportedJWEAlgorithm
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := b64.EncodeToString(h)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(plaintext)], sealed[len(plaintext):]
+	return strings.Join([]string{protected, b64.EncodeToString(encryptedKey),
+		b64.EncodeToString(iv), b64.EncodeToString(ciphertext), b64.EncodeToString(tag)}, "."), nil
+}
+
+// DecryptJWE returns the plaintext of the JWE Compact Serialization token,
+// decrypted with the private key of the recipient, an *rsa.PrivateKey or an
+// *ecdsa.PrivateKey, and its header.
+// https://tools.ietf.org/html/rfc7516#section-5.2
+func DecryptJWE(token string, key crypto.PrivateKey) ([]byte, *JWEHeader, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, ErrMalformedJWE
+	}
+	var raw [5][]byte
+	for i, part := range parts {
+		b, err := b64.DecodeString(part)
+		if err != nil {
+			return nil, nil, ErrMalformedJWE
+		}
+		raw[i] = b
+	}
+	var header JWEHeader
+	if err := json.Unmarshal(raw[0], &header); err != nil {
+		return nil, nil, ErrMalformedJWE
+	}
+	size, err := contentKeySize(header.Encryption)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cek []byte
+	switch header.Algorithm {
+	case KeyAlgorithmRSAOAEP, KeyAlgorithmRSAOAEP256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, jwt.ErrInvalidKeyType
+		}
+		h, _ := oaepHash(header.Algorithm)
+		if cek, err = rsa.DecryptOAEP(h, nil, priv, raw[1], nil); err != nil || len(cek) != size {
+			return nil, nil, ErrJWEDecryption
+		}
+	case KeyAlgorithmECDHES:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, jwt.ErrInvalidKeyType
+		}
+		if header.EphemeralPublicKey == nil || len(raw[1]) != 0 {
+			return nil, nil, ErrMalformedJWE
+		}
+		// NewAuthKeyFromJWK checks the point is on the curve
+		epk, err := NewAuthKeyFromJWK(&JSONWebKey{KeyType: KeyTypeEC, Curve: header.EphemeralPublicKey.Curve,
+			X: header.EphemeralPublicKey.X, Y: header.EphemeralPublicKey.Y})
+		if err != nil {
+			return nil, nil, ErrMalformedJWE
+		}
+		pub := epk.pubKey.(*ecdsa.PublicKey)
+		if pub.Curve != priv.Curve {
+			return nil, nil, ErrMalformedJWE
+		}
+		if cek, err = ecdhesKey(priv, pub, &header, size); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, ErrUnsupportedJWEAlgorithm
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw[2]) != gcm.NonceSize() {
+		return nil, nil, ErrMalformedJWE
+	}
+	plaintext, err := gcm.Open(nil, raw[2], append(raw[3], raw[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, ErrJWEDecryption
+	}
+	return plaintext, &header, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ecdhesKey returns the content encryption key agreed by priv and pub for
+// header, of size bytes.
+// https://tools.ietf.org/html/rfc7518#section-4.6.2
+func ecdhesKey(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, header *JWEHeader, size int) ([]byte, error) {
+	apu, err := b64.DecodeString(header.PartyUInfo)
+	if err != nil {
+		return nil, ErrMalformedJWE
+	}
+	apv, err := b64.DecodeString(header.PartyVInfo)
+	if err != nil {
+		return nil, ErrMalformedJWE
+	}
+	x, _ := priv.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	z := make([]byte, curveSize(priv.Curve))
+	xb := x.Bytes()
+	copy(z[len(z)-len(xb):], xb)
+	return concatKDF(z, header.Encryption, apu, apv, size), nil
+}
+
+// concatKDF derives a key of size bytes from the shared secret z with the
+// Concat KDF of NIST SP 800-56A, section 5.8.1, with SHA-256.
+func concatKDF(z []byte, alg string, apu, apv []byte, size int) []byte {
+	var otherInfo []byte
+	for _, b := range [][]byte{[]byte(alg), apu, apv} {
+		otherInfo = appendUint32(otherInfo, uint32(len(b)))
+		otherInfo = append(otherInfo, b...)
+	}
+	otherInfo = appendUint32(otherInfo, uint32(size*8)) // SuppPubInfo, keydatalen
+
+	var key []byte
+	for counter := uint32(1); len(key) < size; counter++ {
+		h := sha256.New()
+		h.Write(appendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:size]
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// keyManagementAlgorithm returns the JWE "alg" of a: RSA-OAEP for RSA keys,
+// ECDH-ES for EC keys.
+func (a *AuthKey) keyManagementAlgorithm() (string, error) {
+	switch {
+	case a.IsRSAKey():
+		return KeyAlgorithmRSAOAEP, nil
+	case a.IsECMAKey():
+		return KeyAlgorithmECDHES, nil
+	}
+	return "", ErrUnsupportedJWEAlgorithm
+}
+
+// EncryptJWE returns the JWE of plaintext encrypted for the public key of
+// a with the content encryption algorithm enc, such as EncryptionA256GCM,
+// and header cty. The "alg" is RSA-OAEP for RSA keys and ECDH-ES for EC
+// keys.
+func (a *AuthKey) EncryptJWE(plaintext []byte, enc, cty string) (string, error) {
+	alg, err := a.keyManagementAlgorithm()
+	if err != nil {
+		return "", err
+	}
+	return EncryptJWE(plaintext, a.pubKey, JWEHeader{Algorithm: alg, Encryption: enc, ContentType: cty})
+}
+
+// DecryptJWE returns the plaintext of the JWE token encrypted for a, and
+// its header.
+func (a *AuthKey) DecryptJWE(token string) ([]byte, *JWEHeader, error) {
+	if _, err := a.keyManagementAlgorithm(); err != nil {
+		return nil, nil, err
+	}
+	return DecryptJWE(token, a.privKey)
+}
+
+// EncryptedString returns the JWT of claims signed with signer, then
+// encrypted for the public key of a: a Nested JWT, of "cty" "JWT".
+// https://tools.ietf.org/html/rfc7519#section-5.2
+func (a *AuthKey) EncryptedString(signer Signer, claims jwt.Claims, enc string) (string, error) {
+	signed, err := signer.SignedString(claims)
+	if err != nil {
+		return "", err
+	}
+	return a.EncryptJWE([]byte(signed), enc, "JWT")
+}
+
+// DecryptSigned returns the signed JWT nested in the JWE token encrypted
+// for a, to parse and verify, such as with a Validator.
+func (a *AuthKey) DecryptSigned(token string) (string, error) {
+	plaintext, header, err := a.DecryptJWE(token)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(header.ContentType, "JWT") {
+		return "", ErrMalformedJWE
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,126 @@
+package jwt_
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewAuthKey(SigningMethodEdDSA,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.IsSymmetricKey() || !key.IsEdDSAKey() {
+		t.Errorf("EdDSA key symmetric %t", key.IsSymmetricKey())
+	}
+	s, err := key.SignedString(jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, jwt.EncodeSegment([]byte(`{"alg":"EdDSA"`))[:16]) {
+		t.Errorf("token %s", s)
+	}
+	if _, err := jwt.Parse(s, key.GetVerifiedKey); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+	other, _ := NewAuthKeyFromRandom(SigningMethodEdDSA)
+	if _, err := jwt.Parse(s, other.GetVerifiedKey); err == nil {
+		t.Error("Parse with another key succeeded")
+	}
+}
+
+func TestJWE(t *testing.T) {
+	signer, _ := NewAuthKeyFromRandom(SigningMethodEdDSA)
+	for _, alg := range []string{SigningMethodRS256, SigningMethodES256, SigningMethodES384} {
+		key, err := NewAuthKeyFromRandom(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, enc := range []string{EncryptionA128GCM, EncryptionA256GCM} {
+			token, err := key.EncryptedString(signer, jwt.MapClaims{"email": "alice@example.org"}, enc)
+			if err != nil {
+				t.Fatalf("%s %s: EncryptedString: %v", alg, enc, err)
+			}
+			if strings.Contains(token, "alice") || strings.Count(token, ".") != 4 {
+				t.Errorf("%s %s: JWE %s", alg, enc, token)
+			}
+			signed, err := key.DecryptSigned(token)
+			if err != nil {
+				t.Fatalf("%s %s: DecryptSigned: %v", alg, enc, err)
+			}
+			claims, err := (&Validator{Keyfunc: signer.GetVerifiedKey}).Validate(signed)
+			if err != nil || claims["email"] != "alice@example.org" {
+				t.Errorf("%s %s: Validate = %v, %v", alg, enc, claims, err)
+			}
+
+			// a modified ciphertext does not decrypt
+			parts := strings.Split(token, ".")
+			parts[3] = jwt.EncodeSegment([]byte("tampered"))
+			if _, _, err := key.DecryptJWE(strings.Join(parts, ".")); err != ErrJWEDecryption {
+				t.Errorf("%s %s: DecryptJWE of a tampered JWE = %v", alg, enc, err)
+			}
+		}
+	}
+
+	pub, _ := NewAuthKeyFromRandom(SigningMethodRS256)
+	token, err := EncryptJWE([]byte("hi"), pub.pubKey, JWEHeader{Algorithm: KeyAlgorithmRSAOAEP256, Encryption: EncryptionA256GCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, header, err := DecryptJWE(token, pub.privKey); err != nil || string(got) != "hi" || header.Algorithm != KeyAlgorithmRSAOAEP256 {
+		t.Errorf("DecryptJWE = %q, %v, %v", got, header, err)
+	}
+}
+
+// https://tools.ietf.org/html/rfc7518#appendix-C
+func TestECDHESKey(t *testing.T) {
+	point := func(x, y, d string) *ecdsa.PrivateKey {
+		b := func(s string) *big.Int {
+			v, err := decodeBigInt(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		return &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: b(x), Y: b(y)}, D: b(d)}
+	}
+	alice := point("gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0",
+		"SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps", "0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo")
+	bob := point("weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ",
+		"e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck", "VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw")
+	header := &JWEHeader{Algorithm: KeyAlgorithmECDHES, Encryption: EncryptionA128GCM,
+		PartyUInfo: "QWxpY2U", PartyVInfo: "Qm9i"}
+
+	for _, pair := range [][2]*ecdsa.PrivateKey{{alice, bob}, {bob, alice}} {
+		key, err := ecdhesKey(pair[0], &pair[1].PublicKey, header, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := b64.EncodeToString(key); got != "VqqN6vgjbSBcIijNcacQGg" {
+			t.Errorf("ECDH-ES key = %s", got)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package jwt_
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// https://tools.ietf.org/html/rfc7518#section-6.1
+const (
+	KeyTypeEC  = "EC"
+	KeyTypeRSA = "RSA"
+	KeyTypeOct = "oct"
+	KeyTypeOKP = "OKP" // Octet Key Pair, RFC 8037
+)
+
+// CurveEd25519 is the "crv" of Ed25519 OKP keys.
+const CurveEd25519 = "Ed25519"
+
+// https://tools.ietf.org/html/rfc7517#section-4.2
+const (
+	KeyUseSignature  = "sig"
+	KeyUseEncryption = "enc"
+)
+
+var (
+	ErrUnsupportedKeyType = errors.New("jwt_: unsupported JWK key type")
+	ErrInvalidJWK         = errors.New("jwt_: invalid JWK")
+)
+
+// JSONWebKey is a JSON Web Key, RFC 7517, of an EC, RSA or symmetric key.
+// The members of the key material are base64url encoded, as on the wire.
+type JSONWebKey struct {
+	KeyType   string   `json:"kty"`
+	Use       string   `json:"use,omitempty"`
+	KeyOps    []string `json:"key_ops,omitempty"`
+	Algorithm string   `json:"alg,omitempty"`
+	KeyID     string   `json:"kid,omitempty"`
+
+	// EC, https://tools.ietf.org/html/rfc7518#section-6.2
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+
+	// RSA, https://tools.ietf.org/html/rfc7518#section-6.3
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// D is the private exponent of RSA keys, the private key of EC keys or
+	// the seed of OKP keys.
+	D string `json:"d,omitempty"`
+
+	// K is the value of symmetric keys, https://tools.ietf.org/html/rfc7518#section-6.4
+	K string `json:"k,omitempty"`
+}
+
+// JSONWebKeySet is a JWK Set, RFC 7517, section 5.
+type JSONWebKeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+// Key returns the keys of set of ID kid.
+func (set *JSONWebKeySet) Key(kid string) []*JSONWebKey {
+	var keys []*JSONWebKey
+	for _, k := range set.Keys {
+		if k.KeyID == kid {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+var b64 = base64.RawURLEncoding
+
+func encodeBigInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return b64.EncodeToString(b)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, ErrInvalidJWK
+	}
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidJWK
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func curveByName(crv string) (elliptic.Curve, string, bool) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), SigningMethodES256, true
+	case "P-384":
+		return elliptic.P384(), SigningMethodES384, true
+	case "P-521":
+		return elliptic.P521(), SigningMethodES512, true
+	}
+	return nil, "", false
+}
+
+func curveSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// JWK returns the JSON Web Key of a with ID kid. Private key material,
+// including the value of symmetric keys, is exported only if private is
+// true.
+func (a *AuthKey) JWK(kid string, private bool) (*JSONWebKey, error) {
+	jwk := &JSONWebKey{Use: KeyUseSignature, Algorithm: a.alg, KeyID: kid}
+	switch {
+	case a.IsRSAKey():
+		pub, ok := a.pubKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidJWK
+		}
+		jwk.KeyType = KeyTypeRSA
+		jwk.N = encodeBigInt(pub.N, 0)
+		jwk.E = encodeBigInt(big.NewInt(int64(pub.E)), 0)
+		if priv, ok := a.privKey.(*rsa.PrivateKey); ok && private {
+			priv.Precompute()
+			jwk.D = encodeBigInt(priv.D, 0)
+			if len(priv.Primes) == 2 {
+				jwk.P = encodeBigInt(priv.Primes[0], 0)
+				jwk.Q = encodeBigInt(priv.Primes[1], 0)
+				jwk.DP = encodeBigInt(priv.Precomputed.Dp, 0)
+				jwk.DQ = encodeBigInt(priv.Precomputed.Dq, 0)
+				jwk.QI = encodeBigInt(priv.Precomputed.Qinv, 0)
+			}
+		}
+	case a.IsECMAKey():
+		pub, ok := a.pubKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidJWK
+		}
+		size := curveSize(pub.Curve)
+		jwk.KeyType = KeyTypeEC
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = encodeBigInt(pub.X, size)
+		jwk.Y = encodeBigInt(pub.Y, size)
+		if priv, ok := a.privKey.(*ecdsa.PrivateKey); ok && private {
+			jwk.D = encodeBigInt(priv.D, size)
+		}
+	case a.IsEdDSAKey():
+		pub, ok := a.pubKey.(ed25519.PublicKey)
+		if !ok {
+			return nil, ErrInvalidJWK
+		}
+		jwk.KeyType = KeyTypeOKP
+		jwk.Curve = CurveEd25519
+		jwk.X = b64.EncodeToString(pub)
+		if priv, ok := a.privKey.(ed25519.PrivateKey); ok && private {
+			jwk.D = b64.EncodeToString(priv.Seed())
+		}
+	case a.alg == SigningMethodHS256 || a.alg == SigningMethodHS384 || a.alg == SigningMethodHS512:
+		if !private {
+			return nil, ErrUnsupportedKeyType
+		}
+		jwk.KeyType = KeyTypeOct
+		jwk.K = b64.EncodeToString(a.symmetricKey)
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+	return jwk, nil
+}
+
+// NewAuthKeyFromJWK returns the AuthKey of jwk. If jwk has no "alg", it is
+// RS256 for RSA keys, HS256 for symmetric keys, EdDSA for OKP keys, and
+// derived from the curve for EC keys.
+func NewAuthKeyFromJWK(jwk *JSONWebKey) (*AuthKey, error) {
+	a := &AuthKey{alg: jwk.Algorithm}
+	switch jwk.KeyType {
+	case KeyTypeRSA:
+		if a.alg == "" {
+			a.alg = SigningMethodRS256
+		}
+		if !a.IsRSAKey() {
+			return nil, fmt.Errorf("jwt_: alg %q of an RSA JWK", a.alg)
+		}
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrInvalidJWK
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		a.pubKey = pub
+		if jwk.D == "" {
+			return a, nil
+		}
+		priv := &rsa.PrivateKey{PublicKey: *pub}
+		if priv.D, err = decodeBigInt(jwk.D); err != nil {
+			return nil, err
+		}
+		p, err := decodeBigInt(jwk.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeBigInt(jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		priv.Primes = []*big.Int{p, q}
+		if err := priv.Validate(); err != nil {
+			return nil, err
+		}
+		priv.Precompute()
+		a.privKey = priv
+	case KeyTypeEC:
+		curve, alg, ok := curveByName(jwk.Curve)
+		if !ok {
+			return nil, fmt.Errorf("jwt_: unsupported JWK curve %q", jwk.Curve)
+		}
+		if a.alg == "" {
+			a.alg = alg
+		}
+		if a.alg != alg {
+			return nil, fmt.Errorf("jwt_: alg %q of a %s JWK", a.alg, jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, ErrInvalidJWK
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		a.pubKey = pub
+		if jwk.D == "" {
+			return a, nil
+		}
+		d, err := decodeBigInt(jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		a.privKey = &ecdsa.PrivateKey{PublicKey: *pub, D: d}
+	case KeyTypeOKP:
+		if jwk.Curve != CurveEd25519 {
+			return nil, fmt.Errorf("jwt_: unsupported JWK curve %q", jwk.Curve)
+		}
+		if a.alg == "" {
+			a.alg = SigningMethodEdDSA
+		}
+		if a.alg != SigningMethodEdDSA {
+			return nil, fmt.Errorf("jwt_: alg %q of an OKP JWK", a.alg)
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+		a.pubKey = ed25519.PublicKey(x)
+		if jwk.D == "" {
+			return a, nil
+		}
+		d, err := b64.DecodeString(jwk.D)
+		if err != nil || len(d) != ed25519.SeedSize {
+			return nil, ErrInvalidJWK
+		}
+		priv := ed25519.NewKeyFromSeed(d)
+		if !priv.Public().(ed25519.PublicKey).Equal(a.pubKey) {
+			return nil, ErrInvalidJWK
+		}
+		a.privKey = priv
+	case KeyTypeOct:
+		if a.alg == "" {
+			a.alg = SigningMethodHS256
+		}
+		switch a.alg {
+		case SigningMethodHS256, SigningMethodHS384, SigningMethodHS512:
+		default:
+			return nil, fmt.Errorf("jwt_: alg %q of a symmetric JWK", a.alg)
+		}
+		k, err := b64.DecodeString(jwk.K)
+		if err != nil || len(k) == 0 {
+			return nil, ErrInvalidJWK
+		}
+		a.symmetricKey = k
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+	return a, nil
+}
+
+// Thumbprint returns the JWK Thumbprint of jwk, RFC 7638, base64url
+// encoded, a key ID derived from its public key material.
+func (jwk *JSONWebKey) Thumbprint() (string, error) {
+	var members interface{}
+	switch jwk.KeyType {
+	case KeyTypeEC:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	case KeyTypeRSA:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case KeyTypeOKP:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	case KeyTypeOct:
+		members = struct {
+			K   string `json:"k"`
+			Kty string `json:"kty"`
+		}{jwk.K, jwk.KeyType}
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+	// the members are in lexicographic order, and need no escaping
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return b64.EncodeToString(sum[:]), nil
+}
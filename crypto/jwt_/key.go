@@ -3,6 +3,7 @@ package jwt_
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -66,6 +67,13 @@ func NewAuthKeyFromRandom(alg string) (*AuthKey, error) {
 		}
 		privKey = priv
 		pubKey = priv.Public()
+	case SigningMethodEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		privKey = priv
+		pubKey = pub
 	default:
 		return nil, fmt.Errorf("unsupport jwt.alg [%s]", alg)
 	}
@@ -99,7 +107,8 @@ func NewAuthKey(alg string, privateKey []byte, publicKey []byte, password ...str
 	case SigningMethodRS256, SigningMethodPS256,
 		SigningMethodRS384, SigningMethodPS384,
 		SigningMethodRS512, SigningMethodPS512,
-		SigningMethodES256, SigningMethodES384, SigningMethodES512:
+		SigningMethodES256, SigningMethodES384, SigningMethodES512,
+		SigningMethodEdDSA:
 		if len(privateKey) == 0 {
 			return authKey, lang.NewIllegalArgumentException1("privateKey is missing")
 		}
@@ -187,6 +196,14 @@ func (a *AuthKey) setPrivateKey(keyData []byte, passwords ...string) error {
 		a.privKey = privKey
 		a.pubKey = privKey.Public()
 		return nil
+	case SigningMethodEdDSA:
+		privKey, err := ParseEdPrivateKeyFromPEM(keyData, passwords...)
+		if err != nil {
+			return err
+		}
+		a.privKey = privKey
+		a.pubKey = privKey.Public()
+		return nil
 	}
 	return lang.NewIllegalArgumentException1(fmt.Sprintf("unsupport jwt.alg [%s]", a.alg))
 }
@@ -211,6 +228,13 @@ func (a *AuthKey) setPublicKey(keyData []byte) error {
 		}
 		a.pubKey = pubKey
 		return nil
+	case SigningMethodEdDSA:
+		pubKey, err := ParseEdPublicKeyFromPEM(keyData)
+		if err != nil {
+			return err
+		}
+		a.pubKey = pubKey
+		return nil
 	}
 	return lang.NewIllegalArgumentException1(fmt.Sprintf("unsupport jwt.alg [%s]", a.alg))
 }
@@ -240,11 +264,7 @@ func (a *AuthKey) GetSignedMethod() jwt.SigningMethod {
 }
 
 func (a *AuthKey) IsSymmetricKey() bool {
-	switch a.alg {
-	case SigningMethodRS256, SigningMethodRS384, SigningMethodRS512:
-		return false
-	}
-	return true
+	return !a.IsRSAKey() && !a.IsECMAKey() && !a.IsEdDSAKey()
 }
 
 func (a *AuthKey) IsRSAKey() bool {
@@ -263,3 +283,17 @@ func (a *AuthKey) IsECMAKey() bool {
 	}
 	return false
 }
+
+func (a *AuthKey) IsEdDSAKey() bool {
+	return a.alg == SigningMethodEdDSA
+}
+
+// SignedString returns the token of claims signed with a.
+func (a *AuthKey) SignedString(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.GetSignedMethod(), claims)
+	key, err := a.GetSignedKey(token)
+	if err != nil {
+		return "", err
+	}
+	return token.SignedString(key)
+}
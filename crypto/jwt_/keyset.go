@@ -0,0 +1,331 @@
+package jwt_
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// HeaderParameterKeyID is the "kid" header of the key a JWS is signed with.
+const HeaderParameterKeyID = "kid" // RFC 7515, 4.1.4
+
+// WellKnownJWKSPath is the path key sets are usually served at.
+const WellKnownJWKSPath = "/.well-known/jwks.json"
+
+// ContentTypeJWKSet is the media type of JWK Sets.
+const ContentTypeJWKSet = "application/jwk-set+json"
+
+var (
+	ErrKeyNotFound  = errors.New("jwt_: no key of the token kid")
+	ErrNoSigningKey = errors.New("jwt_: no signing key")
+)
+
+// KeySet holds AuthKeys by key ID: tokens are signed with its signing key,
+// with their "kid" header set to its ID, and verified with the key of their
+// "kid". Rotate replaces the signing key, the retired one remaining valid
+// for verification through a grace period.
+// A KeySet is safe for concurrent use.
+type KeySet struct {
+	// MaxAge is the max-age of the Cache-Control of the JWK Set served.
+	// If zero, no Cache-Control is sent.
+	MaxAge time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]*keySetEntry
+	signing string // kid of the signing key
+}
+
+type keySetEntry struct {
+	key     *AuthKey
+	added   time.Time
+	expires time.Time // zero if unlimited
+}
+
+func (e *keySetEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// NewKeySet returns a KeySet of keys by ID; none is the signing key.
+func NewKeySet(keys map[string]*AuthKey) *KeySet {
+	ks := &KeySet{keys: make(map[string]*keySetEntry)}
+	for kid, key := range keys {
+		ks.keys[kid] = &keySetEntry{key: key, added: time.Now()}
+	}
+	return ks
+}
+
+// ParseKeySet returns the KeySet of the JWK Set JSON data. The first key
+// with private key material, if any, is the signing key.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return NewKeySetFromJWKS(&set)
+}
+
+// NewKeySetFromJWKS returns the KeySet of set. Keys of unsupported types,
+// or used for encryption, are skipped. The first key with private key
+// material, if any, is the signing key.
+func NewKeySetFromJWKS(set *JSONWebKeySet) (*KeySet, error) {
+	ks := NewKeySet(nil)
+	for _, jwk := range set.Keys {
+		if jwk.Use == KeyUseEncryption {
+			continue
+		}
+		key, err := NewAuthKeyFromJWK(jwk)
+		if err == ErrUnsupportedKeyType {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt_: JWK %q: %v", jwk.KeyID, err)
+		}
+		if err := ks.Add(jwk.KeyID, key); err != nil {
+			return nil, err
+		}
+		if ks.signing == "" && (key.privKey != nil || key.symmetricKey != nil) {
+			ks.signing = jwk.KeyID
+		}
+	}
+	return ks, nil
+}
+
+// keyID returns kid, or the JWK Thumbprint of key if empty.
+func keyID(kid string, key *AuthKey) (string, error) {
+	if kid != "" {
+		return kid, nil
+	}
+	jwk, err := key.JWK("", true)
+	if err != nil {
+		return "", err
+	}
+	return jwk.Thumbprint()
+}
+
+// Add adds key of ID kid, for verification; if kid is empty, the JWK
+// Thumbprint of key is its ID. A key of the same ID is replaced.
+func (ks *KeySet) Add(kid string, key *AuthKey) error {
+	kid, err := keyID(kid, key)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.keys == nil {
+		ks.keys = make(map[string]*keySetEntry)
+	}
+	ks.keys[kid] = &keySetEntry{key: key, added: time.Now()}
+	return nil
+}
+
+// Remove removes the key of ID kid; it is no longer the signing key.
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	delete(ks.keys, kid)
+	if ks.signing == kid {
+		ks.signing = ""
+	}
+}
+
+// Get returns the key of ID kid, unless retired past its grace period.
+func (ks *KeySet) Get(kid string) (*AuthKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	e, ok := ks.keys[kid]
+	if !ok || e.expired(time.Now()) {
+		return nil, false
+	}
+	return e.key, true
+}
+
+// KeyIDs returns the IDs of the keys valid for verification, in the order
+// they were added.
+func (ks *KeySet) KeyIDs() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	now := time.Now()
+	var kids []string
+	for kid, e := range ks.keys {
+		if !e.expired(now) {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Slice(kids, func(i, j int) bool {
+		ei, ej := ks.keys[kids[i]], ks.keys[kids[j]]
+		if !ei.added.Equal(ej.added) {
+			return ei.added.Before(ej.added)
+		}
+		return kids[i] < kids[j]
+	})
+	return kids
+}
+
+// SetSigningKey makes the key of ID kid the signing key.
+func (ks *KeySet) SetSigningKey(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	e, ok := ks.keys[kid]
+	if !ok || e.expired(time.Now()) {
+		return ErrKeyNotFound
+	}
+	e.expires = time.Time{}
+	ks.signing = kid
+	return nil
+}
+
+// SigningKey returns the signing key and its ID.
+func (ks *KeySet) SigningKey() (string, *AuthKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	e, ok := ks.keys[ks.signing]
+	if !ok {
+		return "", nil, ErrNoSigningKey
+	}
+	return ks.signing, e.key, nil
+}
+
+// Rotate adds key of ID kid and makes it the signing key. The previous
+// signing key remains valid for verification for grace, then is removed.
+func (ks *KeySet) Rotate(kid string, key *AuthKey, grace time.Duration) error {
+	kid, err := keyID(kid, key)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.keys == nil {
+		ks.keys = make(map[string]*keySetEntry)
+	}
+	now := time.Now()
+	if old, ok := ks.keys[ks.signing]; ok && ks.signing != kid {
+		old.expires = now.Add(grace)
+	}
+	ks.keys[kid] = &keySetEntry{key: key, added: now}
+	ks.signing = kid
+	for kid, e := range ks.keys {
+		if e.expired(now) {
+			delete(ks.keys, kid)
+		}
+	}
+	return nil
+}
+
+// RotateEvery rotates the signing key every interval, to the keys
+// generate returns, with a grace period of grace, until ctx is done or
+// generate fails. It returns the error of generate or of ctx.
+func (ks *KeySet) RotateEvery(ctx context.Context, interval, grace time.Duration,
+	generate func() (kid string, key *AuthKey, err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		kid, key, err := generate()
+		if err != nil {
+			return err
+		}
+		if err := ks.Rotate(kid, key, grace); err != nil {
+			return err
+		}
+	}
+}
+
+// GetVerifiedKey returns the key to verify token with, a jwt.Keyfunc: the
+// key of its "kid" header, or the only key of ks if it has none.
+func (ks *KeySet) GetVerifiedKey(token *jwt.Token) (interface{}, error) {
+	key, err := ks.verifyingKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return key.GetVerifiedKey(token)
+}
+
+func (ks *KeySet) verifyingKey(token *jwt.Token) (*AuthKey, error) {
+	if token != nil {
+		if kid, ok := token.Header[HeaderParameterKeyID].(string); ok {
+			key, ok := ks.Get(kid)
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+			return key, nil
+		}
+	}
+	kids := ks.KeyIDs()
+	if len(kids) != 1 {
+		return nil, ErrKeyNotFound
+	}
+	key, ok := ks.Get(kids[0])
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// SignedString returns the token of claims signed with the signing key,
+// its "kid" header set.
+func (ks *KeySet) SignedString(claims jwt.Claims) (string, error) {
+	kid, key, err := ks.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.GetSignedMethod(), claims)
+	token.Header[HeaderParameterKeyID] = kid
+	signedKey, err := key.GetSignedKey(token)
+	if err != nil {
+		return "", err
+	}
+	return token.SignedString(signedKey)
+}
+
+// JWKS returns the JWK Set of the public keys of ks valid for
+// verification; symmetric keys are left out.
+func (ks *KeySet) JWKS() *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []*JSONWebKey{}}
+	for _, kid := range ks.KeyIDs() {
+		key, ok := ks.Get(kid)
+		if !ok || key.IsSymmetricKey() {
+			continue
+		}
+		if jwk, err := key.JWK(kid, false); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// MarshalJSON returns the JWK Set of the public keys of ks.
+func (ks *KeySet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ks.JWKS())
+}
+
+// ServeHTTP serves the JWK Set of the public keys of ks, usually at
+// WellKnownJWKSPath.
+func (ks *KeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := ks.MarshalJSON()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeJWKSet)
+	if ks.MaxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(ks.MaxAge/time.Second)))
+	}
+	w.Write(b)
+}
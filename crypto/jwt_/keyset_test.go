@@ -0,0 +1,125 @@
+package jwt_
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, alg := range []string{SigningMethodRS256, SigningMethodPS384, SigningMethodES256,
+		SigningMethodES512, SigningMethodHS256, SigningMethodEdDSA} {
+		key, err := NewAuthKeyFromRandom(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk, err := key.JWK("k1", true)
+		if err != nil {
+			t.Fatalf("%s: JWK: %v", alg, err)
+		}
+		b, err := json.Marshal(jwk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded JSONWebKey
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewAuthKeyFromJWK(&decoded)
+		if err != nil {
+			t.Fatalf("%s: NewAuthKeyFromJWK: %v", alg, err)
+		}
+
+		// a token signed by the original verifies with the imported key, and back
+		for _, pair := range [][2]*AuthKey{{key, got}, {got, key}} {
+			ks := NewKeySet(map[string]*AuthKey{"k1": pair[0]})
+			ks.SetSigningKey("k1")
+			s, err := ks.SignedString(jwt.MapClaims{"sub": "alice"})
+			if err != nil {
+				t.Fatalf("%s: SignedString: %v", alg, err)
+			}
+			if _, err := jwt.Parse(s, NewKeySet(map[string]*AuthKey{"k1": pair[1]}).GetVerifiedKey); err != nil {
+				t.Errorf("%s: Parse: %v", alg, err)
+			}
+		}
+	}
+}
+
+// https://tools.ietf.org/html/rfc7638#section-3.1
+func TestThumbprint(t *testing.T) {
+	jwk := &JSONWebKey{
+		KeyType: KeyTypeRSA,
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+			"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2Q" +
+			"vzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQF" +
+			"h6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+	got, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint = %s, want %s", got, want)
+	}
+}
+
+func TestKeySetRotate(t *testing.T) {
+	k1, _ := NewAuthKeyFromRandom(SigningMethodES256)
+	k2, _ := NewAuthKeyFromRandom(SigningMethodRS256)
+	ks := NewKeySet(nil)
+	if err := ks.Rotate("k1", k1, 0); err != nil {
+		t.Fatal(err)
+	}
+	old, err := ks.SignedString(jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Rotate("k2", k2, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if kid, _, _ := ks.SigningKey(); kid != "k2" {
+		t.Errorf("signing key %q, want k2", kid)
+	}
+	s, err := ks.SignedString(jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{old, s} {
+		if _, err := jwt.Parse(s, ks.GetVerifiedKey); err != nil {
+			t.Errorf("Parse within the grace period: %v", err)
+		}
+	}
+
+	// the JWKS served has both public keys, imported as a verifying set
+	rec := httptest.NewRecorder()
+	ks.ServeHTTP(rec, httptest.NewRequest("GET", WellKnownJWKSPath, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeJWKSet {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	remote, err := ParseKeySet(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kids := remote.KeyIDs(); len(kids) != 2 || kids[0] != "k1" && kids[1] != "k1" {
+		t.Errorf("KeyIDs of the JWKS = %v", kids)
+	}
+	if _, _, err := remote.SigningKey(); err != ErrNoSigningKey {
+		t.Errorf("SigningKey of a public JWKS = %v", err)
+	}
+	if _, err := jwt.Parse(old, remote.GetVerifiedKey); err != nil {
+		t.Errorf("Parse with the JWKS: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := jwt.Parse(old, ks.GetVerifiedKey); err == nil {
+		t.Error("Parse after the grace period succeeded")
+	}
+	if _, err := jwt.Parse(s, ks.GetVerifiedKey); err != nil {
+		t.Errorf("Parse with the signing key: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package jwt_
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var ErrNoToken = errors.New("jwt_: no bearer token")
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims of the token validated for the
+// request of ctx, or nil.
+func ClaimsFromContext(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims
+}
+
+// WithClaims returns a copy of ctx carrying claims.
+func WithClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// BearerToken returns the token of the "Authorization: Bearer" header of r.
+// https://tools.ietf.org/html/rfc6750#section-2.1
+func BearerToken(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", ErrNoToken
+	}
+	return strings.TrimSpace(auth[len(prefix):]), nil
+}
+
+// Middleware validates the bearer tokens of the requests to h, with
+// BearerToken, and puts their claims in the context of the requests, see
+// ClaimsFromContext. Requests without a valid token are answered 401
+// Unauthorized, with a WWW-Authenticate challenge.
+func (v *Validator) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := BearerToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		claims, err := v.Validate(token)
+		if err != nil {
+			// https://tools.ietf.org/html/rfc6750#section-3
+			desc := strings.NewReplacer(`"`, `'`, `\`, `/`).Replace(err.Error())
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+desc+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
@@ -15,4 +15,5 @@ const (
 	SigningMethodES256 = "ES256" // ES256: ECDSA using P-256 and SHA-256
 	SigningMethodES384 = "ES384" // ES384: ECDSA using P-384 and SHA-384
 	SigningMethodES512 = "ES512" // ES512: ECDSA using P-521 and SHA-512
+	SigningMethodEdDSA = "EdDSA" // EdDSA: EdDSA using Ed25519, RFC 8037
 )
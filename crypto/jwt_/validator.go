@@ -0,0 +1,193 @@
+package jwt_
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrTokenExpired        = errors.New("jwt_: token is expired")
+	ErrTokenNotValidYet    = errors.New("jwt_: token is not valid yet")
+	ErrTokenIssuedInFuture = errors.New("jwt_: token is issued in the future")
+	ErrInvalidIssuer       = errors.New("jwt_: invalid issuer")
+	ErrInvalidAudience     = errors.New("jwt_: invalid audience")
+	ErrAlgNone             = errors.New("jwt_: unsigned token")
+	ErrInvalidClaim        = errors.New("jwt_: invalid registered claim")
+)
+
+// MissingClaimError is the error of tokens missing a required claim.
+type MissingClaimError struct {
+	Claim string
+}
+
+func (e *MissingClaimError) Error() string {
+	return fmt.Sprintf("jwt_: missing claim %q", e.Claim)
+}
+
+// Validator parses tokens and validates their registered claims.
+type Validator struct {
+	// Keyfunc returns the key to verify a token with, such as the
+	// GetVerifiedKey of an AuthKey or a KeySet. Required.
+	Keyfunc jwt.Keyfunc
+	// Methods are the "alg" accepted. If empty, any is but "none".
+	Methods []string
+	// AllowNone accepts unsigned tokens, of "alg" "none". Beware.
+	AllowNone bool
+
+	// Issuer is the "iss" required, if not empty.
+	Issuer string
+	// Audience, if not empty, requires the "aud" of tokens to have one of
+	// its elements.
+	Audience []string
+	// RequiredClaims are claims tokens must have, such as "exp" or "sub".
+	RequiredClaims []string
+	// Leeway is the clock skew tolerated on "exp", "nbf" and "iat".
+	Leeway time.Duration
+	// Now returns the time tokens are validated at. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+func (v *Validator) keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodNone {
+		if !v.AllowNone {
+			return nil, ErrAlgNone
+		}
+		return jwt.UnsafeAllowNoneSignatureType, nil
+	}
+	if v.Keyfunc == nil {
+		return nil, ErrKeyNotFound
+	}
+	return v.Keyfunc(token)
+}
+
+// Validate parses and verifies the token tokenString, validates its
+// claims, and returns them.
+func (v *Validator) Validate(tokenString string) (jwt.MapClaims, error) {
+	methods := v.Methods
+	if len(methods) > 0 && v.AllowNone {
+		methods = append(methods[:len(methods):len(methods)], SigningMethodNone)
+	}
+	parser := &jwt.Parser{ValidMethods: methods, UseJSONNumber: true, SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(tokenString, jwt.MapClaims{}, v.keyfunc)
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok && ve.Inner != nil {
+			return nil, ve.Inner
+		}
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if err := v.ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ValidateClaims validates claims against the policy of v.
+func (v *Validator) ValidateClaims(claims jwt.MapClaims) error {
+	for _, name := range v.RequiredClaims {
+		if _, ok := claims[name]; !ok {
+			return &MissingClaimError{Claim: name}
+		}
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	t := now()
+	if exp, ok, err := numericDate(claims, ClaimsExpirationTime); err != nil {
+		return err
+	} else if ok && !t.Before(exp.Add(v.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok, err := numericDate(claims, ClaimsNotBefore); err != nil {
+		return err
+	} else if ok && t.Add(v.Leeway).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+	if iat, ok, err := numericDate(claims, ClaimsIssuedAt); err != nil {
+		return err
+	} else if ok && t.Add(v.Leeway).Before(iat) {
+		return ErrTokenIssuedInFuture
+	}
+
+	if v.Issuer != "" {
+		if iss, _ := claims[ClaimsIssuer].(string); iss != v.Issuer {
+			return ErrInvalidIssuer
+		}
+	}
+	if len(v.Audience) > 0 {
+		aud, err := audience(claims)
+		if err != nil {
+			return err
+		}
+		if !intersects(aud, v.Audience) {
+			return ErrInvalidAudience
+		}
+	}
+	return nil
+}
+
+// numericDate returns the NumericDate claim name of claims, if any.
+// https://tools.ietf.org/html/rfc7519#section-2
+func numericDate(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	var secs float64
+	switch v := claims[name].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case float64:
+		secs = v
+	case int64:
+		secs = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false, ErrInvalidClaim
+		}
+		secs = f
+	default:
+		return time.Time{}, false, ErrInvalidClaim
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)), true, nil
+}
+
+// audience returns the "aud" of claims, a string or an array of strings.
+// https://tools.ietf.org/html/rfc7519#section-4.1.3
+func audience(claims jwt.MapClaims) ([]string, error) {
+	switch aud := claims[ClaimsAudience].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{aud}, nil
+	case []string:
+		return aud, nil
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, ErrInvalidClaim
+			}
+			auds = append(auds, s)
+		}
+		return auds, nil
+	}
+	return nil, ErrInvalidClaim
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
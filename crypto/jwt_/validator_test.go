@@ -0,0 +1,102 @@
+package jwt_
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestValidator(t *testing.T) {
+	key, err := NewAuthKeyFromRandom(SigningMethodES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	iss := &Issuer{Signer: key, Issuer: "https://issuer", Audience: []string{"api", "web"},
+		TTL: time.Hour, Now: func() time.Time { return now }}
+	v := &Validator{Keyfunc: key.GetVerifiedKey, Issuer: "https://issuer", Audience: []string{"api"},
+		RequiredClaims: []string{ClaimsSubject, "scope"}, Leeway: time.Minute}
+	at := func(t time.Time) func() time.Time { return func() time.Time { return t } }
+
+	good, err := iss.Issue("alice", map[string]interface{}{"scope": "read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noScope, _ := iss.Issue("alice", nil)
+	other, _ := (&Issuer{Signer: key, Issuer: "https://other", Audience: []string{"api"}, Now: iss.Now}).Issue("alice", map[string]interface{}{"scope": "read"})
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "alice", "scope": "read"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		token string
+		now   time.Time
+		err   error
+	}{
+		{good, now, nil},
+		{good, now.Add(time.Hour + 30*time.Second), nil}, // within the leeway
+		{good, now.Add(time.Hour + 2*time.Minute), ErrTokenExpired},
+		{good, now.Add(-2 * time.Minute), ErrTokenNotValidYet},
+		{other, now, ErrInvalidIssuer},
+		{none, now, ErrAlgNone},
+	}
+	for i, tt := range tests {
+		v.Now = at(tt.now)
+		_, err := v.Validate(tt.token)
+		if err != tt.err {
+			t.Errorf("#%d: Validate = %v, want %v", i, err, tt.err)
+		}
+	}
+
+	v.Now = at(now)
+	if _, err := v.Validate(noScope); err == nil || err.(*MissingClaimError).Claim != "scope" {
+		t.Errorf("Validate without scope = %v", err)
+	}
+	claims, err := v.Validate(good)
+	if err != nil || claims[ClaimsSubject] != "alice" {
+		t.Errorf("Validate = %v, %v", claims, err)
+	}
+	v.Audience = []string{"mobile"}
+	if _, err := v.Validate(good); err != ErrInvalidAudience {
+		t.Errorf("Validate for another audience = %v", err)
+	}
+}
+
+func TestValidatorMiddleware(t *testing.T) {
+	key, _ := NewAuthKeyFromRandom(SigningMethodHS256)
+	token, err := (&Issuer{Signer: key, TTL: time.Minute}).Issue("alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Validator{Keyfunc: key.GetVerifiedKey, Methods: []string{SigningMethodHS256}}
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClaimsFromContext(r.Context())[ClaimsSubject].(string)))
+	}))
+
+	for _, tt := range []struct {
+		auth   string
+		code   int
+		body   string
+		header string
+	}{
+		{"Bearer " + token, http.StatusOK, "alice", ""},
+		{"", http.StatusUnauthorized, "", "Bearer"},
+		{"Bearer " + token + "x", http.StatusUnauthorized, "", `Bearer error="invalid_token"`},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code || tt.code == http.StatusOK && rec.Body.String() != tt.body {
+			t.Errorf("%q: %d %q, want %d %q", tt.auth, rec.Code, rec.Body, tt.code, tt.body)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, tt.header) {
+			t.Errorf("%q: WWW-Authenticate %q, want %q", tt.auth, got, tt.header)
+		}
+	}
+}
@@ -1,2 +1,9 @@
 // package rand_ Creating Random Strings in Go
+//
+// Rand generates random bytes, integers in a range, permutations, samples,
+// weighted choices, strings of a charset, tokens and UUIDv4, UUIDv7 and ULID
+// identifiers, without modulo bias. Crypto and the package functions of the
+// same names use crypto/rand; NewMath returns a seeded, reproducible Rand.
+// String, Bytes and StringWithCharset fall back to math/rand if crypto/rand
+// fails; use Crypto for secrets.
 package rand_
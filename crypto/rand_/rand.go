@@ -0,0 +1,348 @@
+package rand_
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Rand generates random values from a source of random bytes, without
+// modulo bias: integers in a range and characters of a charset are drawn by
+// rejection sampling.
+// Rand panics if its source fails, as crypto/rand may only on a broken
+// system.
+type Rand struct {
+	src io.Reader
+}
+
+// New returns a Rand of the random bytes of src, safe for concurrent use if
+// src is.
+func New(src io.Reader) *Rand {
+	return &Rand{src: src}
+}
+
+// Crypto is a Rand of crypto/rand, for secrets, tokens and IDs.
+var Crypto = New(rand.Reader)
+
+// NewMath returns a Rand of a math/rand source seeded with seed, not
+// secure but reproducible: Rands of the same seed generate the same values,
+// for tests and simulations.
+func NewMath(seed int64) *Rand {
+	return New(&lockedSource{r: mrand.New(mrand.NewSource(seed))})
+}
+
+// lockedSource makes a math/rand.Rand safe for concurrent use.
+type lockedSource struct {
+	mu sync.Mutex
+	r  *mrand.Rand
+}
+
+func (s *lockedSource) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
+// Read fills p with random bytes.
+func (r *Rand) Read(p []byte) (int, error) {
+	return io.ReadFull(r.src, p)
+}
+
+func (r *Rand) fill(p []byte) {
+	if _, err := r.Read(p); err != nil {
+		panic("rand_: source failed: " + err.Error())
+	}
+}
+
+// Bytes returns n random bytes.
+func (r *Rand) Bytes(n int) []byte {
+	b := make([]byte, n)
+	r.fill(b)
+	return b
+}
+
+// Uint64 returns a random uint64.
+func (r *Rand) Uint64() uint64 {
+	var b [8]byte
+	r.fill(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// Uint64n returns a random uint64 in [0, n). It panics if n == 0.
+func (r *Rand) Uint64n(n uint64) uint64 {
+	if n == 0 {
+		panic("rand_: invalid argument to Uint64n")
+	}
+	if n&(n-1) == 0 { // power of two
+		return r.Uint64() & (n - 1)
+	}
+	// reject the values below 2^64 % n, so that all the remainders are
+	// equally likely
+	threshold := -n % n
+	for {
+		if v := r.Uint64(); v >= threshold {
+			return v % n
+		}
+	}
+}
+
+// Intn returns a random int in [0, n). It panics if n <= 0.
+func (r *Rand) Intn(n int) int {
+	if n <= 0 {
+		panic("rand_: invalid argument to Intn")
+	}
+	return int(r.Uint64n(uint64(n)))
+}
+
+// Int63n returns a random int64 in [0, n). It panics if n <= 0.
+func (r *Rand) Int63n(n int64) int64 {
+	if n <= 0 {
+		panic("rand_: invalid argument to Int63n")
+	}
+	return int64(r.Uint64n(uint64(n)))
+}
+
+// IntRange returns a random int in [min, max). It panics if max <= min.
+func (r *Rand) IntRange(min, max int) int {
+	if max <= min {
+		panic("rand_: invalid argument to IntRange")
+	}
+	// the span may overflow int, not uint64
+	return min + int(r.Uint64n(uint64(max)-uint64(min)))
+}
+
+// Float64 returns a random float64 in [0.0, 1.0).
+func (r *Rand) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Shuffle shuffles the n elements swapped by swap, Fisher–Yates.
+func (r *Rand) Shuffle(n int, swap func(i, j int)) {
+	if n < 0 {
+		panic("rand_: invalid argument to Shuffle")
+	}
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
+
+// Perm returns a random permutation of [0, n).
+func (r *Rand) Perm(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	r.Shuffle(n, func(i, j int) { p[i], p[j] = p[j], p[i] })
+	return p
+}
+
+// Sample returns k distinct random ints of [0, n), in random order,
+// in O(k). It panics if k > n or k < 0.
+func (r *Rand) Sample(n, k int) []int {
+	if k < 0 || k > n {
+		panic("rand_: invalid argument to Sample")
+	}
+	// a partial Fisher–Yates shuffle of [0, n), of the moved elements only
+	moved := make(map[int]int, k)
+	at := func(i int) int {
+		if v, ok := moved[i]; ok {
+			return v
+		}
+		return i
+	}
+	s := make([]int, k)
+	for i := range s {
+		j := i + r.Intn(n-i)
+		s[i] = at(j)
+		moved[j] = at(i)
+	}
+	return s
+}
+
+// WeightedChoice returns a random index of weights, with a probability
+// proportional to its weight, or -1 if no weight is positive.
+// Negative and NaN weights count as zero.
+func (r *Rand) WeightedChoice(weights []float64) int {
+	var total float64
+	last := -1
+	for i, w := range weights {
+		if w > 0 && !math.IsInf(w, 1) {
+			total += w
+			last = i
+		}
+	}
+	if last < 0 {
+		return -1
+	}
+	x := r.Float64() * total
+	for i, w := range weights {
+		if w > 0 && !math.IsInf(w, 1) {
+			if x < w {
+				return i
+			}
+			x -= w
+		}
+	}
+	// rounding errors
+	return last
+}
+
+// StringWithCharset returns a random string of n bytes of charset, each
+// equally likely. It panics if charset is empty.
+func (r *Rand) StringWithCharset(n int, charset string) string {
+	if len(charset) == 0 {
+		panic("rand_: empty charset")
+	}
+	b := make([]byte, n)
+	if len(charset) > 256 {
+		for i := range b {
+			b[i] = charset[r.Intn(len(charset))]
+		}
+		return string(b)
+	}
+
+	// reject the bytes above the largest multiple of len(charset)
+	limit := 256 - 256%len(charset)
+	buf := make([]byte, n+n/4+1)
+	for i := 0; i < n; {
+		r.fill(buf)
+		for _, c := range buf {
+			if int(c) >= limit {
+				continue
+			}
+			b[i] = charset[int(c)%len(charset)]
+			if i++; i == n {
+				break
+			}
+		}
+	}
+	return string(b)
+}
+
+// Hex returns n random bytes hex encoded, 2n characters.
+func (r *Rand) Hex(n int) string {
+	return hex.EncodeToString(r.Bytes(n))
+}
+
+// Base32 returns n random bytes in unpadded base32, RFC 4648.
+func (r *Rand) Base32(n int) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(r.Bytes(n))
+}
+
+// Base64URL returns n random bytes in unpadded base64url, RFC 4648,
+// safe in URLs and file names.
+func (r *Rand) Base64URL(n int) string {
+	return base64.RawURLEncoding.EncodeToString(r.Bytes(n))
+}
+
+// UUIDv4 returns a random UUID, version 4, RFC 4122.
+func (r *Rand) UUIDv4() string {
+	var u [16]byte
+	r.fill(u[:])
+	return formatUUID(u, 4)
+}
+
+// UUIDv7 returns a UUID of version 7, RFC 9562: the Unix time in
+// milliseconds of now, then random bits. UUIDs of different milliseconds
+// sort by time.
+func (r *Rand) UUIDv7() string {
+	var u [16]byte
+	r.fill(u[6:])
+	putUnixMilli(u[:6], time.Now())
+	return formatUUID(u, 7)
+}
+
+func formatUUID(u [16]byte, version byte) string {
+	u[6] = u[6]&0x0f | version<<4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:])
+}
+
+// putUnixMilli puts the 48 bits Unix time in milliseconds of t in b,
+// big endian.
+func putUnixMilli(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// crockford is the Crockford's base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a ULID, https://github.com/ulid/spec: the Unix time in
+// milliseconds of now and 80 random bits, in 26 characters of Crockford's
+// base32. ULIDs of different milliseconds sort by time, as strings too.
+func (r *Rand) ULID() string {
+	var u [16]byte
+	putUnixMilli(u[:6], time.Now())
+	r.fill(u[6:])
+
+	// 128 bits in 26 characters of 5 bits, the first one of 3 bits
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// Intn returns a random int in [0, n) of Crypto.
+func Intn(n int) int { return Crypto.Intn(n) }
+
+// IntRange returns a random int in [min, max) of Crypto.
+func IntRange(min, max int) int { return Crypto.IntRange(min, max) }
+
+// Float64 returns a random float64 in [0.0, 1.0) of Crypto.
+func Float64() float64 { return Crypto.Float64() }
+
+// Shuffle shuffles the n elements swapped by swap with Crypto.
+func Shuffle(n int, swap func(i, j int)) { Crypto.Shuffle(n, swap) }
+
+// Perm returns a random permutation of [0, n) of Crypto.
+func Perm(n int) []int { return Crypto.Perm(n) }
+
+// Sample returns k distinct random ints of [0, n) of Crypto.
+func Sample(n, k int) []int { return Crypto.Sample(n, k) }
+
+// WeightedChoice returns a random index of weights of Crypto, see
+// Rand.WeightedChoice.
+func WeightedChoice(weights []float64) int { return Crypto.WeightedChoice(weights) }
+
+// Hex returns n random bytes of Crypto hex encoded.
+func Hex(n int) string { return Crypto.Hex(n) }
+
+// Base32 returns n random bytes of Crypto in unpadded base32.
+func Base32(n int) string { return Crypto.Base32(n) }
+
+// Base64URL returns n random bytes of Crypto in unpadded base64url.
+func Base64URL(n int) string { return Crypto.Base64URL(n) }
+
+// UUIDv4 returns a random UUID, version 4, of Crypto.
+func UUIDv4() string { return Crypto.UUIDv4() }
+
+// UUIDv7 returns a UUID of version 7 of Crypto, see Rand.UUIDv7.
+func UUIDv7() string { return Crypto.UUIDv7() }
+
+// ULID returns a ULID of Crypto, see Rand.ULID.
+func ULID() string { return Crypto.ULID() }
@@ -0,0 +1,95 @@
+package rand_
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewMathReproducible(t *testing.T) {
+	a, b := NewMath(42), NewMath(42)
+	if x, y := a.StringWithCharset(32, CharsetAlphaNum), b.StringWithCharset(32, CharsetAlphaNum); x != y {
+		t.Errorf("same seed, strings %q and %q", x, y)
+	}
+	if x, y := a.Perm(10), b.Perm(10); !equalInts(x, y) {
+		t.Errorf("same seed, permutations %v and %v", x, y)
+	}
+}
+
+func TestUnbiased(t *testing.T) {
+	r := NewMath(1)
+	const n, draws = 3, 30000
+	var counts [n]int
+	for _, c := range r.StringWithCharset(draws, "abc") {
+		counts[c-'a']++
+	}
+	for i, c := range counts {
+		// within 6 standard deviations
+		if c < draws/n-500 || c > draws/n+500 {
+			t.Errorf("charset byte %d drawn %d times of %d", i, c, draws)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if v := r.IntRange(-5, 5); v < -5 || v >= 5 {
+			t.Fatalf("IntRange(-5, 5) = %d", v)
+		}
+	}
+	if v := r.WeightedChoice([]float64{0, -1, 2}); v != 2 {
+		t.Errorf("WeightedChoice of a single positive weight = %d", v)
+	}
+	if v := r.WeightedChoice([]float64{0, 0}); v != -1 {
+		t.Errorf("WeightedChoice of no positive weight = %d", v)
+	}
+}
+
+func TestSample(t *testing.T) {
+	s := Sample(1000, 50)
+	sort.Ints(s)
+	for i, v := range s {
+		if v < 0 || v >= 1000 || (i > 0 && v == s[i-1]) {
+			t.Fatalf("Sample(1000, 50) = %v", s)
+		}
+	}
+	if s := Sample(5, 5); len(s) != 5 {
+		t.Errorf("Sample(5, 5) = %v", s)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		re   string
+	}{
+		{"UUIDv4", UUIDv4(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"UUIDv7", UUIDv7(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"ULID", ULID(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"Hex", Hex(16), `^[0-9a-f]{32}$`},
+		{"Base32", Base32(5), `^[A-Z2-7]{8}$`},
+		{"Base64URL", Base64URL(3), `^[A-Za-z0-9_-]{4}$`},
+	}
+	for _, tt := range tests {
+		if !regexp.MustCompile(tt.re).MatchString(tt.id) {
+			t.Errorf("%s = %q, want %s", tt.name, tt.id, tt.re)
+		}
+	}
+
+	first := ULID()
+	time.Sleep(2 * time.Millisecond)
+	if second := ULID(); second <= first {
+		t.Errorf("ULID %q not after %q", second, first)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
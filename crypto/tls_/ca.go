@@ -0,0 +1,319 @@
+package tls_
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCAValidity is the validity of the CAs created without one.
+	DefaultCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultLeafValidity is the validity of the leaves issued without one.
+	DefaultLeafValidity = 90 * 24 * time.Hour
+
+	// certificateBackdate is subtracted from NotBefore, for clock skew.
+	certificateBackdate = 5 * time.Minute
+)
+
+// CertificateAuthority is a small certificate authority, for the mTLS of
+// tests and staging environments: a root, or an intermediate signed by
+// another CertificateAuthority, issuing server and client certificates.
+type CertificateAuthority struct {
+	// Certificate is the certificate of the CA.
+	Certificate *x509.Certificate
+	// Key is the private key of Certificate.
+	Key crypto.Signer
+	// Intermediates are the certificates from the one that signed
+	// Certificate to the one signed by the root, if Certificate is not a
+	// root.
+	Intermediates []*x509.Certificate
+}
+
+// LeafOptions are the options of a leaf certificate.
+type LeafOptions struct {
+	// CommonName is the CN of the subject.
+	CommonName string
+	// Organizations are the O of the subject.
+	Organizations []string
+	// DNSNames, IPAddresses and URIs are the SANs, such as the SPIFFE ID
+	// of a workload.
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+	// Server and Client set the server and client auth extended key usages.
+	Server bool
+	Client bool
+	// Validity is the validity of the certificate. If zero,
+	// DefaultLeafValidity is used, bounded by the validity of the CA.
+	Validity time.Duration
+	// Key is the private key of the certificate. If nil, an ECDSA P-256
+	// key is generated.
+	Key crypto.Signer
+}
+
+// SANs sets the DNSNames, IPAddresses and URIs of opts from names, such as
+// "localhost", "127.0.0.1" or "spiffe://example.org/workload".
+func (opts *LeafOptions) SANs(names ...string) error {
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			opts.IPAddresses = append(opts.IPAddresses, ip)
+			continue
+		}
+		if strings.Contains(name, "://") {
+			u, err := url.Parse(name)
+			if err != nil {
+				return errors.Wrapf(err, "invalid URI SAN %q", name)
+			}
+			opts.URIs = append(opts.URIs, u)
+			continue
+		}
+		opts.DNSNames = append(opts.DNSNames, name)
+	}
+	return nil
+}
+
+// SPIFFEID returns the SPIFFE ID of the workload at path in trustDomain,
+// "spiffe://trustDomain/path".
+func SPIFFEID(trustDomain, path string) *url.URL {
+	return &url.URL{Scheme: "spiffe", Host: trustDomain, Path: "/" + strings.TrimPrefix(path, "/")}
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, errors.Errorf("failed to generate serial number: %s", err)
+	}
+	return serialNumber, nil
+}
+
+func newKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// NewRootCA returns a new root CertificateAuthority, of an ECDSA P-256 key.
+// If validity is zero, DefaultCAValidity is used.
+func NewRootCA(commonName string, organizations []string, validity time.Duration) (*CertificateAuthority, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	template, err := caTemplate(commonName, organizations, validity)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := createCertificate(template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateAuthority{Certificate: cert, Key: key}, nil
+}
+
+func caTemplate(commonName string, organizations []string, validity time.Duration) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	if validity == 0 {
+		validity = DefaultCAValidity
+	}
+	now := time.Now().UTC()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: organizations, CommonName: commonName},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, errors.Errorf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse certificate: %s", err)
+	}
+	return cert, nil
+}
+
+// notAfter returns now + validity, bounded by the validity of ca.
+func (ca *CertificateAuthority) notAfter(now time.Time, validity time.Duration) time.Time {
+	t := now.Add(validity)
+	if t.After(ca.Certificate.NotAfter) {
+		return ca.Certificate.NotAfter
+	}
+	return t
+}
+
+// NewIntermediate returns a new CertificateAuthority signed by ca, of an
+// ECDSA P-256 key. If validity is zero, DefaultCAValidity is used, bounded
+// by the validity of ca.
+func (ca *CertificateAuthority) NewIntermediate(commonName string, validity time.Duration) (*CertificateAuthority, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	template, err := caTemplate(commonName, ca.Certificate.Subject.Organization, validity)
+	if err != nil {
+		return nil, err
+	}
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+	cert, err := createCertificate(template, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	intermediates := []*x509.Certificate{}
+	if !ca.IsRoot() {
+		intermediates = append(intermediates, ca.Certificate)
+		intermediates = append(intermediates, ca.Intermediates...)
+	}
+	return &CertificateAuthority{Certificate: cert, Key: key, Intermediates: intermediates}, nil
+}
+
+// IsRoot reports whether ca is a root CA, self-signed.
+func (ca *CertificateAuthority) IsRoot() bool {
+	return ca.Certificate.CheckSignatureFrom(ca.Certificate) == nil
+}
+
+// Issue issues a leaf certificate of opts, with its chain up to, but
+// excluding, the root.
+func (ca *CertificateAuthority) Issue(opts LeafOptions) (*tls.Certificate, error) {
+	key := opts.Key
+	if key == nil {
+		var err error
+		if key, err = newKey(); err != nil {
+			return nil, err
+		}
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultLeafValidity
+	}
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: opts.Organizations, CommonName: opts.CommonName},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              ca.notAfter(now, validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		DNSNames:              opts.DNSNames,
+		IPAddresses:           opts.IPAddresses,
+		URIs:                  opts.URIs,
+	}
+	if _, ok := key.Public().(*ecdsa.PublicKey); !ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if opts.Server {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if opts.Client {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	cert, err := createCertificate(template, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := [][]byte{cert.Raw}
+	if !ca.IsRoot() {
+		chain = append(chain, ca.Certificate.Raw)
+		for _, c := range ca.Intermediates {
+			chain = append(chain, c.Raw)
+		}
+	}
+	return &tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: cert}, nil
+}
+
+// IssueServer issues a server certificate for names, see LeafOptions.SANs;
+// its CN is the first name.
+func (ca *CertificateAuthority) IssueServer(names ...string) (*tls.Certificate, error) {
+	opts := LeafOptions{Server: true}
+	if len(names) > 0 {
+		opts.CommonName = names[0]
+	}
+	if err := opts.SANs(names...); err != nil {
+		return nil, err
+	}
+	return ca.Issue(opts)
+}
+
+// IssueClient issues a client certificate of CN commonName with the SANs
+// names, such as a SPIFFE ID, see LeafOptions.SANs.
+func (ca *CertificateAuthority) IssueClient(commonName string, names ...string) (*tls.Certificate, error) {
+	opts := LeafOptions{CommonName: commonName, Client: true}
+	if err := opts.SANs(names...); err != nil {
+		return nil, err
+	}
+	return ca.Issue(opts)
+}
+
+// CertPool returns a pool of the certificate of ca, to trust it as a root.
+func (ca *CertificateAuthority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+	return pool
+}
+
+// VerifyChain verifies the chain of cert, its leaf first as in
+// tls.Certificate, against roots for usage, and returns the verified
+// chains.
+func VerifyChain(cert *tls.Certificate, roots *x509.CertPool, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+	certs := make([]*x509.Certificate, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Errorf("failed to parse certificate: %s", err)
+		}
+		certs[i] = c
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+}
+
+// EncodePEM returns the PEM encodings of the chain of cert and of its
+// private key, as read by tls.X509KeyPair.
+func EncodePEM(cert *tls.Certificate) (certPEM, keyPEM []byte, err error) {
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	block, err := PEMBlockForKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, pem.EncodeToMemory(block), nil
+}
@@ -0,0 +1,141 @@
+package tls_
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertificateAuthority(t *testing.T) {
+	root, err := NewRootCA("test root", []string{"golib"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := root.NewIntermediate("test intermediate", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.IsRoot() || intermediate.IsRoot() {
+		t.Errorf("IsRoot: root %t, intermediate %t", root.IsRoot(), intermediate.IsRoot())
+	}
+	server, err := intermediate.IssueServer("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffeID := SPIFFEID("example.org", "workload/client")
+	client, err := intermediate.IssueClient("client", spiffeID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Certificate) != 2 || len(client.Leaf.URIs) != 1 || client.Leaf.URIs[0].String() != "spiffe://example.org/workload/client" {
+		t.Errorf("chain of %d certificates, URIs %v", len(server.Certificate), client.Leaf.URIs)
+	}
+
+	roots := root.CertPool()
+	if _, err := VerifyChain(server, roots, x509.ExtKeyUsageServerAuth); err != nil {
+		t.Errorf("VerifyChain of the server: %v", err)
+	}
+	if _, err := VerifyChain(client, roots, x509.ExtKeyUsageServerAuth); err == nil {
+		t.Error("VerifyChain of the client for server auth succeeded")
+	}
+	other, _ := NewRootCA("other root", nil, 0)
+	if _, err := VerifyChain(server, other.CertPool(), x509.ExtKeyUsageServerAuth); err == nil {
+		t.Error("VerifyChain with another root succeeded")
+	}
+
+	// mTLS, the server certificate reloaded from files
+	dir, err := ioutil.TempDir("", "tls_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePair := func(cert *tls.Certificate) {
+		certPEM, keyPEM, err := EncodePEM(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePair(server)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      roots,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	dial := func() *x509.Certificate {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{*client},
+		})
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Read(make([]byte, 2)); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+	if got := dial(); !got.Equal(server.Leaf) {
+		t.Errorf("server certificate %v, want %v", got.SerialNumber, server.Leaf.SerialNumber)
+	}
+
+	renewed, err := intermediate.IssueServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePair(renewed)
+	if reloaded, err := reloader.Reload(); !reloaded || err != nil {
+		t.Fatalf("Reload = %t, %v", reloaded, err)
+	}
+	if reloaded, err := reloader.Reload(); reloaded || err != nil {
+		t.Errorf("Reload of unchanged files = %t, %v", reloaded, err)
+	}
+	if got := dial(); !got.Equal(renewed.Leaf) {
+		t.Errorf("server certificate %v after reload, want %v", got.SerialNumber, renewed.Leaf.SerialNumber)
+	}
+
+	// a broken pair is ignored
+	if err := ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Error("Reload of a broken pair succeeded")
+	}
+	if got, err := x509.ParseCertificate(reloader.Certificate().Certificate[0]); err != nil || !got.Equal(renewed.Leaf) {
+		t.Errorf("certificate after a broken reload: %v", err)
+	}
+}
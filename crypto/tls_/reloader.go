@@ -0,0 +1,119 @@
+package tls_
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is the interval CertReloader polls its files at,
+// when its Interval is zero.
+const DefaultReloadInterval = time.Minute
+
+// CertReloader serves the certificate of a pair of PEM files, reloaded when
+// the files change, so certificates are renewed without restarts: use its
+// GetCertificate in the tls.Config of servers, its GetClientCertificate in
+// the one of clients.
+// A certificate which fails to load is ignored, the last one loaded being
+// kept.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	// Interval is the interval Watch polls the files at. If zero,
+	// DefaultReloadInterval is used.
+	Interval time.Duration
+	// OnReload, if not nil, is called after every load of changed files,
+	// with the error if the load failed.
+	OnReload func(cert *tls.Certificate, err error)
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// NewCertReloader returns a CertReloader of the pair certFile and keyFile,
+// loaded.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{CertFile: certFile, KeyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the pair of files if they changed since the last load, and
+// reports whether it did.
+func (r *CertReloader) Reload() (bool, error) {
+	certPEM, err := ioutil.ReadFile(r.CertFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := ioutil.ReadFile(r.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		// the files may be written one after the other
+		if r.OnReload != nil {
+			r.OnReload(nil, err)
+		}
+		return false, err
+	}
+	r.mu.Lock()
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.mu.Unlock()
+	if r.OnReload != nil {
+		r.OnReload(&cert, nil)
+	}
+	return true, nil
+}
+
+// Watch polls the files every Interval, reloading them when they change,
+// until ctx is done.
+func (r *CertReloader) Watch(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reload()
+		}
+	}
+}
+
+// Certificate returns the last certificate loaded.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate returns the last certificate loaded, as
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate returns the last certificate loaded, as
+// tls.Config.GetClientCertificate.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
@@ -0,0 +1,67 @@
+package http_
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/searKing/golib/x/log"
+	"github.com/sirupsen/logrus"
+)
+
+// AccessLog logs a structured entry per request served, at Info level,
+// with the fields method, path, query, proto, host, remote_addr,
+// user_agent, referer, status, bytes, duration and, if set, request_id.
+type AccessLog struct {
+	// Fields, if non-nil, returns more fields to log for a request.
+	Fields func(r *http.Request) logrus.Fields
+	// Skip, if non-nil, tells the requests not to log, such as health checks.
+	Skip func(r *http.Request) bool
+
+	*log.FieldLogger
+}
+
+// Middleware logs the requests served by h.
+func (l *AccessLog) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.Skip != nil && l.Skip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := newResponseRecorder(w)
+		panicked := true
+		defer func() {
+			fields := logrus.Fields{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"query":       r.URL.RawQuery,
+				"proto":       r.Proto,
+				"host":        r.Host,
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+				"referer":     r.Referer(),
+				"status":      rw.Status(),
+				"bytes":       rw.written,
+				"duration":    time.Since(start),
+			}
+			if id := requestID(r, w); id != "" {
+				fields["request_id"] = id
+			}
+			if l.Fields != nil {
+				for k, v := range l.Fields(r) {
+					fields[k] = v
+				}
+			}
+			if panicked {
+				if v := recover(); v != nil {
+					fields["panic"] = panicError(v).Error()
+					l.GetLogger().WithFields(fields).Error("http request panicked")
+					panic(v)
+				}
+			}
+			l.GetLogger().WithFields(fields).Info("http request")
+		}()
+		h.ServeHTTP(rw, r)
+		panicked = false
+	})
+}
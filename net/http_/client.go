@@ -3,7 +3,6 @@ package http_
 import (
 	"context"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,54 +12,76 @@ import (
 // in places where url is shadowed for godoc. See https://golang.org/cl/49930.
 var parseURL = url.Parse
 
+// Client returns a client for u from DefaultClientFactory.
+// u may be an http+unix or https+unix URL, see SplitUnixURL.
 func Client(u string) (*http.Client, error) {
-	url, err := parseURL(u)
+	return DefaultClientFactory.Client(u)
+}
+
+// NewRequestWithContext is like http.NewRequest with a context, and also
+// accepts http+unix and https+unix URLs. It returns the request and the
+// client to send it with, from DefaultClientFactory.
+func NewRequestWithContext(ctx context.Context, method, u string, body io.Reader) (*http.Client, *http.Request, error) {
+	client, err := Client(u)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	hostname := url.Hostname()
-	if strings.Index(hostname, "unix:") != 0 {
-		return http.DefaultClient, nil
+	_, reqURL, _, err := SplitUnixURL(u)
+	if err != nil {
+		return nil, nil, err
 	}
-	tr := &http.Transport{
-		DisableCompression: true,
-		DialContext: func(ctx context.Context, network, addr string) (conn net.Conn, e error) {
-			return net.Dial("unix", url.Host)
-		},
+	req, err := http.NewRequest(method, reqURL, body)
+	if err != nil {
+		return nil, nil, err
 	}
-	client := &http.Client{Transport: tr}
-	return client, nil
+	return client, req.WithContext(ctx), nil
 }
 
 func Head(url string) (resp *http.Response, err error) {
-	client, err := Client(url)
-	if err != nil {
-		return nil, err
-	}
-	return client.Head(url)
-
+	return HeadContext(context.Background(), url)
 }
 
 func Get(url string) (resp *http.Response, err error) {
-	client, err := Client(url)
+	return GetContext(context.Background(), url)
+}
+
+func Post(url, contentType string, body io.Reader) (resp *http.Response, err error) {
+	return PostContext(context.Background(), url, contentType, body)
+}
+
+func PostForm(url string, data url.Values) (resp *http.Response, err error) {
+	return PostFormContext(context.Background(), url, data)
+}
+
+// HeadContext is like Head, with a context for the request.
+func HeadContext(ctx context.Context, url string) (resp *http.Response, err error) {
+	client, req, err := NewRequestWithContext(ctx, http.MethodHead, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	return client.Get(url)
+	return client.Do(req)
 }
 
-func Post(url, contentType string, body io.Reader) (resp *http.Response, err error) {
-	client, err := Client(url)
+// GetContext is like Get, with a context for the request.
+func GetContext(ctx context.Context, url string) (resp *http.Response, err error) {
+	client, req, err := NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	return client.Post(url, contentType, body)
+	return client.Do(req)
 }
 
-func PostForm(url string, data url.Values) (resp *http.Response, err error) {
-	client, err := Client(url)
+// PostContext is like Post, with a context for the request.
+func PostContext(ctx context.Context, url, contentType string, body io.Reader) (resp *http.Response, err error) {
+	client, req, err := NewRequestWithContext(ctx, http.MethodPost, url, body)
 	if err != nil {
 		return nil, err
 	}
-	return client.PostForm(url, data)
+	req.Header.Set("Content-Type", contentType)
+	return client.Do(req)
+}
+
+// PostFormContext is like PostForm, with a context for the request.
+func PostFormContext(ctx context.Context, url string, data url.Values) (resp *http.Response, err error) {
+	return PostContext(ctx, url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
 }
@@ -0,0 +1,316 @@
+package http_
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressibleContentTypes are the media types a Compressor
+// compresses by default.
+var DefaultCompressibleContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"image/svg+xml",
+}
+
+// A ContentEncoder compresses responses in one Content-Encoding.
+type ContentEncoder interface {
+	// Encoding returns the token of the Content-Encoding, such as gzip.
+	Encoding() string
+	// NewWriter returns a writer compressing to w at level.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// ContentEncoderFunc adapts a func to a ContentEncoder of encoding.
+type ContentEncoderFunc struct {
+	Name string
+	New  func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+func (f ContentEncoderFunc) Encoding() string { return f.Name }
+func (f ContentEncoderFunc) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return f.New(w, level)
+}
+
+var (
+	GzipEncoder ContentEncoder = ContentEncoderFunc{Name: "gzip", New: func(w io.Writer, level int) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	}}
+	DeflateEncoder ContentEncoder = ContentEncoderFunc{Name: "deflate", New: func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	}}
+)
+
+// Compressor compresses responses in the Content-Encoding a request
+// accepts best among Encoders, if their media type is allowed and they
+// are large enough.
+// Encoders other than gzip and deflate, such as brotli, can be added as
+// ContentEncoders.
+type Compressor struct {
+	// Encoders are the encodings supported, by preference. If empty,
+	// gzip then deflate are used.
+	Encoders []ContentEncoder
+	// Level is the compression level passed to the encoders. If zero,
+	// gzip.DefaultCompression is used.
+	Level int
+	// MinSize is the size under which responses are sent uncompressed,
+	// as known from their Content-Length or their first writes. If zero,
+	// 1024 is used.
+	MinSize int
+	// ContentTypes are the media types compressed, as path.Match patterns
+	// such as "text/*". If empty, DefaultCompressibleContentTypes are used.
+	ContentTypes []string
+}
+
+func (c *Compressor) encoders() []ContentEncoder {
+	if len(c.Encoders) == 0 {
+		return []ContentEncoder{GzipEncoder, DeflateEncoder}
+	}
+	return c.Encoders
+}
+
+func (c *Compressor) minSize() int {
+	if c.MinSize == 0 {
+		return 1024
+	}
+	return c.MinSize
+}
+
+func (c *Compressor) level() int {
+	if c.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.Level
+}
+
+// compressible reports whether the media type of contentType is allowed.
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	patterns := c.ContentTypes
+	if len(patterns) == 0 {
+		patterns = DefaultCompressibleContentTypes
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the encoder the Accept-Encoding header acceptEncoding
+// prefers, or nil for identity.
+func (c *Compressor) negotiate(acceptEncoding string) ContentEncoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+	var best ContentEncoder
+	bestQ := 0.0
+	for _, enc := range c.encoders() {
+		q := -1.0
+		for _, elem := range strings.Split(acceptEncoding, ",") {
+			coding, params := elem, ""
+			if i := strings.Index(elem, ";"); i >= 0 {
+				coding, params = elem[:i], elem[i+1:]
+			}
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != enc.Encoding() && !(coding == "*" && q < 0) {
+				continue
+			}
+			eq := 1.0
+			params = strings.TrimSpace(params)
+			if strings.HasPrefix(params, "q=") {
+				if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+					eq = f
+				}
+			}
+			q = eq
+			if coding != "*" {
+				break
+			}
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// Middleware compresses the responses of h.
+func (c *Compressor) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if enc == nil || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoder: enc}
+		h.ServeHTTP(cw, r)
+		// not deferred, so that nothing is sent if h panics
+		cw.Close()
+	})
+}
+
+// Compress compresses the responses of h with a zero Compressor.
+func Compress(h http.Handler) http.Handler {
+	return (&Compressor{}).Middleware(h)
+}
+
+// compressWriter buffers the start of a response until it knows whether to
+// compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoder    ContentEncoder
+
+	status  int
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser // nil if not compressing
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	if status >= 100 && status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		// informational
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+		return
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < w.compressor.minSize() {
+			w.decide(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(append(w.buf, p...)))
+		}
+		if len(w.buf)+len(p) < w.compressor.minSize() {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		w.decide(true)
+		if err := w.flushBuf(); err != nil {
+			return 0, err
+		}
+	}
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide sends the header of the response, compressed if large is set and
+// the response can be.
+func (w *compressWriter) decide(large bool) {
+	w.decided = true
+	header := w.Header()
+	if large && header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		w.status != http.StatusPartialContent && w.compressor.compressible(header.Get("Content-Type")) {
+		zw, err := w.encoder.NewWriter(w.ResponseWriter, w.compressor.level())
+		if err == nil {
+			w.zw = zw
+			header.Set("Content-Encoding", w.encoder.Encoding())
+			header.Del("Content-Length")
+			header.Del("Accept-Ranges")
+			if etag := header.Get("Etag"); strings.HasPrefix(etag, `"`) {
+				// the compressed body is another representation
+				header.Set("Etag", "W/"+etag)
+			}
+		}
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) flushBuf() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Close sends what is buffered and ends the compressed stream.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// nothing written, let the server send its default response
+			return nil
+		}
+		w.decide(false)
+	}
+	if err := w.flushBuf(); err != nil {
+		return err
+	}
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	return nil
+}
+
+// Flush sends what is buffered, compressed if the response is not known
+// to be small.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.WriteHeader(http.StatusOK)
+		}
+		if !w.decided {
+			w.decide(true)
+		}
+	}
+	w.flushBuf()
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.decided = true
+		return h.Hijack()
+	}
+	return nil, nil, errNotHijacker
+}
@@ -104,6 +104,20 @@ func parseContentRanges(s []string) ([]httpContentRange, error) {
 // parseContentRange parses a Range header string as per RFC 7233.
 // errNoOverlap is returned if none of the ranges overlap.
 func parseContentRange(s string) (contentRange *httpContentRange, err error) {
+	r, err := parseContentRangeSpec(s)
+	if r == nil || err != nil {
+		return r, err
+	}
+	if r.firstBytePos >= 0 && r.lastBytePos >= 0 && r.completeLength >= 0 && (r.lastBytePos-r.firstBytePos+1 < r.completeLength) {
+		// The specified ranges did not overlap with the content.
+		return nil, errNoOverlap
+	}
+	return r, nil
+}
+
+// parseContentRangeSpec parses a Content-Range header string as per RFC 7233,
+// section 4.2, such as a 206 response carries.
+func parseContentRangeSpec(s string) (contentRange *httpContentRange, err error) {
 	// bytes 0-499/1234
 	if s == "" {
 		return nil, nil // header not present
@@ -182,10 +196,6 @@ func parseContentRange(s string) (contentRange *httpContentRange, err error) {
 		return nil, errors.New("invalid range")
 	}
 
-	if r.firstBytePos >= 0 && r.lastBytePos >= 0 && r.completeLength >= 0 && (r.lastBytePos-r.firstBytePos+1 < r.completeLength) {
-		// The specified ranges did not overlap with the content.
-		return nil, errNoOverlap
-	}
 	return &r, nil
 }
 
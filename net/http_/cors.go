@@ -0,0 +1,166 @@
+package http_
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSMethods are the methods a CORS allows by default.
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// CORS answers cross-origin requests as in the Fetch standard: it answers
+// preflight requests itself and adds the Access-Control-* headers to
+// the responses of allowed origins.
+type CORS struct {
+	// AllowedOrigins are the origins allowed, such as https://example.com;
+	// "*" allows any origin, a "*." prefix of the host any subdomain, as in
+	// https://*.example.com.
+	AllowedOrigins []string
+	// AllowOriginFunc, if non-nil, is asked about origins AllowedOrigins
+	// doesn't allow.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// AllowedMethods are the methods allowed. If empty, DefaultCORSMethods are.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed; "*" allows any
+	// header requested.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to the client.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with credentials. The origin, not
+	// "*", is then sent in Access-Control-Allow-Origin.
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request may be cached.
+	// If zero, no Access-Control-Max-Age is sent.
+	MaxAge time.Duration
+	// OptionsPassthrough passes preflight requests on to the handler after
+	// adding the headers, instead of answering them 204 No Content.
+	OptionsPassthrough bool
+}
+
+func (c *CORS) allowOrigin(r *http.Request, origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if i := strings.Index(allowed, "://*."); i >= 0 {
+			scheme, suffix := allowed[:i+len("://")], allowed[i+len("://*"):]
+			if len(origin) > len(scheme)+len(suffix) &&
+				strings.EqualFold(origin[:len(scheme)], scheme) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return c.AllowOriginFunc != nil && c.AllowOriginFunc(r, origin)
+}
+
+func (c *CORS) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return DefaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+func (c *CORS) allowMethod(method string) bool {
+	for _, m := range c.methods() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether the headers of a preflight request are all
+// allowed.
+func (c *CORS) allowHeaders(requested []string) bool {
+	for _, h := range requested {
+		found := false
+		for _, allowed := range c.AllowedHeaders {
+			if allowed == "*" || strings.EqualFold(allowed, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CORS) setAllowOrigin(header http.Header, origin string) {
+	if c.AllowCredentials || !c.allowsAnyOrigin() {
+		header.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		header.Set("Access-Control-Allow-Origin", "*")
+	}
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) allowsAnyOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware handles the cross-origin requests to h.
+func (c *CORS) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		header := w.Header()
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
+			if c.OptionsPassthrough {
+				h.ServeHTTP(w, r)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		header.Add("Vary", "Origin")
+		if origin != "" && c.allowOrigin(r, origin) {
+			c.setAllowOrigin(header, origin)
+			if len(c.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// preflight adds the headers of the response to a preflight request, if
+// it is allowed.
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if origin == "" || !c.allowOrigin(r, origin) {
+		return
+	}
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.allowMethod(method) {
+		return
+	}
+	requested := headerList(r.Header, "Access-Control-Request-Headers")
+	if !c.allowHeaders(requested) {
+		return
+	}
+
+	c.setAllowOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(c.methods(), ", "))
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.FormatInt(int64(c.MaxAge/time.Second), 10))
+	}
+}
@@ -0,0 +1,440 @@
+package http_
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Suffixes of the files a Downloader keeps next to the destination until
+// the download completes: the partial content, and its resume state.
+const (
+	DownloadPartSuffix  = ".part"
+	DownloadStateSuffix = ".part.json"
+)
+
+// DefaultDownloadChunkSize is the Downloader.ChunkSize used if zero.
+const DefaultDownloadChunkSize = 4 << 20
+
+var (
+	// ErrResourceChanged is returned by Downloader.Download when the ETag,
+	// Last-Modified or size of the resource changes during the download.
+	ErrResourceChanged = errors.New("http: resource changed during download")
+	// ErrUnexpectedContentRange is returned by Downloader.Download when the
+	// server replies with a range other than the one requested.
+	ErrUnexpectedContentRange = errors.New("http: unexpected Content-Range")
+)
+
+// Progress is the state of a download, reported to an OnProgressHandler.
+type Progress struct {
+	// Downloaded is the number of bytes on disk, including resumed ones.
+	Downloaded int64
+	// Total is the size of the resource, or -1 if unknown.
+	Total int64
+}
+
+type OnProgressHandler interface {
+	OnProgress(p Progress)
+}
+type OnProgressHandlerFunc func(p Progress)
+
+func (f OnProgressHandlerFunc) OnProgress(p Progress) { f(p) }
+
+type nopProgressHandler struct{}
+
+func (nopProgressHandler) OnProgress(p Progress) {}
+
+// A Downloader fetches a URL into a file in ranged chunks, Concurrency at
+// a time. Completed chunks are recorded in a sidecar state file, so that
+// a download interrupted by a crash resumes where it stopped, as long as
+// the resource keeps the same ETag, Last-Modified and size.
+// Servers that don't support ranges are read in a single stream, which
+// can't be resumed.
+//
+// The zero value is ready to use.
+type Downloader struct {
+	// Client sends the requests. If nil, Client from DefaultClientFactory is used.
+	Client *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// Concurrency is the number of chunks fetched in parallel; 4 if zero.
+	Concurrency int
+	// ChunkSize is the size of each ranged request; DefaultDownloadChunkSize if zero.
+	ChunkSize int64
+	// ProgressHandler is called as bytes are written, one call at a time.
+	ProgressHandler OnProgressHandler
+}
+
+// downloadState is the content of the sidecar state file.
+type downloadState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+	ChunkSize    int64  `json:"chunk_size"`
+	Done         []bool `json:"done"`
+}
+
+func (s *downloadState) sameResource(o *downloadState) bool {
+	return s.URL == o.URL && s.ETag == o.ETag && s.LastModified == o.LastModified &&
+		s.Size == o.Size && s.ChunkSize == o.ChunkSize && len(s.Done) == len(o.Done)
+}
+
+// partFits reports whether a part file of size bytes holds the chunks
+// done in s, as written by WriteAt: at least up to the end of the last one.
+func (s *downloadState) partFits(size int64) bool {
+	var end int64
+	for i, done := range s.Done {
+		if done {
+			_, end = s.chunk(i)
+		}
+	}
+	return end <= size && size <= s.Size
+}
+
+func (s *downloadState) chunk(i int) (start, end int64) {
+	start = int64(i) * s.ChunkSize
+	end = start + s.ChunkSize
+	if end > s.Size {
+		end = s.Size
+	}
+	return start, end
+}
+
+func loadDownloadState(name string) (*downloadState, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var s downloadState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// save writes s to name through a temporary file, so that a crash leaves
+// either the old state or the new one.
+func (s *downloadState) save(name string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (d *Downloader) concurrency() int {
+	if d.Concurrency > 0 {
+		return d.Concurrency
+	}
+	return 4
+}
+
+func (d *Downloader) chunkSize() int64 {
+	if d.ChunkSize > 0 {
+		return d.ChunkSize
+	}
+	return DefaultDownloadChunkSize
+}
+
+func (d *Downloader) newRequest(ctx context.Context, url string) (*http.Client, *http.Request, error) {
+	client, req, err := NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.Client != nil {
+		client = d.Client
+	}
+	for k, v := range d.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return client, req, nil
+}
+
+// Download fetches url into the file name, replacing it once complete.
+func (d *Downloader) Download(ctx context.Context, url, name string) error {
+	partName, stateName := name+DownloadPartSuffix, name+DownloadStateSuffix
+
+	// probe the size and validators, and whether ranges are supported
+	client, req, err := d.newRequest(ctx, url)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var cr *httpContentRange
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		cr, err = parseContentRangeSpec(resp.Header.Get("Content-Range"))
+		if err != nil || cr == nil {
+			return ErrUnexpectedContentRange
+		}
+	case http.StatusOK:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// an empty resource has no byte to probe
+		resp.Body.Close()
+		return d.downloadStream(ctx, url, name, partName, stateName)
+	default:
+		return fmt.Errorf("http: GET %s: %s", url, resp.Status)
+	}
+	if cr == nil || cr.completeLength < 0 {
+		if resp.StatusCode == http.StatusOK {
+			return d.writeStream(resp, name, partName, stateName)
+		}
+		resp.Body.Close()
+		return d.downloadStream(ctx, url, name, partName, stateName)
+	}
+	resp.Body.Close()
+
+	state := &downloadState{
+		URL:          url,
+		ETag:         resp.Header.Get("Etag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         cr.completeLength,
+		ChunkSize:    d.chunkSize(),
+	}
+	state.Done = make([]bool, (state.Size+state.ChunkSize-1)/state.ChunkSize)
+
+	// the state file can't tell whether the part file was removed or
+	// truncated since, so check its size before trusting the chunks done
+	part, partErr := os.Stat(partName)
+	f, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if old, err := loadDownloadState(stateName); err == nil && old.sameResource(state) &&
+		partErr == nil && old.partFits(part.Size()) {
+		state.Done = old.Done
+	} else if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if err := state.save(stateName); err != nil {
+		return err
+	}
+
+	if err := d.downloadChunks(ctx, f, state, stateName); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partName, name); err != nil {
+		return err
+	}
+	return os.Remove(stateName)
+}
+
+// downloadStream fetches url in a single request.
+func (d *Downloader) downloadStream(ctx context.Context, url, name, partName, stateName string) error {
+	client, req, err := d.newRequest(ctx, url)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http: GET %s: %s", url, resp.Status)
+	}
+	return d.writeStream(resp, name, partName, stateName)
+}
+
+// writeStream writes the whole body of resp to name.
+func (d *Downloader) writeStream(resp *http.Response, name, partName, stateName string) error {
+	// a stream can't be resumed, so drop any state of a ranged download
+	os.Remove(stateName)
+	f, err := os.Create(partName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p := &progress{handler: d.progressHandler(), total: resp.ContentLength}
+	if _, err := io.Copy(f, &progressReader{r: resp.Body, p: p}); err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && p.downloaded != resp.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partName, name)
+}
+
+func (d *Downloader) progressHandler() OnProgressHandler {
+	if d.ProgressHandler != nil {
+		return d.ProgressHandler
+	}
+	return nopProgressHandler{}
+}
+
+// downloadChunks fetches the chunks of state not done yet into f.
+func (d *Downloader) downloadChunks(ctx context.Context, f *os.File, state *downloadState, stateName string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := &progress{handler: d.progressHandler(), total: state.Size}
+	var todo []int
+	for i, done := range state.Done {
+		if done {
+			start, end := state.chunk(i)
+			p.downloaded += end - start
+		} else {
+			todo = append(todo, i)
+		}
+	}
+	p.handler.OnProgress(Progress{Downloaded: p.downloaded, Total: p.total})
+
+	chunks := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex // guards state and firstErr
+		firstErr error
+	)
+	for w := 0; w < d.concurrency(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunks {
+				err := d.downloadChunk(ctx, f, state, i, p)
+				mu.Lock()
+				if err == nil {
+					state.Done[i] = true
+					err = state.save(stateName)
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, i := range todo {
+		select {
+		case chunks <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// downloadChunk fetches chunk i of state into f.
+func (d *Downloader) downloadChunk(ctx context.Context, f *os.File, state *downloadState, i int, p *progress) error {
+	start, end := state.chunk(i)
+	client, req, err := d.newRequest(ctx, state.URL)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	// the server sends the whole resource instead if it changed; weak ETags
+	// can't be used in If-Range
+	if state.ETag != "" && !strings.HasPrefix(state.ETag, "W/") {
+		req.Header.Set("If-Range", state.ETag)
+	} else if state.LastModified != "" {
+		req.Header.Set("If-Range", state.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK, http.StatusPreconditionFailed:
+		return ErrResourceChanged
+	default:
+		return fmt.Errorf("http: GET %s: %s", state.URL, resp.Status)
+	}
+	if resp.Header.Get("Etag") != state.ETag || resp.Header.Get("Last-Modified") != state.LastModified {
+		return ErrResourceChanged
+	}
+	cr, err := parseContentRangeSpec(resp.Header.Get("Content-Range"))
+	if err != nil || cr == nil || cr.firstBytePos != start || cr.lastBytePos != end-1 {
+		return ErrUnexpectedContentRange
+	}
+	if cr.completeLength >= 0 && cr.completeLength != state.Size {
+		return ErrResourceChanged
+	}
+
+	buf := make([]byte, 32<<10)
+	off := start
+	for off < end {
+		n, err := resp.Body.Read(buf)
+		if int64(n) > end-off {
+			n = int(end - off)
+		}
+		if n > 0 {
+			if _, werr := f.WriteAt(buf[:n], off); werr != nil {
+				return werr
+			}
+			off += int64(n)
+			p.add(int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if off != end {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// progress serializes the calls to a OnProgressHandler.
+type progress struct {
+	mu         sync.Mutex
+	handler    OnProgressHandler
+	downloaded int64
+	total      int64
+}
+
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloaded += n
+	p.handler.OnProgress(Progress{Downloaded: p.downloaded, Total: p.total})
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.p.add(int64(n))
+	}
+	return n, err
+}
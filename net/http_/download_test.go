@@ -0,0 +1,148 @@
+package http_
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	modtime := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var ranged, plain int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			atomic.AddInt32(&plain, 1)
+			w.Write(data)
+			return
+		}
+		atomic.AddInt32(&ranged, 1)
+		if r.URL.Path == "/weak" {
+			w.Header().Set("Etag", `W/"v1"`)
+		} else {
+			w.Header().Set("Etag", `"v1"`)
+		}
+		http.ServeContent(w, r, "", modtime, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "data")
+
+	var last Progress
+	d := &Downloader{ChunkSize: 1024, Concurrency: 3,
+		ProgressHandler: OnProgressHandlerFunc(func(p Progress) { last = p })}
+	if err := d.Download(context.Background(), srv.URL+"/ranged", name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, data) {
+		t.Errorf("ranged download: got %d bytes, want the %d served", len(got), len(data))
+	}
+	if want := (Progress{Downloaded: int64(len(data)), Total: int64(len(data))}); last != want {
+		t.Errorf("last progress = %+v, want %+v", last, want)
+	}
+	if _, err := os.Stat(name + DownloadStateSuffix); !os.IsNotExist(err) {
+		t.Errorf("state file left after download: %v", err)
+	}
+	// probe plus 10 chunks
+	if ranged != 11 {
+		t.Errorf("ranged download sent %d requests, want 11", ranged)
+	}
+
+	// resume with all chunks but the last done
+	state := &downloadState{URL: srv.URL + "/ranged", ETag: `"v1"`, LastModified: modtime.Format(http.TimeFormat),
+		Size: int64(len(data)), ChunkSize: 1024, Done: make([]bool, 10)}
+	for i := 0; i < 9; i++ {
+		state.Done[i] = true
+	}
+	if err := state.save(name + DownloadStateSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name+DownloadPartSuffix, data[:9*1024], 0644); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&ranged, 0)
+	if err := d.Download(context.Background(), srv.URL+"/ranged", name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, data) {
+		t.Errorf("resumed download: got %d bytes, want the %d served", len(got), len(data))
+	}
+	if ranged != 2 {
+		t.Errorf("resumed download sent %d requests, want 2", ranged)
+	}
+
+	// a part file shorter than the chunks done is downloaded again
+	if err := state.save(name + DownloadStateSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name+DownloadPartSuffix, data[:5*1024], 0644); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&ranged, 0)
+	if err := d.Download(context.Background(), srv.URL+"/ranged", name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, data) {
+		t.Errorf("download of a truncated part: got %d bytes, want the %d served", len(got), len(data))
+	}
+	if ranged != 11 {
+		t.Errorf("download of a truncated part sent %d requests, want 11", ranged)
+	}
+
+	// a weak ETag is not sent in If-Range, Last-Modified is
+	os.Remove(name)
+	atomic.StoreInt32(&ranged, 0)
+	if err := d.Download(context.Background(), srv.URL+"/weak", name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, data) {
+		t.Errorf("download with a weak ETag: got %d bytes, want the %d served", len(got), len(data))
+	}
+	if ranged != 11 {
+		t.Errorf("download with a weak ETag sent %d requests, want 11", ranged)
+	}
+
+	// a server ignoring Range is read in a single stream
+	os.Remove(name)
+	if err := d.Download(context.Background(), srv.URL+"/plain", name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, data) {
+		t.Errorf("single stream download: got %d bytes, want the %d served", len(got), len(data))
+	}
+	if plain != 1 {
+		t.Errorf("single stream download sent %d requests, want 1", plain)
+	}
+}
+
+func TestDownloaderResourceChanged(t *testing.T) {
+	var etag int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every response carries a new ETag
+		w.Header().Set("Etag", `"v`+string(rune('a'+atomic.AddInt32(&etag, 1)%26))+`"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(make([]byte, 4096)))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Downloader{ChunkSize: 1024}
+	if err := d.Download(context.Background(), srv.URL, filepath.Join(dir, "data")); err != ErrResourceChanged {
+		t.Errorf("Download = %v, want %v", err, ErrResourceChanged)
+	}
+}
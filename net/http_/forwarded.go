@@ -0,0 +1,399 @@
+package http_
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errInvalidForwarded = errors.New("http: invalid Forwarded header")
+
+// Forwarded is one element of a Forwarded header, RFC 7239: what a proxy
+// tells about the request it forwarded. Node values such as For keep their
+// port and IPv6 brackets, see ForwardedNodeIP.
+type Forwarded struct {
+	// For is the node that sent the request to the proxy.
+	For string
+	// By is the interface of the proxy that received the request.
+	By string
+	// Host is the Host request header received by the proxy.
+	Host string
+	// Proto is the scheme of the request received by the proxy.
+	Proto string
+	// Extensions holds the other parameters, by lower case name.
+	Extensions map[string]string
+}
+
+// ParseForwarded parses the values of the Forwarded headers of a request,
+// as in r.Header["Forwarded"], into their elements, in the order the proxies
+// added them, the one nearest to the client first. Values may be quoted
+// strings, holding commas or semicolons.
+func ParseForwarded(values []string) ([]Forwarded, error) {
+	var elems []Forwarded
+	for _, v := range values {
+		s := v
+		for {
+			var fwd Forwarded
+			var err error
+			s, err = parseForwardedElement(s, &fwd)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, fwd)
+			s = strings.TrimLeft(s, " \t")
+			if s == "" {
+				break
+			}
+			// s[0] == ','
+			s = s[1:]
+		}
+	}
+	return elems, nil
+}
+
+// parseForwardedElement parses the forwarded-pairs of one element at the
+// start of s into fwd, and returns the rest of s, from the comma ending
+// the element.
+func parseForwardedElement(s string, fwd *Forwarded) (rest string, err error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" || s[0] == ',' {
+			// an empty element, as allowed by the list syntax
+			return s, nil
+		}
+		i := strings.IndexByte(s, '=')
+		if i <= 0 || !isToken(s[:i]) {
+			return "", errInvalidForwarded
+		}
+		name := strings.ToLower(s[:i])
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s, err = parseQuotedString(s)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			i := strings.IndexAny(s, ";, \t")
+			if i < 0 {
+				i = len(s)
+			}
+			value, s = s[:i], s[i:]
+			if !isForwardedValue(value) {
+				return "", errInvalidForwarded
+			}
+		}
+
+		switch name {
+		case "for":
+			fwd.For = value
+		case "by":
+			fwd.By = value
+		case "host":
+			fwd.Host = value
+		case "proto":
+			fwd.Proto = strings.ToLower(value)
+		default:
+			if fwd.Extensions == nil {
+				fwd.Extensions = make(map[string]string)
+			}
+			fwd.Extensions[name] = value
+		}
+
+		s = strings.TrimLeft(s, " \t")
+		if s == "" || s[0] == ',' {
+			return s, nil
+		}
+		if s[0] != ';' {
+			return "", errInvalidForwarded
+		}
+		s = s[1:]
+	}
+}
+
+// parseQuotedString parses the quoted-string at the start of s, RFC 7230
+// section 3.2.6, and returns its unquoted value and the rest of s.
+func parseQuotedString(s string) (value, rest string, err error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", errInvalidForwarded
+			}
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errInvalidForwarded
+}
+
+// isToken reports whether s is a token, RFC 7230 section 3.2.6.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isForwardedValue reports whether s is an unquoted value of a Forwarded
+// pair: a token, or an IP address and port that a lenient proxy didn't quote.
+func isForwardedValue(s string) bool {
+	return isToken(strings.NewReplacer(":", "", "[", "", "]", "", "/", "").Replace(s)) || s == "[]"
+}
+
+// ForwardedNodeIP returns the IP address of a node of a Forwarded element,
+// such as 192.0.2.60, "[2001:db8:cafe::17]:4711" or 192.0.2.60:80, or nil
+// for an "unknown" or obfuscated node.
+func ForwardedNodeIP(node string) net.IP {
+	host := node
+	if h, _, err := net.SplitHostPort(node); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.ParseIP(host)
+}
+
+// A TrustedProxies tells which proxies in front of a server are trusted
+// to tell the client address, scheme and host of the requests they forward,
+// in Forwarded or X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host
+// headers. Headers sent by other peers are ignored.
+//
+// The zero value trusts no one.
+type TrustedProxies struct {
+	// Networks are the addresses of trusted proxies.
+	Networks []*net.IPNet
+	// Hops is the number of proxies nearest to the server trusted whatever
+	// their address, such as load balancers without fixed addresses.
+	Hops int
+}
+
+// NewTrustedProxies returns the TrustedProxies of the networks named by
+// cidrs, such as "10.0.0.0/8", or single addresses, such as "::1".
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			tp.Networks = append(tp.Networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		tp.Networks = append(tp.Networks, network)
+	}
+	return tp, nil
+}
+
+// Trusts reports whether ip is the address of a trusted proxy.
+func (tp *TrustedProxies) Trusts(ip net.IP) bool {
+	if tp == nil || ip == nil {
+		return false
+	}
+	for _, network := range tp.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsHop reports whether the node hop proxies away from the server,
+// 0 being the peer of the connection, is trusted.
+func (tp *TrustedProxies) trustsHop(hop int, ip net.IP) bool {
+	return tp != nil && (hop < tp.Hops || tp.Trusts(ip))
+}
+
+// ForwardedRequest is what a request tells about its client through
+// trusted proxies.
+type ForwardedRequest struct {
+	// ClientIP is the address of the client, or of the first untrusted
+	// proxy in front of it, or nil if a trusted proxy didn't know it.
+	ClientIP net.IP
+	// ClientAddr is the node of the client, as ip:port if the port is
+	// known, else as ip.
+	ClientAddr string
+	// Scheme and Host are the ones requested by the client, "http" or
+	// "https", and a host[:port].
+	Scheme string
+	Host   string
+}
+
+// hop is a node of the chain of proxies a request went through, and what
+// the proxy it sent the request to tells about the request.
+type hop struct {
+	node, proto, host string
+}
+
+// Resolve returns what r tells about its client. Proxies are walked from
+// the peer of the connection towards the client, as long as they are
+// trusted; the client is the first node not trusted.
+func (tp *TrustedProxies) Resolve(r *http.Request) ForwardedRequest {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	fr := ForwardedRequest{ClientAddr: r.RemoteAddr, ClientIP: ForwardedNodeIP(r.RemoteAddr), Scheme: scheme, Host: r.Host}
+	if !tp.trustsHop(0, fr.ClientIP) {
+		return fr
+	}
+
+	hops := forwardedHops(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		ip := ForwardedNodeIP(h.node)
+		fr.ClientAddr, fr.ClientIP = h.node, ip
+		if h.proto == "http" || h.proto == "https" {
+			fr.Scheme = h.proto
+		}
+		if h.host != "" && validHost(h.host) {
+			fr.Host = h.host
+		}
+		if !tp.trustsHop(len(hops)-i, ip) {
+			break
+		}
+	}
+	return fr
+}
+
+// forwardedHops returns the hops told by the Forwarded header of r, or
+// else by its X-Forwarded-* headers, the nearest to the client first.
+func forwardedHops(r *http.Request) []hop {
+	if values := r.Header["Forwarded"]; len(values) > 0 {
+		elems, err := ParseForwarded(values)
+		if err != nil {
+			return nil
+		}
+		hops := make([]hop, 0, len(elems))
+		for _, e := range elems {
+			hops = append(hops, hop{node: e.For, proto: e.Proto, host: e.Host})
+		}
+		return hops
+	}
+
+	fors := headerList(r.Header, "X-Forwarded-For")
+	protos := headerList(r.Header, "X-Forwarded-Proto")
+	hosts := headerList(r.Header, "X-Forwarded-Host")
+	hops := make([]hop, len(fors))
+	for i, node := range fors {
+		hops[i].node = node
+		// a list as long as X-Forwarded-For is added by the same proxies,
+		// else the value is of the nearest proxy setting it
+		hops[i].proto = listValue(protos, i, len(fors))
+		hops[i].host = listValue(hosts, i, len(fors))
+	}
+	return hops
+}
+
+func listValue(list []string, i, n int) string {
+	switch {
+	case len(list) == n:
+		return strings.ToLower(list[i])
+	case len(list) > 0 && i == n-1:
+		return strings.ToLower(list[len(list)-1])
+	}
+	return ""
+}
+
+// headerList returns the elements of the comma separated lists of the
+// header key.
+func headerList(h http.Header, key string) []string {
+	var list []string
+	for _, v := range h[key] {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				list = append(list, e)
+			}
+		}
+	}
+	return list
+}
+
+// validHost reports whether host is a plausible host[:port], without the
+// characters of a path, query, user info or header injection.
+func validHost(host string) bool {
+	if len(host) > 255 {
+		return false
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`/?#@\"<>{}|^%`+"`", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientIP returns the address of the client of r, see Resolve.
+func (tp *TrustedProxies) ClientIP(r *http.Request) net.IP {
+	return tp.Resolve(r).ClientIP
+}
+
+// forwardedHeaders are the headers of proxies, dropped from requests of
+// untrusted peers.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-Ip"}
+
+// Middleware rewrites r.RemoteAddr, r.URL.Scheme and r.Host of requests to
+// h with the client address, scheme and host that trusted proxies tell, see
+// Resolve. Proxy headers of requests from untrusted peers are removed, so
+// that h can't be fooled by them.
+// A client address without port is given port 0, as RemoteAddr is ip:port.
+func (tp *TrustedProxies) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tp.trustsHop(0, ForwardedNodeIP(r.RemoteAddr)) {
+			for _, key := range forwardedHeaders {
+				r.Header.Del(key)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		fr := tp.Resolve(r)
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		if fr.ClientIP != nil {
+			if _, _, err := net.SplitHostPort(fr.ClientAddr); err == nil {
+				r2.RemoteAddr = fr.ClientAddr
+			} else {
+				r2.RemoteAddr = net.JoinHostPort(fr.ClientIP.String(), "0")
+			}
+		}
+		r2.URL.Scheme = fr.Scheme
+		r2.Host = fr.Host
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// ResolveURL sets the scheme and host of u to the ones the client of r
+// requested, see Resolve.
+func (tp *TrustedProxies) ResolveURL(u *url.URL, r *http.Request) *url.URL {
+	if u == nil {
+		return nil
+	}
+	fr := tp.Resolve(r)
+	u.Scheme = fr.Scheme
+	u.Host = fr.Host
+	return u
+}
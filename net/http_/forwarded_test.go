@@ -0,0 +1,130 @@
+package http_
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	table := []struct {
+		values  []string
+		want    []Forwarded
+		wantErr bool
+	}{
+		{
+			values: []string{`for="_gazonk"`},
+			want:   []Forwarded{{For: "_gazonk"}},
+		},
+		{
+			values: []string{`For="[2001:db8:cafe::17]:4711"`},
+			want:   []Forwarded{{For: "[2001:db8:cafe::17]:4711"}},
+		},
+		{
+			values: []string{`for=192.0.2.60;proto=http;by=203.0.113.43`},
+			want:   []Forwarded{{For: "192.0.2.60", Proto: "http", By: "203.0.113.43"}},
+		},
+		{
+			values: []string{`for=192.0.2.43, for=198.51.100.17`, `for=unknown;host="a.example;b"`},
+			want:   []Forwarded{{For: "192.0.2.43"}, {For: "198.51.100.17"}, {For: "unknown", Host: "a.example;b"}},
+		},
+		{
+			values: []string{`for=192.0.2.43;secret=x`},
+			want:   []Forwarded{{For: "192.0.2.43", Extensions: map[string]string{"secret": "x"}}},
+		},
+		{values: []string{`for`}, wantErr: true},
+		{values: []string{`for="192.0.2.43`}, wantErr: true},
+		{values: []string{`for=192.0.2.43 proto=http`}, wantErr: true},
+	}
+	for i, test := range table {
+		got, err := ParseForwarded(test.values)
+		if (err != nil) != test.wantErr {
+			t.Errorf("#%d: ParseForwarded(%q) error = %v, want error %v", i, test.values, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: ParseForwarded(%q) = %+v, want %+v", i, test.values, got, test.want)
+		}
+	}
+}
+
+func TestTrustedProxiesResolve(t *testing.T) {
+	cidr, err := NewTrustedProxies("10.0.0.0/8", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := []struct {
+		tp         *TrustedProxies
+		remoteAddr string
+		header     http.Header
+		want       ForwardedRequest
+	}{
+		{ // untrusted peer
+			tp:         cidr,
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"Forwarded": {"for=198.51.100.1;proto=https;host=evil.example"}},
+			want:       ForwardedRequest{ClientIP: ForwardedNodeIP("192.0.2.1"), ClientAddr: "192.0.2.1:1234", Scheme: "http", Host: "example.com"},
+		},
+		{ // chain of trusted proxies, stopped at the first untrusted node
+			tp:         cidr,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for=198.51.100.1, for=192.0.2.7;proto=https;host=a.example, for="[::1]:80"`}},
+			want:       ForwardedRequest{ClientIP: ForwardedNodeIP("192.0.2.7"), ClientAddr: "192.0.2.7", Scheme: "https", Host: "a.example"},
+		},
+		{ // trusted by hops
+			tp:         &TrustedProxies{Hops: 1},
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.5"}, "X-Forwarded-Proto": {"https"}},
+			want:       ForwardedRequest{ClientIP: ForwardedNodeIP("203.0.113.5"), ClientAddr: "203.0.113.5", Scheme: "https", Host: "example.com"},
+		},
+		{ // X-Forwarded-* fallback, invalid host ignored
+			tp:         cidr,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Host": {"a.example/path"}},
+			want:       ForwardedRequest{ClientIP: ForwardedNodeIP("198.51.100.1"), ClientAddr: "198.51.100.1", Scheme: "http", Host: "example.com"},
+		},
+		{ // nil trusts no one
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       ForwardedRequest{ClientIP: ForwardedNodeIP("10.0.0.1"), ClientAddr: "10.0.0.1:1234", Scheme: "http", Host: "example.com"},
+		},
+	}
+	for i, test := range table {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header = test.header
+		if got := test.tp.Resolve(r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: Resolve() = %+v, want %+v", i, got, test.want)
+		}
+	}
+}
+
+func TestTrustedProxiesMiddleware(t *testing.T) {
+	tp, err := NewTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *http.Request
+	h := tp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Real-Ip", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.RemoteAddr != "192.0.2.1:1234" || got.Header.Get("X-Forwarded-For") != "" || got.Header.Get("X-Real-Ip") != "" {
+		t.Errorf("untrusted peer: RemoteAddr = %q, header = %v", got.RemoteAddr, got.Header)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("Forwarded", `for="[2001:db8:cafe::17]:4711";proto=https;host=a.example`)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.RemoteAddr != "[2001:db8:cafe::17]:4711" || got.URL.Scheme != "https" || got.Host != "a.example" {
+		t.Errorf("trusted peer: RemoteAddr = %q, scheme = %q, host = %q", got.RemoteAddr, got.URL.Scheme, got.Host)
+	}
+	if r.RemoteAddr != "10.1.2.3:1234" {
+		t.Errorf("request of the caller modified: RemoteAddr = %q", r.RemoteAddr)
+	}
+}
@@ -7,9 +7,10 @@ import (
 	"github.com/searKing/golib/io_"
 	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
@@ -64,122 +65,135 @@ func ContentType(content io.Reader, name string) (ctype string, bufferedContent
 //
 // If the content's Seek method work: ServeContent uses
 // a seek to the end of the content to determine its size, and the param size is ignored. The same as http.ServeFile
-// If the content's Seek method doesn't work: ServeContent uses the param size
-// to generate a onlySizeSeekable as a pseudo io.ReadSeeker. If size < 0, use chunk or connection close instead
+// If the content's Seek method doesn't work: ServeContent reads the content
+// forward once, and the param size is its length. Ranges are served by
+// skipping the bytes in between, and overlapping or descending ranges from
+// the last MaxRangeBuffer bytes read; a multi-range request is answered with
+// a multipart/byteranges body. If size < 0, Range is ignored and the content
+// is sent chunked or until connection close.
 //
 // If the caller has set w's ETag header formatted per RFC 7232, section 2.3,
 // ServeContent uses it to handle requests using If-Match, If-None-Match, or If-Range.
+// Otherwise, for a content that is not an io.ReadSeeker, ServeContent sets
+// one generated by ETag from modtime and size.
 //
 // Note that *os.File implements the io.ReadSeeker interface.
 func ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.Reader, size int64) {
-	readseeker, seekable := content.(io.ReadSeeker)
-
-	// generate a onlySizeSeekable as a pseudo io.ReadSeeker
-	if !seekable {
-
-		rangeReq := r.Header.Get("Range")
-		if rangeReq != "" {
-			ranges, err := parseRange(rangeReq, size)
-			if err != nil {
-				if err == errNoOverlap {
-					w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
-				}
-				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
-				return
-			}
-			for _, r := range ranges {
-				if r.start != 0 {
-					// only Range: bytes=0- is supported for none seekable reader
-					http.Error(w, "range is not support", http.StatusRequestedRangeNotSatisfiable)
-					return
-				}
-			}
-		}
-
-		// Content-Type must be set here, avoid sniff in http.ServeContent for onlySizeSeekable later
-		// If Content-Type isn't set, use the file's extension to find it, but
-		// if the Content-Type is unset explicitly, do not sniff the type.
-		ctypes, haveType := w.Header()["Content-Type"]
-		var ctype string
-		if !haveType {
-			var err error
-			ctype, content, err = ContentType(content, name)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else if len(ctypes) > 0 {
-			ctype = ctypes[0]
-		}
-
-		w.Header().Set("Content-Type", ctype)
-
-		if size < 0 {
-			// to reject unsupported Range
-			w.Header().Del("Content-Length")
-			w.Header().Set("Content-Encoding", "chunked")
-
-			// Use HTTP Trunk or connection close later
-			defer func() {
-				if r.Method != "HEAD" {
-					_, _ = io.Copy(w, content)
-				}
-			}()
+	if stater, ok := content.(io_.Stater); ok {
+		if fi, err := stater.Stat(); err == nil {
+			modtime = fi.ModTime()
 		}
+	}
 
-		readseeker = newOnlySizeSeekable(content, size)
+	readseeker, seekable := content.(io.ReadSeeker)
+	if !seekable {
+		serveReader(w, r, name, modtime, content, size)
+		return
 	}
 
 	if size >= 0 {
 		readseeker = io_.LimitReadSeeker(readseeker, size)
 	}
+	http.ServeContent(w, r, name, modtime, readseeker)
+}
 
-	if stater, ok := content.(io_.Stater); ok {
-		if fi, err := stater.Stat(); err == nil {
-			modtime = fi.ModTime()
+// serveReader is ServeContent for a content read forward only.
+func serveReader(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.Reader, size int64) {
+	setLastModified(w, modtime)
+	if w.Header().Get("Etag") == "" {
+		if etag := ETag(modtime, size); etag != "" {
+			w.Header().Set("Etag", etag)
 		}
 	}
-	http.ServeContent(w, r, name, modtime, readseeker)
-
-	// Use HTTP Trunk or connection close by defer
-
-	return
-}
+	done, rangeReq := checkPreconditions(w, r, modtime)
+	if done {
+		return
+	}
 
-// can only be used for ServeContent
-type onlySizeSeekable struct {
-	r      io.Reader
-	size   int64
-	offset int64
-}
+	// If Content-Type isn't set, use the file's extension to find it, but
+	// if the Content-Type is unset explicitly, do not sniff the type.
+	ctypes, haveType := w.Header()["Content-Type"]
+	var ctype string
+	if !haveType {
+		var err error
+		ctype, content, err = ContentType(content, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+	} else if len(ctypes) > 0 {
+		ctype = ctypes[0]
+	}
 
-func newOnlySizeSeekable(r io.Reader, size int64) *onlySizeSeekable {
-	return &onlySizeSeekable{
-		r:    r,
-		size: size,
+	if size < 0 {
+		// Use HTTP Trunk or connection close
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusOK)
+		if r.Method != "HEAD" {
+			_, _ = io.Copy(w, content)
+		}
+		return
 	}
-}
 
-func (s *onlySizeSeekable) Seek(offset int64, whence int) (int64, error) {
-	if offset != 0 {
-		return 0, os.ErrInvalid
+	code := http.StatusOK
+	sendSize := size
+	ranges, err := parseRange(rangeReq, size)
+	if err != nil {
+		if err == errNoOverlap {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		}
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
 	}
-	if whence == io.SeekStart {
-		s.offset = 0
-		return s.offset, nil
+	rr, ranges := newRangesReader(content, ranges, size)
+	var mw *multipart.Writer
+	switch {
+	case len(ranges) == 1:
+		// RFC 7233, Section 4.1:
+		// "If a single part is being transferred, the server
+		// generating the 206 response MUST generate a
+		// Content-Range header field describing what range
+		// of the selected representation is enclosed, and a
+		// payload consisting of the range.
+		// ...
+		// A server MUST NOT generate a multipart response to
+		// a request for a single range, since a client that
+		// does not request multiple parts might not support
+		// multipart responses."
+		sendSize = ranges[0].length
+		code = http.StatusPartialContent
+		w.Header().Set("Content-Range", ranges[0].contentRange(size))
+	case len(ranges) > 1:
+		sendSize = rangesMIMESize(ranges, ctype, size)
+		code = http.StatusPartialContent
+		mw = multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	default:
+		ranges = []httpRange{{start: 0, length: size}}
 	}
-	if whence == io.SeekEnd {
-		s.offset = s.size
-		return s.offset, nil
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if w.Header().Get("Content-Encoding") == "" {
+		w.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
 	}
-	if whence == io.SeekCurrent {
-		return s.offset, nil
+	w.WriteHeader(code)
+	if r.Method == "HEAD" {
+		return
 	}
-	return s.offset, os.ErrInvalid
-}
 
-func (s *onlySizeSeekable) Read(p []byte) (n int, err error) {
-	n, err = s.r.Read(p)
-	s.offset += int64(n)
-	return n, err
+	if mw == nil {
+		_ = rr.copyRange(w, ranges[0])
+		return
+	}
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(ra.mimeHeader(ctype, size))
+		if err != nil {
+			return
+		}
+		if err := rr.copyRange(part, ra); err != nil {
+			return
+		}
+	}
+	mw.Close()
 }
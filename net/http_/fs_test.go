@@ -0,0 +1,116 @@
+package http_
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const serveContentData = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+var serveContentModtime = time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+var serveContentTests = []struct {
+	name   string
+	header map[string]string
+	code   int
+	body   string
+	parts  []string
+}{
+	{"full", nil, http.StatusOK, serveContentData, nil},
+	{"single", map[string]string{"Range": "bytes=10-14"}, http.StatusPartialContent, "abcde", nil},
+	{"suffix", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "xyz", nil},
+	{"ascending", map[string]string{"Range": "bytes=0-1,30-"}, http.StatusPartialContent, "", []string{"01", "uvwxyz"}},
+	{"overlapping", map[string]string{"Range": "bytes=10-14,2-11"}, http.StatusPartialContent, "", []string{"abcde", "23456789ab"}},
+	{"unsatisfiable", map[string]string{"Range": "bytes=100-"}, http.StatusRequestedRangeNotSatisfiable, "", nil},
+	{"if-none-match", map[string]string{"If-None-Match": ETag(serveContentModtime, int64(len(serveContentData)))}, http.StatusNotModified, "", nil},
+	{"if-match mismatch", map[string]string{"If-Match": `"other"`}, http.StatusPreconditionFailed, "", nil},
+	{"if-unmodified-since", map[string]string{"If-Unmodified-Since": serveContentModtime.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusPreconditionFailed, "", nil},
+	{"if-range mismatch", map[string]string{"Range": "bytes=10-14", "If-Range": `"other"`}, http.StatusOK, serveContentData, nil},
+	{"if-range match", map[string]string{"Range": "bytes=10-14", "If-Range": ETag(serveContentModtime, int64(len(serveContentData)))}, http.StatusPartialContent, "abcde", nil},
+}
+
+func TestServeContentReader(t *testing.T) {
+	for _, tt := range serveContentTests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		// hide Seek, so that the content is read forward only
+		content := struct{ io.Reader }{strings.NewReader(serveContentData)}
+		ServeContent(w, req, "data.txt", serveContentModtime, content, int64(len(serveContentData)))
+
+		if w.Code != tt.code {
+			t.Errorf("%s: code = %d, want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if tt.parts == nil {
+			if tt.code < 300 && w.Body.String() != tt.body {
+				t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+			}
+			continue
+		}
+		if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("%s: Content-Length = %s, body has %d bytes", tt.name, cl, w.Body.Len())
+		}
+		mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if mediaType != "multipart/byteranges" {
+			t.Errorf("%s: Content-Type = %q, want multipart/byteranges", tt.name, mediaType)
+			continue
+		}
+		mr := multipart.NewReader(w.Body, params["boundary"])
+		for i, want := range tt.parts {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("%s: part %d: %v", tt.name, i, err)
+			}
+			got, _ := ioutil.ReadAll(part)
+			if string(got) != want {
+				t.Errorf("%s: part %d = %q, want %q", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestServeContentReaderIgnoredRanges(t *testing.T) {
+	size := int64(len(serveContentData))
+	defer func(max int64) { MaxRangeBuffer = max }(MaxRangeBuffer)
+	MaxRangeBuffer = 8
+
+	for _, spec := range []string{
+		"bytes=0-,0-",      // larger than the content
+		"bytes=30-35,0-20", // buffers more than MaxRangeBuffer
+	} {
+		ranges, err := parseRange(spec, size)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		rr, ranges := newRangesReader(strings.NewReader(serveContentData), ranges, size)
+		if ranges != nil {
+			t.Errorf("%s: ranges %v served, want the whole content", spec, ranges)
+		}
+		if err := rr.copyRange(ioutil.Discard, httpRange{start: 0, length: size}); err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if n := len(rr.history); n != 0 {
+			t.Errorf("%s: buffered %d bytes of the whole content, want 0", spec, n)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Range", spec)
+		w := httptest.NewRecorder()
+		content := struct{ io.Reader }{strings.NewReader(serveContentData)}
+		ServeContent(w, req, "data.txt", serveContentModtime, content, size)
+		if w.Code != http.StatusOK || w.Body.String() != serveContentData {
+			t.Errorf("%s: code = %d, body = %q; want the whole content", spec, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package http_
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Chain returns h wrapped by middlewares, the first one outermost:
+//
+//	Chain(h, recovery.Middleware, accessLog.Middleware)
+//
+// serves as recovery.Middleware(accessLog.Middleware(h)).
+func Chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+var errNotHijacker = errors.New("http: ResponseWriter is not a Hijacker")
+
+// responseRecorder records the status and size of a response written
+// through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// Status returns the status of the response, 200 if it was written without
+// one, 0 if nothing was written yet.
+func (w *responseRecorder) Status() int {
+	return w.status
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errNotHijacker
+}
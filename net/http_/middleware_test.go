@@ -0,0 +1,204 @@
+package http_
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/searKing/golib/x/log"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCompressor(t *testing.T) {
+	large := strings.Repeat("compressible ", 200)
+	table := []struct {
+		body, contentType, acceptEncoding string
+		wantEncoding                      string
+	}{
+		{body: large, contentType: "text/plain; charset=utf-8", acceptEncoding: "gzip, deflate", wantEncoding: "gzip"},
+		{body: large, contentType: "application/json", acceptEncoding: "gzip;q=0.5, deflate", wantEncoding: "deflate"},
+		{body: large, contentType: "application/json", acceptEncoding: "*", wantEncoding: "gzip"},
+		{body: large, contentType: "application/json", acceptEncoding: "gzip;q=0, identity"},
+		{body: large, contentType: "image/png", acceptEncoding: "gzip"},
+		{body: "small", contentType: "text/plain", acceptEncoding: "gzip"},
+		{body: large, contentType: "text/plain"},
+	}
+	for i, test := range table {
+		h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			for j := 0; j < len(test.body); j += 100 {
+				end := j + 100
+				if end > len(test.body) {
+					end = len(test.body)
+				}
+				w.Write([]byte(test.body[j:end]))
+			}
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != test.wantEncoding {
+			t.Errorf("#%d: Content-Encoding = %q, want %q", i, got, test.wantEncoding)
+			continue
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("#%d: Vary = %q", i, got)
+		}
+		body := w.Body.Bytes()
+		if test.wantEncoding == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		if test.wantEncoding != "deflate" && string(body) != test.body {
+			t.Errorf("#%d: body of %d bytes, want %d", i, len(body), len(test.body))
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	c := &CORS{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.org"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Content-Type"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	served := false
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = true }))
+
+	table := []struct {
+		method, origin, requestMethod, requestHeaders string
+		wantOrigin, wantMaxAge                        string
+		wantServed                                    bool
+	}{
+		{method: http.MethodGet, origin: "https://example.com", wantOrigin: "https://example.com", wantServed: true},
+		{method: http.MethodGet, origin: "https://api.example.org", wantOrigin: "https://api.example.org", wantServed: true},
+		{method: http.MethodGet, origin: "https://evil.com", wantServed: true},
+		{method: http.MethodGet, origin: "https://example.org", wantServed: true},
+		{method: http.MethodOptions, origin: "https://example.com", requestMethod: http.MethodPut, requestHeaders: "content-type",
+			wantOrigin: "https://example.com", wantMaxAge: "600"},
+		{method: http.MethodOptions, origin: "https://example.com", requestMethod: http.MethodDelete},
+		{method: http.MethodOptions, origin: "https://example.com", requestMethod: http.MethodPut, requestHeaders: "X-Secret"},
+	}
+	for i, test := range table {
+		served = false
+		r := httptest.NewRequest(test.method, "/", nil)
+		r.Header.Set("Origin", test.origin)
+		if test.requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", test.requestMethod)
+		}
+		if test.requestHeaders != "" {
+			r.Header.Set("Access-Control-Request-Headers", test.requestHeaders)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.wantOrigin {
+			t.Errorf("#%d: Access-Control-Allow-Origin = %q, want %q", i, got, test.wantOrigin)
+		}
+		if got := w.Header().Get("Access-Control-Max-Age"); got != test.wantMaxAge {
+			t.Errorf("#%d: Access-Control-Max-Age = %q, want %q", i, got, test.wantMaxAge)
+		}
+		if served != test.wantServed {
+			t.Errorf("#%d: served = %v, want %v", i, served, test.wantServed)
+		}
+	}
+}
+
+func TestRequestIDRecoveryAccessLog(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	var seen string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := Chain(mux,
+		(&RequestID{Generate: func() string { return "generated" }}).Middleware,
+		(&Recovery{FieldLogger: log.New(logger)}).Middleware,
+		(&AccessLog{FieldLogger: log.New(logger)}).Middleware)
+
+	table := []struct {
+		target, requestID string
+		wantID            string
+		wantStatus        int
+		wantLevels        []logrus.Level
+	}{
+		{target: "/ok", requestID: "abc", wantID: "abc", wantStatus: http.StatusOK, wantLevels: []logrus.Level{logrus.InfoLevel}},
+		{target: "/ok", requestID: "bad\nid", wantID: "generated", wantStatus: http.StatusOK, wantLevels: []logrus.Level{logrus.InfoLevel}},
+		{target: "/panic", wantID: "generated", wantStatus: http.StatusInternalServerError,
+			wantLevels: []logrus.Level{logrus.ErrorLevel, logrus.ErrorLevel}},
+	}
+	for i, test := range table {
+		hook.Reset()
+		seen = ""
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		if test.requestID != "" {
+			r.Header.Set(DefaultRequestIDHeader, test.requestID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.wantStatus {
+			t.Errorf("#%d: status = %d, want %d", i, w.Code, test.wantStatus)
+		}
+		if got := w.Header().Get(DefaultRequestIDHeader); got != test.wantID {
+			t.Errorf("#%d: response request ID = %q, want %q", i, got, test.wantID)
+		}
+		if test.wantStatus == http.StatusOK && seen != test.wantID {
+			t.Errorf("#%d: context request ID = %q, want %q", i, seen, test.wantID)
+		}
+		entries := hook.AllEntries()
+		if len(entries) != len(test.wantLevels) {
+			t.Errorf("#%d: %d log entries, want %d", i, len(entries), len(test.wantLevels))
+			continue
+		}
+		for j, e := range entries {
+			if e.Level != test.wantLevels[j] {
+				t.Errorf("#%d: entry %d level = %v, want %v", i, j, e.Level, test.wantLevels[j])
+			}
+			if e.Data["request_id"] != test.wantID {
+				t.Errorf("#%d: entry %d request_id = %v, want %q", i, j, e.Data["request_id"], test.wantID)
+			}
+		}
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(DefaultRequestIDHeader)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req.WithContext(WithRequestID(req.Context(), "abc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "abc" {
+		t.Errorf("request ID = %q, want %q", got, "abc")
+	}
+	if req.Header.Get(DefaultRequestIDHeader) != "" {
+		t.Error("request of the caller modified")
+	}
+}
@@ -8,7 +8,8 @@ import (
 // GetProxySchemeAndHost extracts the host and used protocol (either HTTP or HTTPS)
 // from the given request. If `allowForwarded` is set, the X-Forwarded-Host,
 // X-Forwarded-Proto and Forwarded headers will also be checked to
-// support proxies.
+// support proxies, whoever sent them; use TrustedProxies.Resolve to only
+// trust known proxies.
 func GetProxySchemeAndHost(r *http.Request, allowForwarded bool) (scheme, host string) {
 	if r == nil {
 		return
@@ -33,13 +34,13 @@ func GetProxySchemeAndHost(r *http.Request, allowForwarded bool) (scheme, host s
 		scheme = h
 	}
 
-	if h := r.Header.Get("Forwarded"); h != "" {
-		if r := reForwardedHost.FindStringSubmatch(h); len(r) == 2 {
-			host = r[1]
+	// the first element is the one of the proxy nearest to the client
+	if elems, err := ParseForwarded(r.Header["Forwarded"]); err == nil && len(elems) > 0 {
+		if h := elems[0].Host; h != "" {
+			host = h
 		}
-
-		if r := reForwardedProto.FindStringSubmatch(h); len(r) == 2 {
-			scheme = r[1]
+		if h := elems[0].Proto; h == "http" || h == "https" {
+			scheme = h
 		}
 	}
 
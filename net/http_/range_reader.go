@@ -0,0 +1,126 @@
+package http_
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// MaxRangeBuffer bounds the bytes ServeContent keeps in memory to serve
+// overlapping or descending ranges from a content that is not an
+// io.ReadSeeker. Range requests needing more are answered with the whole
+// content, as RFC 7233 allows.
+var MaxRangeBuffer int64 = 1 << 20
+
+var errRangeEvicted = errors.New("range: bytes already read and evicted")
+
+// rangesBufferSize returns the bytes a rangeReader must remember to serve
+// ranges in order from a forward-only reader: 0 if ranges are ascending
+// and disjoint.
+func rangesBufferSize(ranges []httpRange) int64 {
+	var offset, buffer int64
+	for _, ra := range ranges {
+		if back := offset - ra.start; back > buffer {
+			buffer = back
+		}
+		if end := ra.start + ra.length; end > offset {
+			offset = end
+		}
+	}
+	return buffer
+}
+
+// newRangesReader returns a rangeReader of content for ranges, and the
+// ranges to serve, nil if the whole content must be served instead.
+func newRangesReader(content io.Reader, ranges []httpRange, size int64) (*rangeReader, []httpRange) {
+	bufSize := rangesBufferSize(ranges)
+	if sumRangesSize(ranges) > size || bufSize > MaxRangeBuffer {
+		// The total number of bytes in all the ranges is larger than the
+		// size of the file, or the ranges can't be read in one forward pass,
+		// so ignore the range request, and remember nothing of the content.
+		return newRangeReader(content, 0), nil
+	}
+	return newRangeReader(content, bufSize), ranges
+}
+
+// rangeReader serves byte ranges in any order from a forward-only reader.
+// Bytes before the next range are skipped, and the last max bytes read are
+// kept to serve ranges starting before the current offset.
+type rangeReader struct {
+	r       io.Reader
+	offset  int64  // bytes read from r
+	history []byte // the last bytes read, ending at offset
+	max     int64
+	buf     []byte
+}
+
+func newRangeReader(r io.Reader, max int64) *rangeReader {
+	return &rangeReader{r: r, max: max, buf: make([]byte, 32<<10)}
+}
+
+// copyRange writes the bytes of ra to w.
+func (rr *rangeReader) copyRange(w io.Writer, ra httpRange) error {
+	start, end := ra.start, ra.start+ra.length
+	if start < rr.offset {
+		histStart := rr.offset - int64(len(rr.history))
+		if start < histStart {
+			return errRangeEvicted
+		}
+		stop := end
+		if stop > rr.offset {
+			stop = rr.offset
+		}
+		if _, err := w.Write(rr.history[start-histStart : stop-histStart]); err != nil {
+			return err
+		}
+		start = stop
+	}
+	if start > rr.offset {
+		if err := rr.copy(ioutil.Discard, start-rr.offset); err != nil {
+			return err
+		}
+	}
+	if end > start {
+		return rr.copy(w, end-start)
+	}
+	return nil
+}
+
+// copy reads n bytes forward and writes them to w.
+func (rr *rangeReader) copy(w io.Writer, n int64) error {
+	for n > 0 {
+		p := rr.buf
+		if int64(len(p)) > n {
+			p = p[:n]
+		}
+		m, err := io.ReadFull(rr.r, p)
+		rr.remember(p[:m])
+		rr.offset += int64(m)
+		n -= int64(m)
+		if _, werr := w.Write(p[:m]); werr != nil {
+			return werr
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (rr *rangeReader) remember(p []byte) {
+	if rr.max <= 0 {
+		return
+	}
+	if int64(len(p)) >= rr.max {
+		rr.history = append(rr.history[:0], p[int64(len(p))-rr.max:]...)
+		return
+	}
+	if over := int64(len(rr.history)+len(p)) - rr.max; over > 0 {
+		n := copy(rr.history, rr.history[over:])
+		rr.history = rr.history[:n]
+	}
+	rr.history = append(rr.history, p...)
+}
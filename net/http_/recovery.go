@@ -0,0 +1,69 @@
+package http_
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/searKing/golib/x/log"
+)
+
+// Recovery recovers the panics of handlers: it logs them with their stack
+// and answers 500 Internal Server Error, if the response is not started.
+// The http.ErrAbortHandler panic is passed on, to abort the response.
+type Recovery struct {
+	// OnPanic, if non-nil, is called with the recovered value and the stack
+	// of the panic, instead of logging them to FieldLogger.
+	OnPanic func(r *http.Request, v interface{}, stack []byte)
+
+	*log.FieldLogger
+}
+
+// Middleware recovers the panics of h.
+func (rec *Recovery) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseRecorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			stack := debug.Stack()
+			if rec.OnPanic != nil {
+				rec.OnPanic(r, v, stack)
+			} else {
+				rec.GetLogger().WithField("request_id", requestID(r, w)).
+					Errorf("http: panic serving %s %s: %v\n%s", r.Method, r.URL, v, stack)
+			}
+			if rw.Status() == 0 {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// Recover recovers the panics of h with a zero Recovery.
+func Recover(h http.Handler) http.Handler {
+	return (&Recovery{}).Middleware(h)
+}
+
+// requestID returns the request ID of r, from its context or, if the
+// RequestID middleware runs inside, from the response header.
+func requestID(r *http.Request, w http.ResponseWriter) string {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	return w.Header().Get(DefaultRequestIDHeader)
+}
+
+// panicError is the error of a recovered panic value.
+func panicError(v interface{}) error {
+	if err, ok := v.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", v)
+}
@@ -0,0 +1,116 @@
+package http_
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRequestIDHeader is the header of request IDs.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen is the length of the longest incoming request ID kept.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID of ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID gives every request an ID: the one of its request ID header,
+// or a new one. The ID is put in the context of the request, see
+// RequestIDFromContext, and in the header of the response.
+type RequestID struct {
+	// Header is the header of the IDs. If empty, DefaultRequestIDHeader is used.
+	Header string
+	// Generate returns new IDs. If nil, random UUIDs are.
+	Generate func() string
+	// IgnoreIncoming makes new IDs for all requests, as for requests from
+	// untrusted clients.
+	IgnoreIncoming bool
+}
+
+func (rid *RequestID) header() string {
+	if rid.Header == "" {
+		return DefaultRequestIDHeader
+	}
+	return rid.Header
+}
+
+func (rid *RequestID) generate() string {
+	if rid.Generate == nil {
+		return uuid.New().String()
+	}
+	return rid.Generate()
+}
+
+// Middleware sets the request ID of the requests to h.
+func (rid *RequestID) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := rid.header()
+		id := r.Header.Get(key)
+		if rid.IgnoreIncoming || !validRequestID(id) {
+			id = rid.generate()
+			r.Header.Set(key, id)
+		}
+		w.Header().Set(key, id)
+		h.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is a non-empty printable ASCII string
+// no longer than maxRequestIDLen, to be logged and sent back safely.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDTransport propagates the request ID of the context of requests
+// in their request ID header.
+type RequestIDTransport struct {
+	// Header is the header of the IDs. If empty, DefaultRequestIDHeader is used.
+	Header string
+	// Base is the RoundTripper sending the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	key := t.Header
+	if key == "" {
+		key = DefaultRequestIDHeader
+	}
+	id := RequestIDFromContext(req.Context())
+	if id == "" || req.Header.Get(key) != "" {
+		return base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		req2.Header[k] = v
+	}
+	req2.Header.Set(key, id)
+	return base.RoundTrip(req2)
+}
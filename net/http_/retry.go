@@ -0,0 +1,318 @@
+package http_
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/searKing/golib/time_"
+)
+
+// DefaultRetryableStatusCodes are the response codes retried by a
+// RetryPolicy without RetryableStatusCodes.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// A RetryPolicy tells a RetryTransport which requests to retry and how
+// long to wait in between.
+// The zero value retries idempotent requests up to 3 times on connection
+// errors and DefaultRetryableStatusCodes.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	// If zero, 3 is used; if negative, requests are never retried.
+	MaxRetries int
+
+	// RetryableStatusCodes lists the response codes worth a retry.
+	// If nil, DefaultRetryableStatusCodes is used.
+	RetryableStatusCodes []int
+
+	// RetryableError reports whether a transport error is worth a retry.
+	// If nil, IsRetryableError is used.
+	RetryableError func(err error) bool
+
+	// InitDelay and MaxDelay bound the exponential backoff between
+	// attempts. Zero values mean 100ms and 10s.
+	InitDelay time.Duration
+	MaxDelay  time.Duration
+	// DisableJitter waits the full backoff instead of a random duration
+	// between half of it and all of it.
+	DisableJitter bool
+
+	// MaxRetryAfter caps how long a Retry-After response header may make
+	// the transport wait. A response asking for longer is returned as is.
+	// If zero, MaxDelay is used.
+	MaxRetryAfter time.Duration
+
+	// RetryNonIdempotent allows retrying POST, PATCH and CONNECT requests
+	// that carry no Idempotency-Key or X-Idempotency-Key header.
+	RetryNonIdempotent bool
+
+	// Budget, if non-nil, limits the overall share of retries, and may be
+	// shared by several policies.
+	Budget *RetryBudget
+}
+
+func (p *RetryPolicy) maxRetries() int {
+	if p.MaxRetries == 0 {
+		return 3
+	}
+	return p.MaxRetries
+}
+
+func (p *RetryPolicy) retryableStatus(code int) bool {
+	codes := p.RetryableStatusCodes
+	if codes == nil {
+		codes = DefaultRetryableStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryableError(err error) bool {
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return IsRetryableError(err)
+}
+
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter > 0 {
+		return p.MaxRetryAfter
+	}
+	return durationOr(p.MaxDelay, 10*time.Second)
+}
+
+func (p *RetryPolicy) newDelay() *time_.Delay {
+	return &time_.Delay{
+		InitDuration: durationOr(p.InitDelay, 100*time.Millisecond),
+		MaxDuration:  durationOr(p.MaxDelay, 10*time.Second),
+		DelayAgainHandler: func(delay time.Duration) time.Duration {
+			return delay * time_.DefaultStepTimes
+		},
+	}
+}
+
+func (p *RetryPolicy) jitter(d time.Duration) time.Duration {
+	if p.DisableJitter || d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// idempotent reports whether req may be sent again without side effects,
+// following net/http.Transport.
+func (p *RetryPolicy) idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := req.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return p.RetryNonIdempotent
+}
+
+// IsRetryableError reports whether err, returned by a RoundTripper, is a
+// transient network failure such as a reset or refused connection.
+// Canceled and expired contexts are not retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	switch err := err.(type) {
+	case *url.Error:
+		return IsRetryableError(err.Err)
+	case *net.OpError:
+		return IsRetryableError(err.Err)
+	case *os.SyscallError:
+		return IsRetryableError(err.Err)
+	case syscall.Errno:
+		return err == syscall.ECONNRESET || err == syscall.ECONNREFUSED || err == syscall.ECONNABORTED || err == syscall.EPIPE
+	case net.Error:
+		return err.Timeout()
+	}
+	return false
+}
+
+// ParseRetryAfter parses a Retry-After header value, either a number of
+// seconds or an HTTP date, into the duration to wait from now.
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// A RetryBudget caps retries to a ratio of the requests sent, plus a
+// minimum number of retries per second, so that retries cannot amplify
+// an outage. It is safe for concurrent use.
+type RetryBudget struct {
+	// Ratio is the number of retries allowed per request, e.g. 0.1.
+	Ratio float64
+	// MinPerSecond is the number of retries always allowed per second.
+	MinPerSecond int
+
+	mu       sync.Mutex
+	balance  float64
+	lastFill time.Time
+}
+
+// deposit credits the budget for one request.
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance += b.Ratio
+	if max := b.Ratio*100 + 1; b.balance > max {
+		b.balance = max
+	}
+}
+
+// withdraw reports whether a retry fits in the budget, and debits it.
+func (b *RetryBudget) withdraw(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.MinPerSecond > 0 && now.Sub(b.lastFill) >= time.Second {
+		b.lastFill = now
+		if min := float64(b.MinPerSecond); b.balance < min {
+			b.balance = min
+		}
+	}
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
+
+// A RetryTransport is an http.RoundTripper that retries failed requests
+// according to its Policy. Request bodies are replayed through
+// http.Request.GetBody; requests with a body but no GetBody are never
+// retried.
+type RetryTransport struct {
+	// Base is the RoundTripper doing the requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Policy decides what to retry. If nil, the zero RetryPolicy is used.
+	Policy *RetryPolicy
+}
+
+func (t *RetryTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.Policy
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	if policy.Budget != nil {
+		policy.Budget.deposit()
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	canRetry := replayable && policy.idempotent(req) && policy.maxRetries() > 0
+
+	delay := policy.newDelay()
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = cloneRequest(req)
+			r.Body = body
+		}
+		resp, err := t.base().RoundTrip(r)
+		if !canRetry || attempt >= policy.maxRetries() {
+			return resp, err
+		}
+
+		var wait time.Duration
+		if err != nil {
+			if !policy.retryableError(err) {
+				return resp, err
+			}
+		} else {
+			if !policy.retryableStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			if d, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if d > policy.maxRetryAfter() {
+					return resp, nil
+				}
+				wait = d
+			}
+		}
+		if policy.Budget != nil && !policy.Budget.withdraw(time.Now()) {
+			return resp, err
+		}
+		if resp != nil {
+			// drain so the connection can be reused
+			io.CopyN(ioutil.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		}
+
+		delay.Update()
+		if d := policy.jitter(delay.Duration()); d > wait {
+			wait = d
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// cloneRequest returns a shallow copy of req with its own Header.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	return r
+}
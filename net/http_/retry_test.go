@@ -0,0 +1,85 @@
+package http_
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var parseRetryAfterTests = []struct {
+	in   string
+	want time.Duration
+	ok   bool
+}{
+	{"", 0, false},
+	{"3", 3 * time.Second, true},
+	{"-1", 0, false},
+	{"Mon, 02 Jan 2006 15:04:10 GMT", 5 * time.Second, true},
+	{"Mon, 02 Jan 2006 15:04:00 GMT", 0, true},
+	{"soon", 0, false},
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	for _, tt := range parseRetryAfterTests {
+		got, ok := ParseRetryAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	policy := &RetryPolicy{InitDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	client := &http.Client{Transport: &RetryTransport{Policy: policy}}
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" || hits != 3 {
+		t.Errorf("got %d %q after %d hits, want 200 %q after 3", resp.StatusCode, body, hits, "payload")
+	}
+
+	// POST is not idempotent, so the first 503 is returned as is.
+	atomic.StoreInt32(&hits, 0)
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || hits != 1 {
+		t.Errorf("POST got %d after %d hits, want 503 after 1", resp.StatusCode, hits)
+	}
+
+	// An empty budget allows no retries.
+	atomic.StoreInt32(&hits, 0)
+	policy.Budget = &RetryBudget{}
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits != 1 {
+		t.Errorf("got %d hits with an empty budget, want 1", hits)
+	}
+}
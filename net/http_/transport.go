@@ -0,0 +1,207 @@
+package http_
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Schemes of URLs served over a unix domain socket, see SplitUnixURL.
+const (
+	SchemeHTTPUnix  = "http+unix"
+	SchemeHTTPSUnix = "https+unix"
+)
+
+// unixHost is the Host of requests sent over a unix domain socket.
+const unixHost = "unix"
+
+// SplitUnixURL splits a URL of the form
+//
+//	http+unix://<socket>/<path>?<query>
+//
+// into the socket to dial and the URL to request over it, http://unix/<path>?<query>.
+// <socket> is a percent-encoded path, such as %2Fvar%2Frun%2Fdocker.sock;
+// a leading @ names a Linux abstract socket.
+// https+unix works likewise.
+//
+// The legacy form http://unix:<socket>/<path>, whose host starts with "unix:",
+// is accepted too: the host is the socket to dial, and reqURL is rawurl.
+// ok is false if rawurl is none of these URLs.
+func SplitUnixURL(rawurl string) (socket, reqURL string, ok bool, err error) {
+	var scheme string
+	switch {
+	case strings.HasPrefix(rawurl, SchemeHTTPUnix+"://"):
+		scheme = "http"
+	case strings.HasPrefix(rawurl, SchemeHTTPSUnix+"://"):
+		scheme = "https"
+	default:
+		if u, err := parseURL(rawurl); err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+			(strings.HasPrefix(u.Host, "unix:") || strings.HasPrefix(u.Hostname(), "unix:")) {
+			return u.Host, rawurl, true, nil
+		}
+		return "", rawurl, false, nil
+	}
+	rest := rawurl[strings.Index(rawurl, "://")+len("://"):]
+	host, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host, tail = rest[:i], rest[i:]
+	}
+	socket, err = url.PathUnescape(host)
+	if err != nil {
+		return "", "", true, err
+	}
+	if socket == "" {
+		return "", "", true, fmt.Errorf("http: missing unix socket in %q", rawurl)
+	}
+	return socket, scheme + "://" + unixHost + tail, true, nil
+}
+
+// A ClientFactory builds http.Clients that share one http.Transport per
+// dial target, so connections are pooled and reused across calls.
+// Targets are a unix domain socket, or a scheme and host.
+//
+// The zero value is ready to use. Fields must not be changed after the
+// first call.
+type ClientFactory struct {
+	// Timeout is the http.Client.Timeout of the clients built.
+	Timeout time.Duration
+
+	// DialTimeout and KeepAlive configure the net.Dialer used by each
+	// Transport. Zero values mean 30s, as for http.DefaultTransport.
+	DialTimeout time.Duration
+	KeepAlive   time.Duration
+
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	DisableCompression    bool
+
+	// TLSClientConfig is the TLS configuration of https targets.
+	TLSClientConfig *tls.Config
+	// HTTP2 enables HTTP/2 over TLS. The Transports built dial with their
+	// own DialContext, which disables the HTTP/2 net/http enables by
+	// default, so they speak HTTP/1.1 only unless HTTP2 is set.
+	HTTP2 bool
+	// Proxy returns the proxy of a request, see http.Transport.Proxy.
+	// If nil, http.ProxyFromEnvironment is used. Requests over unix domain
+	// sockets are never proxied.
+	Proxy func(*http.Request) (*url.URL, error)
+	// RetryPolicy, if non-nil, makes the clients built retry failed
+	// requests through a RetryTransport.
+	RetryPolicy *RetryPolicy
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// DefaultClientFactory is the ClientFactory used by Client, Get, Post,
+// Head and PostForm, and their Context variants.
+var DefaultClientFactory = &ClientFactory{}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d != 0 {
+		return d
+	}
+	return def
+}
+
+// Client returns a client for rawurl, which may be an http+unix or
+// https+unix URL, see SplitUnixURL. Clients for unix domain sockets dial
+// the socket whatever the request URL, so they can be used with the URL
+// returned by SplitUnixURL.
+func (f *ClientFactory) Client(rawurl string) (*http.Client, error) {
+	tr, err := f.Transport(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if f.RetryPolicy != nil {
+		return &http.Client{Transport: &RetryTransport{Base: tr, Policy: f.RetryPolicy}, Timeout: f.Timeout}, nil
+	}
+	return &http.Client{Transport: tr, Timeout: f.Timeout}, nil
+}
+
+// Transport returns the cached Transport of the target of rawurl,
+// creating it on first use.
+func (f *ClientFactory) Transport(rawurl string) (*http.Transport, error) {
+	socket, _, isUnix, err := SplitUnixURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if isUnix {
+		key = "unix:" + socket
+	} else {
+		u, err := parseURL(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		key = u.Scheme + "://" + u.Host
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if tr, ok := f.transports[key]; ok {
+		return tr, nil
+	}
+	tr, err := f.newTransport(socket, isUnix)
+	if err != nil {
+		return nil, err
+	}
+	if f.transports == nil {
+		f.transports = make(map[string]*http.Transport)
+	}
+	f.transports[key] = tr
+	return tr, nil
+}
+
+func (f *ClientFactory) newTransport(socket string, isUnix bool) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   durationOr(f.DialTimeout, 30*time.Second),
+		KeepAlive: durationOr(f.KeepAlive, 30*time.Second),
+	}
+	tr := &http.Transport{
+		Proxy:                 f.Proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       f.TLSClientConfig,
+		TLSHandshakeTimeout:   durationOr(f.TLSHandshakeTimeout, 10*time.Second),
+		ResponseHeaderTimeout: f.ResponseHeaderTimeout,
+		IdleConnTimeout:       durationOr(f.IdleConnTimeout, 90*time.Second),
+		MaxIdleConnsPerHost:   f.MaxIdleConnsPerHost,
+		MaxIdleConns:          100,
+		ExpectContinueTimeout: time.Second,
+		DisableCompression:    f.DisableCompression,
+	}
+	if tr.Proxy == nil {
+		tr.Proxy = http.ProxyFromEnvironment
+	}
+	if isUnix {
+		tr.Proxy = nil
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	if f.HTTP2 {
+		if err := http2.ConfigureTransport(tr); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+// CloseIdleConnections closes the idle connections of every cached Transport.
+func (f *ClientFactory) CloseIdleConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, tr := range f.transports {
+		tr.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,111 @@
+package http_
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var splitUnixURLTests = []struct {
+	in     string
+	socket string
+	reqURL string
+	ok     bool
+}{
+	{"http://example.com/a", "", "http://example.com/a", false},
+	{"http+unix://%2Fvar%2Frun%2Fdocker.sock/containers/json?all=1", "/var/run/docker.sock", "http://unix/containers/json?all=1", true},
+	{"https+unix://%40abstract", "@abstract", "https://unix", true},
+	{"http://unix:8080/a", "unix:8080", "http://unix:8080/a", true},
+	{"http://unixy:8080/a", "", "http://unixy:8080/a", false},
+}
+
+func TestSplitUnixURL(t *testing.T) {
+	for _, tt := range splitUnixURLTests {
+		socket, reqURL, ok, err := SplitUnixURL(tt.in)
+		if err != nil {
+			t.Errorf("SplitUnixURL(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if socket != tt.socket || reqURL != tt.reqURL || ok != tt.ok {
+			t.Errorf("SplitUnixURL(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.in, socket, reqURL, ok, tt.socket, tt.reqURL, tt.ok)
+		}
+	}
+}
+
+func TestGetContextUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "s.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	u := "http+unix://" + strings.Replace(socket, "/", "%2F", -1) + "/ping"
+	for i := 0; i < 2; i++ {
+		resp, err := GetContext(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "/ping" {
+			t.Errorf("body = %q, want %q", body, "/ping")
+		}
+	}
+	tr1, _ := DefaultClientFactory.Transport(u)
+	tr2, _ := DefaultClientFactory.Transport(u + "?again")
+	if tr1 != tr2 {
+		t.Error("Transport is not reused for the same socket")
+	}
+}
+
+func TestGetContextLegacyUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the legacy form dials the host as a path relative to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	ln, err := net.Listen("unix", "unix:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	resp, err := GetContext(context.Background(), "http://unix:80/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "unix:80/ping" {
+		t.Errorf("body = %q, want %q", body, "unix:80/ping")
+	}
+}
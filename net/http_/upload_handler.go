@@ -6,7 +6,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/searKing/golib/x/log"
 	"github.com/searKing/tusd"
-	"github.com/searKing/tusd/filestore"
 	"io"
 	"math"
 	"net"
@@ -23,10 +22,8 @@ import (
 const UploadLengthDeferred = "1"
 
 var (
-	reExtractFileID  = regexp.MustCompile(`([^/]+)\/?$`)
-	reForwardedHost  = regexp.MustCompile(`host=([^,]+)`)
-	reForwardedProto = regexp.MustCompile(`proto=(https?)`)
-	reMimeType       = regexp.MustCompile(`^[a-z]+\/[a-z\-\+0-9]+$`)
+	reExtractFileID = regexp.MustCompile(`([^/]+)\/?$`)
+	reMimeType      = regexp.MustCompile(`^[a-z]+\/[a-z\-\+0-9]+$`)
 )
 
 // UploadHandler exposes methods to handle requests as part of the tus protocol,
@@ -41,6 +38,9 @@ type UploadHandler struct {
 	// If no trailing slash is presented it will be added. You may specify an
 	// absolute URL containing a scheme, e.g. "http://tus.io"
 	BasePath *url.URL
+	// TrustedProxies, if non-nil, are the proxies whose forwarded headers
+	// are used for the Location of uploads; if nil, anyone's are.
+	TrustedProxies *TrustedProxies
 
 	*log.FieldLogger
 
@@ -216,6 +216,7 @@ func (handler *UploadHandler) PostFile(w http.ResponseWriter, r *http.Request) {
 		ID:             uploadId,
 		SizeIsDeferred: true,
 		IsFinal:        true,
+		MetaData:       uploadMetaData(r),
 	}
 
 	id, err := handler.composer.Core.NewUpload(info)
@@ -360,6 +361,7 @@ func (handler *UploadHandler) PutFile(w http.ResponseWriter, r *http.Request) {
 		ID:             id,
 		SizeIsDeferred: true,
 		IsFinal:        true,
+		MetaData:       uploadMetaData(r),
 	}
 
 	id, err = handler.composer.Core.NewUpload(info)
@@ -533,7 +535,7 @@ func (handler *UploadHandler) PatchFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	// check if seek is needed, else only append mode can be done
-	if _, ok := handler.composer.Core.(filestore.FileStore); !ok {
+	if !writesAtOffset(handler.composer.Core) {
 		for _, ra := range ranges {
 			if ra.firstBytePos != info.Offset {
 				handler.sendResp(w, r, http.StatusRequestedRangeNotSatisfiable)
@@ -678,6 +680,29 @@ func extractFileInfo(info tusd.FileInfo) (filetype string, filename string) {
 	return filetype, filename
 }
 
+// uploadMetaData returns the metadata of an upload from the Upload-Metadata
+// header of r, completing "filename" and "filetype" with the file part of
+// a multipart form, or the Content-Type of r.
+func uploadMetaData(r *http.Request) tusd.MetaData {
+	meta := tusd.MetaData(tusd.ParseMetadataHeader(r.Header.Get("Upload-Metadata")))
+	if meta["filename"] != "" && meta["filetype"] != "" {
+		return meta
+	}
+	if _, fh, err := r.FormFile("file"); err == nil {
+		if meta["filename"] == "" && fh.Filename != "" {
+			meta["filename"] = fh.Filename
+		}
+		if meta["filetype"] == "" && fh.Header.Get("Content-Type") != "" {
+			meta["filetype"] = fh.Header.Get("Content-Type")
+		}
+		return meta
+	}
+	if ct := r.Header.Get("Content-Type"); meta["filetype"] == "" && ct != "" && !strings.HasPrefix(ct, "multipart/") {
+		meta["filetype"] = ct
+	}
+	return meta
+}
+
 // writeChunk reads the body from the requests r and appends it to the upload
 // with the corresponding id. Afterwards, it will set the necessary response
 // headers but will not send the response.
@@ -820,6 +845,9 @@ func (handler *UploadHandler) absFileURL(r *http.Request, id string) (string, er
 	}
 	fileUrl = r.URL.ResolveReference(fileUrl)
 
+	if handler.TrustedProxies != nil {
+		return handler.TrustedProxies.ResolveURL(fileUrl, r).String(), nil
+	}
 	fileProxyUrl := ResolveProxyUrl(fileUrl, r, true)
 
 	return fileProxyUrl.String(), nil
@@ -0,0 +1,261 @@
+package http_
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/searKing/tusd"
+)
+
+// StatusChecksumMismatch is the status of a rejected checksum, as in the
+// tus checksum extension.
+const StatusChecksumMismatch = 460
+
+var (
+	ErrQuotaExceeded         = tusd.NewHTTPError(errors.New("upload quota exceeded"), http.StatusRequestEntityTooLarge)
+	ErrContentTypeNotAllowed = tusd.NewHTTPError(errors.New("content type not allowed"), http.StatusUnsupportedMediaType)
+	ErrChecksumMismatch      = tusd.NewHTTPError(errors.New("checksum mismatch"), StatusChecksumMismatch)
+	ErrUnsupportedChecksum   = tusd.NewHTTPError(errors.New("unsupported checksum algorithm"), http.StatusBadRequest)
+	errChecksumNoReader      = errors.New("http: checksum verification needs a store with GetReader")
+)
+
+// checksumAlgorithms are the algorithms of a checksum metadata, by name.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HookedUploadStore wraps an UploadStore with checks on uploads: a maximum
+// size, a quota, an allowlist of content types and a checksum verified
+// once the upload completes.
+// Use its UseIn in place of the one of Store.
+type HookedUploadStore struct {
+	Store UploadStore
+
+	// MaxUploadSize rejects uploads larger than it, declared or written,
+	// with ErrQuotaExceeded. Zero means no limit.
+	MaxUploadSize int64
+
+	// Quota, if non-nil, returns how many more bytes may be stored for
+	// an upload, for example the space left to its owner, named in its
+	// metadata; a negative value means no limit. It is called when the
+	// upload is created, and before each chunk is written.
+	Quota func(info tusd.FileInfo) (remaining int64, err error)
+
+	// AllowedContentTypes, if non-empty, lists the media types an upload
+	// may declare in its "filetype" metadata, such as "image/png" or
+	// "image/*". Other uploads are rejected with ErrContentTypeNotAllowed.
+	AllowedContentTypes []string
+
+	// VerifyChecksum, if non-nil, is called with the content of each
+	// completed upload, before the upload is finished. An error terminates
+	// the upload and is sent to the client; VerifyMetadataChecksum is
+	// such a func.
+	VerifyChecksum func(info tusd.FileInfo, content io.Reader) error
+
+	composer *tusd.StoreComposer
+	finisher tusd.FinisherDataStore
+	deferrer tusd.LengthDeferrerDataStore
+}
+
+// UseIn sets Store and its extensions in the passed composer, then
+// this store in front of them.
+func (store *HookedUploadStore) UseIn(composer *tusd.StoreComposer) {
+	store.Store.UseIn(composer)
+	store.composer = composer
+	if composer.UsesFinisher {
+		store.finisher = composer.Finisher
+	}
+	composer.UseCore(store)
+	composer.UseFinisher(store)
+	if composer.UsesLengthDeferrer {
+		store.deferrer = composer.LengthDeferrer
+		composer.UseLengthDeferrer(store)
+	}
+}
+
+// RandomWrites forwards the capability of Store.
+func (store *HookedUploadStore) RandomWrites() bool { return writesAtOffset(store.Store) }
+
+func (store *HookedUploadStore) checkSize(size int64) error {
+	if store.MaxUploadSize > 0 && size > store.MaxUploadSize {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (store *HookedUploadStore) checkContentType(info tusd.FileInfo) error {
+	if len(store.AllowedContentTypes) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(info.MetaData["filetype"])
+	if err != nil {
+		return ErrContentTypeNotAllowed
+	}
+	for _, pattern := range store.AllowedContentTypes {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return nil
+		}
+	}
+	return ErrContentTypeNotAllowed
+}
+
+func (store *HookedUploadStore) NewUpload(info tusd.FileInfo) (id string, err error) {
+	if !info.SizeIsDeferred {
+		if err := store.checkSize(info.Size); err != nil {
+			return "", err
+		}
+	}
+	if err := store.checkContentType(info); err != nil {
+		return "", err
+	}
+	if store.Quota != nil && !info.SizeIsDeferred {
+		remaining, err := store.Quota(info)
+		if err != nil {
+			return "", err
+		}
+		if remaining >= 0 && info.Size > remaining {
+			return "", ErrQuotaExceeded
+		}
+	}
+	return store.Store.NewUpload(info)
+}
+
+func (store *HookedUploadStore) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+	limit := int64(-1)
+	if store.MaxUploadSize > 0 {
+		// stores of random writes accept any offset
+		if offset > store.MaxUploadSize {
+			return 0, ErrQuotaExceeded
+		}
+		limit = store.MaxUploadSize - offset
+	}
+	if store.Quota != nil {
+		info, err := store.Store.GetInfo(id)
+		if err != nil {
+			return 0, err
+		}
+		remaining, err := store.Quota(info)
+		if err != nil {
+			return 0, err
+		}
+		if remaining >= 0 && (limit < 0 || remaining < limit) {
+			limit = remaining
+		}
+	}
+	if limit >= 0 {
+		src = &quotaReader{r: src, remaining: limit}
+	}
+	return store.Store.WriteChunk(id, offset, src)
+}
+
+func (store *HookedUploadStore) GetInfo(id string) (tusd.FileInfo, error) {
+	return store.Store.GetInfo(id)
+}
+
+func (store *HookedUploadStore) DeclareLength(id string, length int64) error {
+	if err := store.checkSize(length); err != nil {
+		return err
+	}
+	return store.deferrer.DeclareLength(id, length)
+}
+
+func (store *HookedUploadStore) FinishUpload(id string) error {
+	if store.VerifyChecksum != nil {
+		if err := store.verify(id); err != nil {
+			if store.composer != nil && store.composer.UsesTerminater {
+				store.composer.Terminater.Terminate(id)
+			}
+			return err
+		}
+	}
+	if store.finisher != nil {
+		return store.finisher.FinishUpload(id)
+	}
+	return nil
+}
+
+func (store *HookedUploadStore) verify(id string) error {
+	if store.composer == nil || !store.composer.UsesGetReader {
+		return errChecksumNoReader
+	}
+	info, err := store.Store.GetInfo(id)
+	if err != nil {
+		return err
+	}
+	content, err := store.composer.GetReader.GetReader(id)
+	if err != nil {
+		return err
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return store.VerifyChecksum(info, content)
+}
+
+// VerifyMetadataChecksum checks content against the "checksum" metadata
+// of info, formatted as the tus Upload-Checksum header: the algorithm,
+// md5, sha1, sha256 or sha512, a space and the base64 digest, such as
+//
+//	sha256 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+//
+// Uploads without checksum metadata pass.
+func VerifyMetadataChecksum(info tusd.FileInfo, content io.Reader) error {
+	checksum := strings.TrimSpace(info.MetaData["checksum"])
+	if checksum == "" {
+		return nil
+	}
+	i := strings.Index(checksum, " ")
+	if i < 0 {
+		return ErrUnsupportedChecksum
+	}
+	newHash, ok := checksumAlgorithms[strings.ToLower(checksum[:i])]
+	if !ok {
+		return ErrUnsupportedChecksum
+	}
+	want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(checksum[i+1:]))
+	if err != nil {
+		return ErrUnsupportedChecksum
+	}
+	h := newHash()
+	if _, err := io.Copy(h, content); err != nil {
+		return err
+	}
+	if string(h.Sum(nil)) != string(want) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// quotaReader fails with ErrQuotaExceeded once more than remaining bytes
+// are read.
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	if int64(n) > r.remaining {
+		n = int(r.remaining)
+		r.remaining = 0
+		return n, ErrQuotaExceeded
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
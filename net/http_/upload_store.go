@@ -0,0 +1,181 @@
+package http_
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/searKing/tusd"
+	"github.com/searKing/tusd/filestore"
+	"github.com/searKing/tusd/memorylocker"
+	"github.com/searKing/tusd/uid"
+)
+
+// An UploadStore is a storage backend of UploadHandler and
+// ResumableUploadHandler. UseIn registers the store and the extensions it
+// implements in the StoreComposer of a tusd.Config, as the tusd stores do:
+//
+//	composer := tusd.NewStoreComposer()
+//	store.UseIn(composer)
+//	handler, err := NewUploadHandler(tusd.Config{StoreComposer: composer})
+type UploadStore interface {
+	tusd.DataStore
+	UseIn(composer *tusd.StoreComposer)
+}
+
+// A RandomWriterDataStore tells whether its WriteChunk writes at the offset
+// given, rather than appending, in which case UploadHandler.PatchFile
+// accepts Content-Ranges that don't start at the current offset of an upload.
+type RandomWriterDataStore interface {
+	RandomWrites() bool
+}
+
+// writesAtOffset reports whether store writes chunks at any offset.
+func writesAtOffset(store tusd.DataStore) bool {
+	if _, ok := store.(filestore.FileStore); ok {
+		return true
+	}
+	if rw, ok := store.(RandomWriterDataStore); ok {
+		return rw.RandomWrites()
+	}
+	return false
+}
+
+// MemoryUploadStore keeps uploads in memory, for tests and small
+// short-lived files. Uploads are locked with a tusd memorylocker.
+type MemoryUploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*memoryUpload
+	locker  *memorylocker.MemoryLocker
+}
+
+type memoryUpload struct {
+	info tusd.FileInfo
+	data []byte
+}
+
+func NewMemoryUploadStore() *MemoryUploadStore {
+	return &MemoryUploadStore{
+		uploads: make(map[string]*memoryUpload),
+		locker:  memorylocker.New(),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store *MemoryUploadStore) UseIn(composer *tusd.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseGetReader(store)
+	composer.UseTerminater(store)
+	composer.UseLocker(store.locker)
+	composer.UseConcater(store)
+	composer.UseLengthDeferrer(store)
+}
+
+func (store *MemoryUploadStore) RandomWrites() bool { return true }
+
+func (store *MemoryUploadStore) NewUpload(info tusd.FileInfo) (id string, err error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.uploads[info.ID] = &memoryUpload{info: info}
+	return info.ID, nil
+}
+
+func (store *MemoryUploadStore) lookup(id string) (*memoryUpload, error) {
+	u, ok := store.uploads[id]
+	if !ok {
+		return nil, tusd.ErrNotFound
+	}
+	return u, nil
+}
+
+func (store *MemoryUploadStore) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+	// read outside of the lock, src may be slow
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(src)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	u, lerr := store.lookup(id)
+	if lerr != nil {
+		return 0, lerr
+	}
+	// chunks may be written out of order, but not past the data, which
+	// would allocate up to any offset
+	if offset < 0 || offset > int64(len(u.data)) {
+		return 0, tusd.ErrMismatchOffset
+	}
+	if end := offset + n; end > int64(len(u.data)) {
+		u.data = append(u.data, make([]byte, end-int64(len(u.data)))...)
+	}
+	copy(u.data[offset:], buf.Bytes())
+	return n, err
+}
+
+func (store *MemoryUploadStore) GetInfo(id string) (tusd.FileInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	u, err := store.lookup(id)
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	info := u.info
+	info.Offset = int64(len(u.data))
+	return info, nil
+}
+
+// GetReader returns a snapshot of the data of the upload.
+func (store *MemoryUploadStore) GetReader(id string) (io.Reader, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	u, err := store.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(append([]byte(nil), u.data...)), nil
+}
+
+func (store *MemoryUploadStore) Terminate(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, err := store.lookup(id); err != nil {
+		return err
+	}
+	delete(store.uploads, id)
+	return nil
+}
+
+func (store *MemoryUploadStore) ConcatUploads(dest string, uploads []string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	d, err := store.lookup(dest)
+	if err != nil {
+		return err
+	}
+	for _, id := range uploads {
+		u, err := store.lookup(id)
+		if err != nil {
+			return err
+		}
+		d.data = append(d.data, u.data...)
+	}
+	return nil
+}
+
+func (store *MemoryUploadStore) DeclareLength(id string, length int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	u, err := store.lookup(id)
+	if err != nil {
+		return err
+	}
+	u.info.Size = length
+	u.info.SizeIsDeferred = false
+	return nil
+}
@@ -0,0 +1,187 @@
+package http_
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/searKing/tusd"
+	"github.com/searKing/tusd/memorylocker"
+	"github.com/searKing/tusd/uid"
+)
+
+var defaultUploadFilePerm = os.FileMode(0664)
+
+// ShardedFileUploadStore stores uploads on the local disk like the tusd
+// filestore, in an [id].info file holding the FileInfo as JSON and an
+// [id].bin file holding the data, but spreads them over ShardDepth levels
+// of subdirectories named after the MD5 of the upload id, so that no
+// directory grows too large:
+//
+//	<Path>/3f/a2/<id>.bin
+//
+// Chunks are written at the offset given. Uploads are locked within the
+// process only.
+type ShardedFileUploadStore struct {
+	// Path is the root directory of the store; it is created on demand.
+	Path string
+	// ShardDepth is the number of directory levels, each named by 2 hex
+	// digits. If zero, 2 is used; if negative, no shard is used.
+	ShardDepth int
+
+	locker *memorylocker.MemoryLocker
+}
+
+func NewShardedFileUploadStore(path string) *ShardedFileUploadStore {
+	return &ShardedFileUploadStore{Path: path, locker: memorylocker.New()}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store *ShardedFileUploadStore) UseIn(composer *tusd.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseGetReader(store)
+	composer.UseTerminater(store)
+	if store.locker == nil {
+		store.locker = memorylocker.New()
+	}
+	composer.UseLocker(store.locker)
+	composer.UseConcater(store)
+	composer.UseLengthDeferrer(store)
+}
+
+func (store *ShardedFileUploadStore) RandomWrites() bool { return true }
+
+// dir returns the shard directory of upload id.
+func (store *ShardedFileUploadStore) dir(id string) string {
+	depth := store.ShardDepth
+	if depth == 0 {
+		depth = 2
+	}
+	sum := md5.Sum([]byte(id))
+	hexSum := hex.EncodeToString(sum[:])
+	elems := []string{store.Path}
+	for i := 0; i < depth && i < len(sum); i++ {
+		elems = append(elems, hexSum[2*i:2*i+2])
+	}
+	return filepath.Join(elems...)
+}
+
+// binPath returns the path to the .bin storing the binary data.
+func (store *ShardedFileUploadStore) binPath(id string) string {
+	return filepath.Join(store.dir(id), id+".bin")
+}
+
+// infoPath returns the path to the .info file storing the file's info.
+func (store *ShardedFileUploadStore) infoPath(id string) string {
+	return filepath.Join(store.dir(id), id+".info")
+}
+
+func (store *ShardedFileUploadStore) NewUpload(info tusd.FileInfo) (id string, err error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+	id = info.ID
+	if err := os.MkdirAll(store.dir(id), 0755); err != nil {
+		return "", err
+	}
+
+	// Create .bin file with no content
+	file, err := os.OpenFile(store.binPath(id), os.O_CREATE|os.O_WRONLY, defaultUploadFilePerm)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return id, store.writeInfo(id, info)
+}
+
+func (store *ShardedFileUploadStore) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+	file, err := os.OpenFile(store.binPath(id), os.O_WRONLY, defaultUploadFilePerm)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(file, src)
+	// An interrupted PATCH request keeps the bytes received, see filestore.
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (store *ShardedFileUploadStore) GetInfo(id string) (tusd.FileInfo, error) {
+	info := tusd.FileInfo{}
+	data, err := ioutil.ReadFile(store.infoPath(id))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+
+	stat, err := os.Stat(store.binPath(id))
+	if err != nil {
+		return info, err
+	}
+	info.Offset = stat.Size()
+	return info, nil
+}
+
+func (store *ShardedFileUploadStore) GetReader(id string) (io.Reader, error) {
+	return os.Open(store.binPath(id))
+}
+
+func (store *ShardedFileUploadStore) Terminate(id string) error {
+	if err := os.Remove(store.infoPath(id)); err != nil {
+		return err
+	}
+	return os.Remove(store.binPath(id))
+}
+
+func (store *ShardedFileUploadStore) ConcatUploads(dest string, uploads []string) (err error) {
+	file, err := os.OpenFile(store.binPath(dest), os.O_WRONLY|os.O_APPEND, defaultUploadFilePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, id := range uploads {
+		src, err := os.Open(store.binPath(id))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *ShardedFileUploadStore) DeclareLength(id string, length int64) error {
+	info, err := store.GetInfo(id)
+	if err != nil {
+		return err
+	}
+	info.Size = length
+	info.SizeIsDeferred = false
+	return store.writeInfo(id, info)
+}
+
+// writeInfo updates the entire information. Everything will be overwritten.
+func (store *ShardedFileUploadStore) writeInfo(id string, info tusd.FileInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(store.infoPath(id), data, defaultUploadFilePerm)
+}
@@ -0,0 +1,401 @@
+package http_
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/searKing/tusd"
+	"github.com/searKing/tusd/memorylocker"
+	"github.com/searKing/tusd/uid"
+)
+
+// S3UploadStore stores uploads in a bucket of an S3-compatible object
+// storage, using path-style PUT, GET and DELETE object requests signed
+// with AWS Signature Version 4.
+//
+// Each chunk written is stored as an object
+//
+//	<Prefix><id>.part.<offset>
+//
+// next to an object <Prefix><id>.info holding the FileInfo and the list
+// of parts. FinishUpload concatenates the parts into the object <Prefix><id>
+// and removes them. Chunks are appended only.
+//
+// Uploads are locked within the process only; with several processes, use
+// a shared tusd.LockerDataStore instead.
+type S3UploadStore struct {
+	// Endpoint is the base URL of the service, such as https://s3.amazonaws.com.
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to every object key.
+	Prefix string
+	// Region, AccessKeyID and SecretAccessKey sign the requests.
+	// If AccessKeyID is empty, requests are sent unsigned.
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	locker *memorylocker.MemoryLocker
+}
+
+func NewS3UploadStore(endpoint, bucket string) *S3UploadStore {
+	return &S3UploadStore{Endpoint: endpoint, Bucket: bucket, Region: "us-east-1", locker: memorylocker.New()}
+}
+
+// s3UploadInfo is the content of the .info object of an upload.
+type s3UploadInfo struct {
+	Info     tusd.FileInfo
+	Parts    []s3UploadPart `json:",omitempty"`
+	Finished bool           `json:",omitempty"`
+}
+
+type s3UploadPart struct {
+	Offset int64
+	Size   int64
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store *S3UploadStore) UseIn(composer *tusd.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseGetReader(store)
+	composer.UseTerminater(store)
+	composer.UseFinisher(store)
+	if store.locker == nil {
+		store.locker = memorylocker.New()
+	}
+	composer.UseLocker(store.locker)
+	composer.UseLengthDeferrer(store)
+}
+
+func (store *S3UploadStore) infoKey(id string) string   { return store.Prefix + id + ".info" }
+func (store *S3UploadStore) objectKey(id string) string { return store.Prefix + id }
+func (store *S3UploadStore) partKey(id string, offset int64) string {
+	return fmt.Sprintf("%s%s.part.%020d", store.Prefix, id, offset)
+}
+
+func (store *S3UploadStore) NewUpload(info tusd.FileInfo) (id string, err error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+	return info.ID, store.writeInfo(&s3UploadInfo{Info: info})
+}
+
+func (store *S3UploadStore) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return 0, err
+	}
+	if u.Finished || offset != u.Info.Offset {
+		return 0, tusd.ErrMismatchOffset
+	}
+
+	// spool the chunk to disk, as PUT needs its length
+	tmp, err := ioutil.TempFile("", "s3upload")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	n, err := io.Copy(tmp, src)
+	// An interrupted PATCH request keeps the bytes received, see filestore.
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := store.put(store.partKey(id, offset), tmp, n); err != nil {
+		return 0, err
+	}
+	u.Parts = append(u.Parts, s3UploadPart{Offset: offset, Size: n})
+	u.Info.Offset += n
+	if err := store.writeInfo(u); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (store *S3UploadStore) GetInfo(id string) (tusd.FileInfo, error) {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	return u.Info, nil
+}
+
+// GetReader returns the object of a finished upload, or reads the parts
+// of an unfinished one in turn.
+func (store *S3UploadStore) GetReader(id string) (io.Reader, error) {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Finished {
+		return store.get(store.objectKey(id))
+	}
+	return &s3PartsReader{store: store, id: id, parts: u.Parts}, nil
+}
+
+func (store *S3UploadStore) FinishUpload(id string) error {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return err
+	}
+	if u.Finished {
+		return nil
+	}
+	parts := &s3PartsReader{store: store, id: id, parts: u.Parts}
+	defer parts.Close()
+	if err := store.put(store.objectKey(id), parts, u.Info.Offset); err != nil {
+		return err
+	}
+	u.Finished = true
+	done := u.Parts
+	u.Parts = nil
+	if err := store.writeInfo(u); err != nil {
+		return err
+	}
+	for _, p := range done {
+		if err := store.delete(store.partKey(id, p.Offset)); err != nil && err != tusd.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *S3UploadStore) Terminate(id string) error {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return err
+	}
+	keys := []string{store.objectKey(id)}
+	for _, p := range u.Parts {
+		keys = append(keys, store.partKey(id, p.Offset))
+	}
+	for _, key := range append(keys, store.infoKey(id)) {
+		if err := store.delete(key); err != nil && err != tusd.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *S3UploadStore) DeclareLength(id string, length int64) error {
+	u, err := store.readInfo(id)
+	if err != nil {
+		return err
+	}
+	u.Info.Size = length
+	u.Info.SizeIsDeferred = false
+	return store.writeInfo(u)
+}
+
+func (store *S3UploadStore) readInfo(id string) (*s3UploadInfo, error) {
+	body, err := store.get(store.infoKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var u s3UploadInfo
+	if err := json.NewDecoder(body).Decode(&u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (store *S3UploadStore) writeInfo(u *s3UploadInfo) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return store.put(store.infoKey(u.Info.ID), bytes.NewReader(data), int64(len(data)))
+}
+
+// s3PartsReader reads the part objects of an upload one after the other.
+type s3PartsReader struct {
+	store *S3UploadStore
+	id    string
+	parts []s3UploadPart
+	cur   io.ReadCloser
+}
+
+func (r *s3PartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			body, err := r.store.get(r.store.partKey(r.id, r.parts[0].Offset))
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.parts = body, r.parts[1:]
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *s3PartsReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+func (store *S3UploadStore) objectURL(key string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(store.Endpoint, "/"))
+	for _, elem := range append([]string{store.Bucket}, strings.Split(key, "/")...) {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(elem))
+	}
+	return b.String()
+}
+
+func (store *S3UploadStore) do(method, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, store.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	store.sign(req, time.Now())
+	client := store.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, tusd.ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+func (store *S3UploadStore) get(key string) (io.ReadCloser, error) {
+	resp, err := store.do(http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (store *S3UploadStore) put(key string, body io.Reader, size int64) error {
+	resp, err := store.do(http.MethodPut, key, body, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (store *S3UploadStore) delete(key string) error {
+	resp, err := store.do(http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, which
+// signs its host, range and x-amz-* headers. The payload is unsigned unless
+// req already carries X-Amz-Content-Sha256.
+func (store *S3UploadStore) sign(req *http.Request, now time.Time) {
+	if store.AccessKeyID == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = "UNSIGNED-PAYLOAD"
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "range" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + store.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+store.SecretAccessKey), date)
+	key = hmacSHA256(key, store.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+store.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,150 @@
+package http_
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/searKing/tusd"
+)
+
+func newTestUploadHandler(t *testing.T, store UploadStore) *UploadHandler {
+	composer := tusd.NewStoreComposer()
+	store.UseIn(composer)
+	handler, err := NewUploadHandler(tusd.Config{StoreComposer: composer, BasePath: "/files/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// postUpload uploads body with PostFile, and returns the response.
+func postUpload(handler *UploadHandler, contentType, metadata, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if metadata != "" {
+		req.Header.Set("Upload-Metadata", metadata)
+	}
+	w := httptest.NewRecorder()
+	handler.PostFile(w, req)
+	return w
+}
+
+func TestUploadStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stores := map[string]UploadStore{
+		"memory":  NewMemoryUploadStore(),
+		"sharded": NewShardedFileUploadStore(dir),
+	}
+	for name, store := range stores {
+		handler := newTestUploadHandler(t, store)
+		w := postUpload(handler, "text/plain", "", "hello, world")
+		if w.Code != http.StatusCreated {
+			t.Errorf("%s: POST = %d %s, want 201", name, w.Code, w.Body.String())
+			continue
+		}
+		id := path.Base(w.Header().Get("Location"))
+
+		// rewrite out of order, as the stores write at any offset
+		req := httptest.NewRequest(http.MethodPatch, "/"+id, strings.NewReader("Worldhello, "))
+		req.Header.Add("Content-Range", "bytes 7-11/*")
+		req.Header.Add("Content-Range", "bytes 0-6/*")
+		w = httptest.NewRecorder()
+		handler.PatchFile(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: PATCH = %d %s, want 204", name, w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		handler.GetFile(w, httptest.NewRequest(http.MethodGet, "/"+id, nil))
+		if w.Body.String() != "hello, World" {
+			t.Errorf("%s: GET = %q, want %q", name, w.Body.String(), "hello, World")
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("%s: GET Content-Type = %q, want text/plain", name, got)
+		}
+	}
+
+	sharded := stores["sharded"].(*ShardedFileUploadStore)
+	if rel := strings.TrimPrefix(sharded.binPath("id"), dir); strings.Count(rel, string(os.PathSeparator)) != 3 {
+		t.Errorf("binPath = %q, want 2 levels of shards under %q", sharded.binPath("id"), dir)
+	}
+}
+
+func TestHookedUploadStore(t *testing.T) {
+	store := NewMemoryUploadStore()
+	handler := newTestUploadHandler(t, &HookedUploadStore{
+		Store:               store,
+		MaxUploadSize:       16,
+		AllowedContentTypes: []string{"text/*"},
+		VerifyChecksum:      VerifyMetadataChecksum,
+	})
+
+	sum := sha256.Sum256([]byte("hello"))
+	checksum := "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+	metadata := func(checksum string) string {
+		return "checksum " + base64.StdEncoding.EncodeToString([]byte(checksum))
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		metadata    string
+		body        string
+		code        int
+	}{
+		{"allowed", "text/plain", metadata(checksum), "hello", http.StatusCreated},
+		{"content type", "image/png", "", "hello", http.StatusUnsupportedMediaType},
+		{"too large", "text/plain", "", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+		{"checksum mismatch", "text/plain", metadata(checksum), "HELLO", StatusChecksumMismatch},
+	}
+	for _, tt := range tests {
+		w := postUpload(handler, tt.contentType, tt.metadata, tt.body)
+		if w.Code != tt.code {
+			t.Errorf("%s: POST = %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.code)
+		}
+	}
+	// only the allowed upload is kept, the mismatched one is terminated
+	store.mu.Lock()
+	n := len(store.uploads)
+	store.mu.Unlock()
+	if n != 2 {
+		// the too large upload is created before its body is read
+		t.Errorf("%d uploads stored, want 2", n)
+	}
+}
+
+func TestUploadStoreOffsets(t *testing.T) {
+	store := NewMemoryUploadStore()
+	hooked := &HookedUploadStore{Store: store, MaxUploadSize: 16}
+	id, err := store.NewUpload(tusd.FileInfo{Size: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hooked.WriteChunk(id, 1<<40, strings.NewReader("x")); err != ErrQuotaExceeded {
+		t.Errorf("WriteChunk past MaxUploadSize: %v", err)
+	}
+	if _, err := store.WriteChunk(id, 1<<40, strings.NewReader("x")); err != tusd.ErrMismatchOffset {
+		t.Errorf("WriteChunk past the data: %v", err)
+	}
+	if n, err := store.WriteChunk(id, 0, strings.NewReader("hello")); n != 5 || err != nil {
+		t.Errorf("WriteChunk = %d, %v", n, err)
+	}
+	if n, err := store.WriteChunk(id, 5, strings.NewReader(" world")); n != 6 || err != nil {
+		t.Errorf("WriteChunk at the end = %d, %v", n, err)
+	}
+	if _, err := hooked.WriteChunk(id, 11, strings.NewReader(strings.Repeat("x", 6))); err != ErrQuotaExceeded {
+		t.Errorf("WriteChunk across MaxUploadSize: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package stun
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+)
+
+var (
+	ErrIntegrityMismatch   = errors.New("stun: MESSAGE-INTEGRITY mismatch")
+	ErrFingerprintMismatch = errors.New("stun: FINGERPRINT mismatch")
+)
+
+const (
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+
+	integritySize   = sha1.Size
+	fingerprintSize = 4
+	// fingerprintXOR is XORed with the CRC-32 of FINGERPRINT, "STUN".
+	fingerprintXOR = 0x5354554e
+)
+
+// AddString appends an attribute of type t, such as USERNAME, REALM, NONCE
+// or SOFTWARE, of value s.
+func (m *Message) AddString(t AttrType, s string) {
+	m.Add(t, []byte(s))
+}
+
+// GetString returns the value of the first attribute of type t as a string.
+func (m *Message) GetString(t AttrType) (string, bool) {
+	v, ok := m.Get(t)
+	return string(v), ok
+}
+
+// https://tools.ietf.org/html/rfc5389#section-15.1
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|0 0 0 0 0 0 0 0|    Family     |           Port                |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	|                 Address (32 bits or 128 bits)                 |
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+func encodeAddress(ip net.IP, port int) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		v := make([]byte, 4+net.IPv4len)
+		v[1] = familyIPv4
+		binary.BigEndian.PutUint16(v[2:], uint16(port))
+		copy(v[4:], ip4)
+		return v
+	}
+	v := make([]byte, 4+net.IPv6len)
+	v[1] = familyIPv6
+	binary.BigEndian.PutUint16(v[2:], uint16(port))
+	copy(v[4:], ip.To16())
+	return v
+}
+
+func decodeAddress(v []byte) (net.IP, int, error) {
+	if len(v) < 4 {
+		return nil, 0, ErrBadAttrValue
+	}
+	port := int(binary.BigEndian.Uint16(v[2:]))
+	switch {
+	case v[1] == familyIPv4 && len(v) == 4+net.IPv4len:
+		return net.IP(append([]byte(nil), v[4:]...)), port, nil
+	case v[1] == familyIPv6 && len(v) == 4+net.IPv6len:
+		return net.IP(append([]byte(nil), v[4:]...)), port, nil
+	}
+	return nil, 0, ErrBadAttrValue
+}
+
+// xorAddress XORs the port and address of the address value v with the
+// magic cookie and the transaction ID, in place.
+func (m *Message) xorAddress(v []byte) {
+	var key [4 + TransactionIDSize]byte
+	binary.BigEndian.PutUint32(key[:], MagicCookie)
+	copy(key[4:], m.TransactionID[:])
+	v[2] ^= key[0]
+	v[3] ^= key[1]
+	for i := 4; i < len(v); i++ {
+		v[i] ^= key[i-4]
+	}
+}
+
+// AddAddress appends an address attribute of type t, such as MAPPED-ADDRESS.
+func (m *Message) AddAddress(t AttrType, ip net.IP, port int) {
+	m.Add(t, encodeAddress(ip, port))
+}
+
+// Address returns the address of the first address attribute of type t.
+func (m *Message) Address(t AttrType) (net.IP, int, error) {
+	v, ok := m.Get(t)
+	if !ok {
+		return nil, 0, ErrAttrNotFound
+	}
+	return decodeAddress(v)
+}
+
+// AddXORAddress appends an XORed address attribute of type t, such as
+// XOR-MAPPED-ADDRESS.
+// https://tools.ietf.org/html/rfc5389#section-15.2
+func (m *Message) AddXORAddress(t AttrType, ip net.IP, port int) {
+	v := encodeAddress(ip, port)
+	m.xorAddress(v)
+	m.Add(t, v)
+}
+
+// XORAddress returns the address of the first XORed address attribute of
+// type t.
+func (m *Message) XORAddress(t AttrType) (net.IP, int, error) {
+	v, ok := m.Get(t)
+	if !ok {
+		return nil, 0, ErrAttrNotFound
+	}
+	v = append([]byte(nil), v...)
+	if len(v) >= 4 {
+		m.xorAddress(v)
+	}
+	return decodeAddress(v)
+}
+
+// XORAddresses returns the addresses of all the XORed address attributes
+// of type t, such as the XOR-PEER-ADDRESSes of a TURN CreatePermission.
+func (m *Message) XORAddresses(t AttrType) ([]*net.UDPAddr, error) {
+	var addrs []*net.UDPAddr
+	for _, a := range m.Attributes {
+		if a.Type != t {
+			continue
+		}
+		v := append([]byte(nil), a.Value...)
+		if len(v) >= 4 {
+			m.xorAddress(v)
+		}
+		ip, port, err := decodeAddress(v)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, &net.UDPAddr{IP: ip, Port: port})
+	}
+	return addrs, nil
+}
+
+// Error is the ERROR-CODE of an error response.
+type Error struct {
+	Code   int
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stun: error response %d %s", e.Code, e.Reason)
+}
+
+// https://tools.ietf.org/html/rfc5389#section-15.6
+const (
+	CodeTryAlternate     = 300
+	CodeBadRequest       = 400
+	CodeUnauthorized     = 401
+	CodeUnknownAttribute = 420
+	CodeStaleNonce       = 438
+	CodeServerError      = 500
+)
+
+// AddErrorCode appends an ERROR-CODE attribute of code and reason.
+func (m *Message) AddErrorCode(code int, reason string) {
+	v := make([]byte, 4+len(reason))
+	v[2] = byte(code / 100)
+	v[3] = byte(code % 100)
+	copy(v[4:], reason)
+	m.Add(AttrErrorCode, v)
+}
+
+// ErrorCode returns the ERROR-CODE of m.
+func (m *Message) ErrorCode() (*Error, error) {
+	v, ok := m.Get(AttrErrorCode)
+	if !ok {
+		return nil, ErrAttrNotFound
+	}
+	if len(v) < 4 {
+		return nil, ErrBadAttrValue
+	}
+	return &Error{Code: int(v[2]&0x7)*100 + int(v[3]), Reason: string(v[4:])}, nil
+}
+
+// AddUnknownAttributes appends an UNKNOWN-ATTRIBUTES attribute listing types.
+func (m *Message) AddUnknownAttributes(types []AttrType) {
+	v := make([]byte, 2*len(types))
+	for i, t := range types {
+		binary.BigEndian.PutUint16(v[2*i:], uint16(t))
+	}
+	m.Add(AttrUnknownAttributes, v)
+}
+
+// UnknownRequiredAttributes returns the types of the comprehension-required
+// attributes of m not in known.
+func (m *Message) UnknownRequiredAttributes(known ...AttrType) []AttrType {
+	var unknown []AttrType
+next:
+	for _, a := range m.Attributes {
+		if !a.Type.Required() {
+			continue
+		}
+		for _, t := range known {
+			if a.Type == t {
+				continue next
+			}
+		}
+		unknown = append(unknown, a.Type)
+	}
+	return unknown
+}
+
+// LongTermKey returns the key of MESSAGE-INTEGRITY for long-term
+// credentials: MD5(username ":" realm ":" password).
+// https://tools.ietf.org/html/rfc5389#section-15.4
+func LongTermKey(username, realm, password string) []byte {
+	sum := md5.Sum([]byte(username + ":" + realm + ":" + password))
+	return sum[:]
+}
+
+// ShortTermKey returns the key of MESSAGE-INTEGRITY for short-term
+// credentials, the password.
+func ShortTermKey(password string) []byte {
+	return []byte(password)
+}
+
+// integrity returns the HMAC-SHA1 of the encoding b of a message up to
+// off, its length set as if it ended with a MESSAGE-INTEGRITY there.
+func integrity(key, b []byte, off int) []byte {
+	head := append([]byte(nil), b[:off]...)
+	binary.BigEndian.PutUint16(head[2:], uint16(off-headerSize+attrHeaderLen+integritySize))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(head)
+	return mac.Sum(nil)
+}
+
+// AddMessageIntegrity appends a MESSAGE-INTEGRITY attribute computed
+// with key. Only a FINGERPRINT may follow it.
+func (m *Message) AddMessageIntegrity(key []byte) {
+	b := m.Encode()
+	m.Add(AttrMessageIntegrity, integrity(key, b, len(b)))
+}
+
+// CheckMessageIntegrity checks the MESSAGE-INTEGRITY of m with key.
+func (m *Message) CheckMessageIntegrity(key []byte) error {
+	v, ok := m.Get(AttrMessageIntegrity)
+	if !ok {
+		return ErrAttrNotFound
+	}
+	b := m.received()
+	off, _ := m.attrOffset(AttrMessageIntegrity)
+	if !hmac.Equal(v, integrity(key, b, off)) {
+		return ErrIntegrityMismatch
+	}
+	return nil
+}
+
+// fingerprint returns the FINGERPRINT of the encoding b of a message up to
+// off, its length set as if it ended with a FINGERPRINT there.
+func fingerprint(b []byte, off int) uint32 {
+	head := append([]byte(nil), b[:off]...)
+	binary.BigEndian.PutUint16(head[2:], uint16(off-headerSize+attrHeaderLen+fingerprintSize))
+	return crc32.ChecksumIEEE(head) ^ fingerprintXOR
+}
+
+// AddFingerprint appends a FINGERPRINT attribute, which must be the last
+// attribute.
+// https://tools.ietf.org/html/rfc5389#section-15.5
+func (m *Message) AddFingerprint() {
+	b := m.Encode()
+	v := make([]byte, fingerprintSize)
+	binary.BigEndian.PutUint32(v, fingerprint(b, len(b)))
+	m.Add(AttrFingerprint, v)
+}
+
+// CheckFingerprint checks the FINGERPRINT of m, if any.
+func (m *Message) CheckFingerprint() error {
+	v, ok := m.Get(AttrFingerprint)
+	if !ok {
+		return nil
+	}
+	if len(v) != fingerprintSize {
+		return ErrBadAttrValue
+	}
+	b := m.received()
+	off, _ := m.attrOffset(AttrFingerprint)
+	if binary.BigEndian.Uint32(v) != fingerprint(b, off) {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package stun
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/searKing/golib/net/ice"
+)
+
+// https://tools.ietf.org/html/rfc5389#section-7.2.1
+const (
+	// DefaultRTO is the initial retransmission timeout over UDP.
+	DefaultRTO = 500 * time.Millisecond
+	// DefaultRetransmits is the number of requests sent over UDP, Rc.
+	DefaultRetransmits = 7
+	// lastWait is the number of RTOs waited after the last request, Rm.
+	lastWait = 16
+	// DefaultTimeout is the timeout of transactions over TCP.
+	DefaultTimeout = 39500 * time.Millisecond
+
+	maxPacketSize = 1 << 16
+)
+
+var (
+	ErrTimeout              = errors.New("stun: transaction timed out")
+	ErrUnsupportedTransport = errors.New("stun: unsupported transport")
+)
+
+// Client sends STUN requests.
+type Client struct {
+	// Dialer dials the servers. If nil, a zero net.Dialer is used.
+	Dialer *net.Dialer
+	// TLSConfig is the TLS configuration of stuns and turns servers.
+	// If nil, the default configuration is used, with the host of the URL
+	// as ServerName.
+	TLSConfig *tls.Config
+	// RTO is the initial retransmission timeout over UDP, doubled at each
+	// retransmission. If zero, DefaultRTO is used.
+	RTO time.Duration
+	// Retransmits is the number of requests sent over UDP. If zero,
+	// DefaultRetransmits is used.
+	Retransmits int
+	// Software, if not empty, is sent as the SOFTWARE of requests.
+	Software string
+}
+
+// DefaultClient is the Client used by Bind.
+var DefaultClient = &Client{}
+
+// Bind returns the server reflexive address of the client, as the STUN
+// server of u sees it, with DefaultClient.
+func Bind(ctx context.Context, u *ice.URL) (net.Addr, error) {
+	return DefaultClient.Bind(ctx, u)
+}
+
+// Bind sends a Binding request to the server of u and returns the
+// XOR-MAPPED-ADDRESS, or MAPPED-ADDRESS, of its response: a *net.UDPAddr
+// over UDP, a *net.TCPAddr over TCP and TLS.
+// DTLS, for stuns or turns over UDP, is not supported.
+func (c *Client) Bind(ctx context.Context, u *ice.URL) (net.Addr, error) {
+	conn, err := c.Dial(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := NewMessage(MethodBinding, ClassRequest)
+	if c.Software != "" {
+		req.AddString(AttrSoftware, c.Software)
+	}
+	req.AddFingerprint()
+	resp, err := c.Do(ctx, conn, req)
+	if err != nil {
+		return nil, err
+	}
+	ip, port, err := resp.XORAddress(AttrXORMappedAddress)
+	if err == ErrAttrNotFound {
+		ip, port, err = resp.Address(AttrMappedAddress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Proto == ice.TransportUDP {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// Dial connects to the server of u over its transport, with TLS for
+// stuns and turns over TCP.
+func (c *Client) Dial(ctx context.Context, u *ice.URL) (net.Conn, error) {
+	var network string
+	switch u.Proto {
+	case ice.TransportUDP:
+		network = "udp"
+	case ice.TransportTCP:
+		network = "tcp"
+	}
+	if network == "" || u.IsSecure() && network == "udp" {
+		return nil, fmt.Errorf("%v: %s over %s", ErrUnsupportedTransport, u.Scheme, u.Proto)
+	}
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	addr := net.JoinHostPort(u.Host, strconv.Itoa(u.Port))
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsSecure() {
+		return conn, nil
+	}
+
+	config := c.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = u.Host
+	}
+	tlsConn := tls.Client(conn, config)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// Do sends the request req over the connected conn and returns its
+// response; an error response is returned with its *Error. Over a packet
+// conn, such as UDP, the request is retransmitted as in RFC 5389,
+// section 7.2.1.
+// Messages received which are not responses to req are dropped.
+func (c *Client) Do(ctx context.Context, conn net.Conn, req *Message) (*Message, error) {
+	// unblock reads when ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	defer conn.SetReadDeadline(time.Time{})
+
+	var resp *Message
+	var err error
+	if _, ok := conn.(net.PacketConn); ok {
+		resp, err = c.doPacket(ctx, conn, req)
+	} else {
+		resp, err = c.doStream(ctx, conn, req)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if resp.Type.Class == ClassErrorResponse {
+		e, err := resp.ErrorCode()
+		if err != nil {
+			return nil, err
+		}
+		return resp, e
+	}
+	return resp, nil
+}
+
+func (c *Client) doPacket(ctx context.Context, conn net.Conn, req *Message) (*Message, error) {
+	rto := c.RTO
+	if rto <= 0 {
+		rto = DefaultRTO
+	}
+	retransmits := c.Retransmits
+	if retransmits <= 0 {
+		retransmits = DefaultRetransmits
+	}
+	initialRTO := rto
+	b := req.Encode()
+	buf := make([]byte, maxPacketSize)
+	for i := 0; i < retransmits; i++ {
+		if _, err := conn.Write(b); err != nil {
+			return nil, err
+		}
+		wait := rto
+		if i == retransmits-1 {
+			wait = lastWait * initialRTO
+		}
+		deadline, ctxDeadline := time.Now().Add(wait), false
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline, ctxDeadline = d, true
+		}
+		conn.SetReadDeadline(deadline)
+		resp, err := readResponse(conn, buf, req, true)
+		if err == nil {
+			return resp, nil
+		}
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if ctxDeadline {
+			return nil, context.DeadlineExceeded
+		}
+		rto *= 2
+	}
+	return nil, ErrTimeout
+}
+
+func (c *Client) doStream(ctx context.Context, conn net.Conn, req *Message) (*Message, error) {
+	deadline, ctxDeadline := time.Now().Add(DefaultTimeout), false
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline, ctxDeadline = d, true
+	}
+	conn.SetReadDeadline(deadline)
+	if _, err := conn.Write(req.Encode()); err != nil {
+		return nil, err
+	}
+	resp, err := readResponse(conn, nil, req, false)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && ctx.Err() == nil {
+		if ctxDeadline {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, ErrTimeout
+	}
+	return resp, err
+}
+
+// readResponse reads messages from conn until the response to req, into
+// buf for packets.
+func readResponse(conn net.Conn, buf []byte, req *Message, packet bool) (*Message, error) {
+	for {
+		var m *Message
+		var err error
+		if packet {
+			var n int
+			n, err = conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			m, err = Decode(buf[:n])
+		} else {
+			m, err = ReadMessage(conn)
+			if err == ErrNotSTUNMessage {
+				// the stream is out of sync
+				return nil, err
+			}
+			if err != nil && err != ErrTruncated {
+				return nil, err
+			}
+		}
+		if err != nil || m.TransactionID != req.TransactionID ||
+			m.Type.Method != req.Type.Method || m.CheckFingerprint() != nil {
+			continue
+		}
+		if m.Type.Class != ClassSuccessResponse && m.Type.Class != ClassErrorResponse {
+			continue
+		}
+		return m, nil
+	}
+}
+
+// ReadMessage reads a message from the stream r, framed by the length of
+// its header.
+func ReadMessage(r io.Reader) (*Message, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !IsMessage(header) {
+		return nil, ErrNotSTUNMessage
+	}
+	b := make([]byte, messageLength(header))
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[headerSize:]); err != nil {
+		return nil, err
+	}
+	return Decode(b)
+}
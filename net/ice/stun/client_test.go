@@ -0,0 +1,107 @@
+package stun
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/searKing/golib/net/ice"
+)
+
+func TestBind(t *testing.T) {
+	srv := &Server{Software: "test"}
+	defer srv.Close()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServePacket(pc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+
+	// borrow the certificate of httptest, valid for 127.0.0.1
+	ts := httptest.NewTLSServer(nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	tl, err := tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	ts.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(tl)
+
+	client := &Client{TLSConfig: &tls.Config{RootCAs: roots}}
+	for _, raw := range []string{
+		"stun:" + pc.LocalAddr().String(),
+		"turn:" + l.Addr().String() + "?transport=tcp",
+		"stuns:" + tl.Addr().String(),
+	} {
+		u, err := ice.ParseURL(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		addr, err := client.Bind(ctx, u)
+		cancel()
+		if err != nil {
+			t.Errorf("Bind(%s): %v", raw, err)
+			continue
+		}
+		var ip net.IP
+		switch addr := addr.(type) {
+		case *net.UDPAddr:
+			ip = addr.IP
+		case *net.TCPAddr:
+			ip = addr.IP
+		}
+		if !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Errorf("Bind(%s) = %v", raw, addr)
+		}
+	}
+}
+
+func TestBindTimeout(t *testing.T) {
+	// a server which never answers
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	u, err := ice.ParseURL("stun:" + pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{RTO: 10 * time.Millisecond, Retransmits: 3}
+	if _, err := client.Bind(context.Background(), u); err != ErrTimeout {
+		t.Errorf("Bind = %v, want %v", err, ErrTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DefaultClient.Bind(ctx, u); err != context.DeadlineExceeded {
+		t.Errorf("Bind = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := &Server{}
+	req := NewMessage(MethodBinding, ClassRequest)
+	req.Add(0x0042, []byte{1})
+	resp := srv.Handle(req, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+	if e, err := resp.ErrorCode(); err != nil || e.Code != CodeUnknownAttribute {
+		t.Errorf("ErrorCode = %v, %v, want %d", e, err, CodeUnknownAttribute)
+	}
+
+	if resp := srv.Handle(NewMessage(MethodBinding, ClassIndication), nil); resp != nil {
+		t.Errorf("response to an indication: %v", resp)
+	}
+}
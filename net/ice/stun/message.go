@@ -0,0 +1,256 @@
+// https://tools.ietf.org/html/rfc5389
+package stun
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MagicCookie is the fixed value of the Magic Cookie field of messages.
+const MagicCookie = 0x2112A442
+
+const (
+	headerSize    = 20
+	attrHeaderLen = 4
+	// TransactionIDSize is the size of transaction IDs.
+	TransactionIDSize = 12
+)
+
+var (
+	ErrNotSTUNMessage = errors.New("stun: not a STUN message")
+	ErrTruncated      = errors.New("stun: truncated message")
+	ErrAttrNotFound   = errors.New("stun: attribute not found")
+	ErrBadAttrValue   = errors.New("stun: malformed attribute value")
+)
+
+// Method is the method of a message, such as Binding.
+type Method uint16
+
+// https://tools.ietf.org/html/rfc5389#section-18.1
+const (
+	MethodBinding Method = 0x001
+)
+
+// Class is the class of a message: request, indication, success or error
+// response.
+type Class uint8
+
+const (
+	ClassRequest         Class = 0x0
+	ClassIndication      Class = 0x1
+	ClassSuccessResponse Class = 0x2
+	ClassErrorResponse   Class = 0x3
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassRequest:
+		return "request"
+	case ClassIndication:
+		return "indication"
+	case ClassSuccessResponse:
+		return "success response"
+	case ClassErrorResponse:
+		return "error response"
+	}
+	return fmt.Sprintf("class 0x%x", uint8(c))
+}
+
+// MessageType is the type of a message, its method and class.
+type MessageType struct {
+	Method Method
+	Class  Class
+}
+
+// https://tools.ietf.org/html/rfc5389#section-6
+//
+//	 0                 1
+//	 2  3  4 5 6 7 8 9 0 1 2 3 4 5
+//	+--+--+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|M |M |M|M|M|C|M|M|M|C|M|M|M|M|
+//	|11|10|9|8|7|1|6|5|4|0|3|2|1|0|
+//	+--+--+-+-+-+-+-+-+-+-+-+-+-+-+
+func (t MessageType) Value() uint16 {
+	m, c := uint16(t.Method), uint16(t.Class)
+	return m&0xf | (m&0x70)<<1 | (m&0xf80)<<2 | (c&1)<<4 | (c&2)<<7
+}
+
+func parseMessageType(v uint16) MessageType {
+	m := v&0xf | (v>>1)&0x70 | (v>>2)&0xf80
+	c := (v>>4)&1 | (v>>7)&2
+	return MessageType{Method: Method(m), Class: Class(c)}
+}
+
+func (t MessageType) String() string {
+	return fmt.Sprintf("method 0x%03x %s", uint16(t.Method), t.Class)
+}
+
+// AttrType is the type of an attribute.
+type AttrType uint16
+
+// https://tools.ietf.org/html/rfc5389#section-18.2
+const (
+	AttrMappedAddress     AttrType = 0x0001
+	AttrUsername          AttrType = 0x0006
+	AttrMessageIntegrity  AttrType = 0x0008
+	AttrErrorCode         AttrType = 0x0009
+	AttrUnknownAttributes AttrType = 0x000A
+	AttrRealm             AttrType = 0x0014
+	AttrNonce             AttrType = 0x0015
+	AttrXORMappedAddress  AttrType = 0x0020
+	AttrSoftware          AttrType = 0x8022
+	AttrAlternateServer   AttrType = 0x8023
+	AttrFingerprint       AttrType = 0x8028
+)
+
+// Required reports whether the attribute is comprehension-required: an
+// agent not knowing it must reject the message.
+func (t AttrType) Required() bool {
+	return t < 0x8000
+}
+
+// Attribute is an attribute of a message, with its unpadded value.
+type Attribute struct {
+	Type  AttrType
+	Value []byte
+}
+
+// Message is a STUN message.
+type Message struct {
+	Type          MessageType
+	TransactionID [TransactionIDSize]byte
+	Attributes    []Attribute
+
+	// raw is the message decoded, to check its MESSAGE-INTEGRITY and
+	// FINGERPRINT against the bytes received; Encode ignores it.
+	raw []byte
+}
+
+// NewMessage returns a message of method and class with a random
+// transaction ID.
+func NewMessage(method Method, class Class) *Message {
+	m := &Message{Type: MessageType{Method: method, Class: class}}
+	if _, err := rand.Read(m.TransactionID[:]); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// NewResponse returns a response of class to the request req, with its
+// method and transaction ID.
+func NewResponse(req *Message, class Class) *Message {
+	return &Message{Type: MessageType{Method: req.Type.Method, Class: class}, TransactionID: req.TransactionID}
+}
+
+// Add appends an attribute of type t and value v.
+func (m *Message) Add(t AttrType, v []byte) {
+	m.Attributes = append(m.Attributes, Attribute{Type: t, Value: v})
+	m.raw = nil
+}
+
+// Get returns the value of the first attribute of type t.
+func (m *Message) Get(t AttrType) ([]byte, bool) {
+	for _, a := range m.Attributes {
+		if a.Type == t {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+func padding(n int) int {
+	return (4 - n%4) % 4
+}
+
+// Encode returns the wire format of m, attributes padded with zeros.
+func (m *Message) Encode() []byte {
+	size := headerSize
+	for _, a := range m.Attributes {
+		size += attrHeaderLen + len(a.Value) + padding(len(a.Value))
+	}
+	b := make([]byte, size)
+	binary.BigEndian.PutUint16(b[0:], m.Type.Value())
+	binary.BigEndian.PutUint16(b[2:], uint16(size-headerSize))
+	binary.BigEndian.PutUint32(b[4:], MagicCookie)
+	copy(b[8:], m.TransactionID[:])
+	off := headerSize
+	for _, a := range m.Attributes {
+		binary.BigEndian.PutUint16(b[off:], uint16(a.Type))
+		binary.BigEndian.PutUint16(b[off+2:], uint16(len(a.Value)))
+		copy(b[off+attrHeaderLen:], a.Value)
+		off += attrHeaderLen + len(a.Value) + padding(len(a.Value))
+	}
+	return b
+}
+
+// received returns the bytes m was decoded from, or its encoding if m was
+// not decoded, or had attributes added since.
+func (m *Message) received() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+	return m.Encode()
+}
+
+// IsMessage reports whether b starts like a STUN message: two zero bits,
+// then the magic cookie at its place.
+func IsMessage(b []byte) bool {
+	return len(b) >= headerSize && b[0]&0xc0 == 0 && binary.BigEndian.Uint32(b[4:]) == MagicCookie
+}
+
+// messageLength returns the size of the message of header b, header
+// included.
+func messageLength(b []byte) int {
+	return headerSize + int(binary.BigEndian.Uint16(b[2:]))
+}
+
+// Decode parses the STUN message b.
+func Decode(b []byte) (*Message, error) {
+	if !IsMessage(b) {
+		return nil, ErrNotSTUNMessage
+	}
+	size := messageLength(b)
+	if size%4 != 0 {
+		return nil, ErrNotSTUNMessage
+	}
+	if len(b) < size {
+		return nil, ErrTruncated
+	}
+	b = b[:size]
+	m := &Message{Type: parseMessageType(binary.BigEndian.Uint16(b[0:]))}
+	copy(m.TransactionID[:], b[8:headerSize])
+	for off := headerSize; off < size; {
+		if size-off < attrHeaderLen {
+			return nil, ErrTruncated
+		}
+		t := AttrType(binary.BigEndian.Uint16(b[off:]))
+		n := int(binary.BigEndian.Uint16(b[off+2:]))
+		off += attrHeaderLen
+		if size-off < n {
+			return nil, ErrTruncated
+		}
+		m.Attributes = append(m.Attributes, Attribute{Type: t, Value: append([]byte(nil), b[off:off+n]...)})
+		off += n + padding(n)
+	}
+	m.raw = append([]byte(nil), b...)
+	return m, nil
+}
+
+// attrOffset returns the offset of the first attribute of type t in the
+// encoding of m.
+func (m *Message) attrOffset(t AttrType) (int, bool) {
+	off := headerSize
+	for _, a := range m.Attributes {
+		if a.Type == t {
+			return off, true
+		}
+		off += attrHeaderLen + len(a.Value) + padding(len(a.Value))
+	}
+	return 0, false
+}
+
+func (m *Message) String() string {
+	return fmt.Sprintf("%s tid=%x attrs=%d", m.Type, m.TransactionID, len(m.Attributes))
+}
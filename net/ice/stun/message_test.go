@@ -0,0 +1,150 @@
+package stun
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// https://tools.ietf.org/html/rfc5769#section-2.1
+const sampleRequest = `
+00 01 00 58 21 12 a4 42 b7 e7 a7 01 bc 34 d6 86 fa 87 df ae
+80 22 00 10 53 54 55 4e 20 74 65 73 74 20 63 6c 69 65 6e 74
+00 24 00 04 6e 00 01 ff
+80 29 00 08 93 2f f9 b1 51 26 3b 36
+00 06 00 09 65 76 74 6a 3a 68 36 76 59 20 20 20
+00 08 00 14 9a ea a7 0c bf d8 cb 56 78 1e f2 b5 b2 d3 f2 49 c1 b5 71 a2
+80 28 00 04 e5 7a 3b cf`
+
+// https://tools.ietf.org/html/rfc5769#section-2.2
+const sampleIPv4Response = `
+01 01 00 3c 21 12 a4 42 b7 e7 a7 01 bc 34 d6 86 fa 87 df ae
+80 22 00 0b 74 65 73 74 20 76 65 63 74 6f 72 20
+00 20 00 08 00 01 a1 47 e1 12 a6 43
+00 08 00 14 2b 91 f5 99 fd 9e 90 c3 8c 74 89 f9 2a f9 ba 53 f0 6b e7 d7
+80 28 00 04 c0 7d 4c 96`
+
+const samplePassword = "VOkJxbRl1RmTxUk/WvJxBt"
+
+func TestDecodeSampleRequest(t *testing.T) {
+	m, err := Decode(unhex(t, sampleRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != (MessageType{Method: MethodBinding, Class: ClassRequest}) {
+		t.Errorf("Type = %v", m.Type)
+	}
+	if got, _ := m.GetString(AttrUsername); got != "evtj:h6vY" {
+		t.Errorf("USERNAME = %q", got)
+	}
+	if got, _ := m.GetString(AttrSoftware); got != "STUN test client" {
+		t.Errorf("SOFTWARE = %q", got)
+	}
+	if err := m.CheckMessageIntegrity(ShortTermKey(samplePassword)); err != nil {
+		t.Errorf("CheckMessageIntegrity: %v", err)
+	}
+	if err := m.CheckMessageIntegrity(ShortTermKey("wrong")); err != ErrIntegrityMismatch {
+		t.Errorf("CheckMessageIntegrity with a wrong key = %v", err)
+	}
+	if err := m.CheckFingerprint(); err != nil {
+		t.Errorf("CheckFingerprint: %v", err)
+	}
+}
+
+func TestDecodeSampleIPv4Response(t *testing.T) {
+	m, err := Decode(unhex(t, sampleIPv4Response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != (MessageType{Method: MethodBinding, Class: ClassSuccessResponse}) {
+		t.Errorf("Type = %v", m.Type)
+	}
+	ip, port, err := m.XORAddress(AttrXORMappedAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("192.0.2.1")) || port != 32853 {
+		t.Errorf("XOR-MAPPED-ADDRESS = %v:%d", ip, port)
+	}
+	if err := m.CheckMessageIntegrity(ShortTermKey(samplePassword)); err != nil {
+		t.Errorf("CheckMessageIntegrity: %v", err)
+	}
+	if err := m.CheckFingerprint(); err != nil {
+		t.Errorf("CheckFingerprint: %v", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	m := NewMessage(MethodBinding, ClassSuccessResponse)
+	m.AddXORAddress(AttrXORMappedAddress, net.ParseIP("2001:db8::1"), 4711)
+	m.AddString(AttrSoftware, "odd")
+	key := LongTermKey("user", "realm", "pass")
+	m.AddMessageIntegrity(key)
+	m.AddFingerprint()
+
+	b := m.Encode()
+	if len(b)%4 != 0 {
+		t.Fatalf("encoded size %d not padded", len(b))
+	}
+	got, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != m.Type || got.TransactionID != m.TransactionID || len(got.Attributes) != len(m.Attributes) {
+		t.Fatalf("Decode = %v, want %v", got, m)
+	}
+	ip, port, err := got.XORAddress(AttrXORMappedAddress)
+	if err != nil || !ip.Equal(net.ParseIP("2001:db8::1")) || port != 4711 {
+		t.Errorf("XOR-MAPPED-ADDRESS = %v:%d, %v", ip, port, err)
+	}
+	if err := got.CheckMessageIntegrity(key); err != nil {
+		t.Errorf("CheckMessageIntegrity: %v", err)
+	}
+	if err := got.CheckFingerprint(); err != nil {
+		t.Errorf("CheckFingerprint: %v", err)
+	}
+
+	b[len(b)-1] ^= 1
+	if got, err = Decode(b); err != nil || got.CheckFingerprint() != ErrFingerprintMismatch {
+		t.Errorf("CheckFingerprint of a corrupted message = %v, %v", got.CheckFingerprint(), err)
+	}
+	if _, err := Decode(b[:len(b)-4]); err != ErrTruncated {
+		t.Errorf("Decode of a truncated message = %v", err)
+	}
+	if _, err := Decode(bytes.Repeat([]byte{0xff}, 20)); err != ErrNotSTUNMessage {
+		t.Errorf("Decode of garbage = %v", err)
+	}
+}
+
+func TestEncodeDecodedMutated(t *testing.T) {
+	req := NewMessage(MethodBinding, ClassRequest)
+	req.AddString(AttrSoftware, "odd")
+	m, err := Decode(req.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Type.Class = ClassSuccessResponse
+	m.TransactionID[0] ^= 0xff
+	m.Attributes[0].Value = []byte("even")
+
+	got, err := Decode(m.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != m.Type || got.TransactionID != m.TransactionID {
+		t.Errorf("Decode(Encode()) = %v %x, want %v %x", got.Type, got.TransactionID, m.Type, m.TransactionID)
+	}
+	if v, _ := got.Get(AttrSoftware); string(v) != "even" {
+		t.Errorf("SOFTWARE = %q, want %q", v, "even")
+	}
+}
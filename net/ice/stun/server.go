@@ -0,0 +1,139 @@
+package stun
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Server is a minimal STUN server, for local tests: it answers Binding
+// requests with the XOR-MAPPED-ADDRESS of their source, without
+// authentication. Other requests are answered 400 Bad Request.
+type Server struct {
+	// Software, if not empty, is sent as the SOFTWARE of responses.
+	Software string
+
+	mu      sync.Mutex
+	closers map[io.Closer]struct{} // listeners and conns served
+}
+
+// knownAttributes are the comprehension-required attributes the server
+// understands.
+var knownAttributes = []AttrType{AttrMappedAddress, AttrUsername, AttrMessageIntegrity,
+	AttrErrorCode, AttrUnknownAttributes, AttrRealm, AttrNonce, AttrXORMappedAddress}
+
+// Handle returns the response to the message req from the address from,
+// or nil if none is due.
+func (srv *Server) Handle(req *Message, from net.Addr) *Message {
+	if req.Type.Class != ClassRequest {
+		return nil
+	}
+	var resp *Message
+	switch unknown := req.UnknownRequiredAttributes(knownAttributes...); {
+	case len(unknown) > 0:
+		resp = NewResponse(req, ClassErrorResponse)
+		resp.AddErrorCode(CodeUnknownAttribute, "Unknown Attribute")
+		resp.AddUnknownAttributes(unknown)
+	case req.Type.Method != MethodBinding:
+		resp = NewResponse(req, ClassErrorResponse)
+		resp.AddErrorCode(CodeBadRequest, "Bad Request")
+	default:
+		resp = NewResponse(req, ClassSuccessResponse)
+		switch addr := from.(type) {
+		case *net.UDPAddr:
+			resp.AddXORAddress(AttrXORMappedAddress, addr.IP, addr.Port)
+		case *net.TCPAddr:
+			resp.AddXORAddress(AttrXORMappedAddress, addr.IP, addr.Port)
+		}
+	}
+	if srv.Software != "" {
+		resp.AddString(AttrSoftware, srv.Software)
+	}
+	resp.AddFingerprint()
+	return resp
+}
+
+// ServePacket answers the requests received on conn, such as a UDP conn,
+// until conn is closed.
+func (srv *Server) ServePacket(conn net.PacketConn) error {
+	srv.track(conn, true)
+	defer srv.track(conn, false)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		req, err := Decode(buf[:n])
+		if err != nil || req.CheckFingerprint() != nil {
+			continue
+		}
+		if resp := srv.Handle(req, from); resp != nil {
+			conn.WriteTo(resp.Encode(), from)
+		}
+	}
+}
+
+// Serve answers the requests received on the connections accepted from l,
+// such as a TCP or TLS listener, until l is closed.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.track(l, true)
+	defer srv.track(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	srv.track(conn, true)
+	defer srv.track(conn, false)
+	defer conn.Close()
+	for {
+		req, err := ReadMessage(conn)
+		if err != nil && err != ErrTruncated {
+			return
+		}
+		if err != nil || req.CheckFingerprint() != nil {
+			continue
+		}
+		if resp := srv.Handle(req, conn.RemoteAddr()); resp != nil {
+			if _, err := conn.Write(resp.Encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// track adds c to, or removes it from, the closers of srv.
+func (srv *Server) track(c io.Closer, add bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closers == nil {
+		srv.closers = make(map[io.Closer]struct{})
+	}
+	if add {
+		srv.closers[c] = struct{}{}
+	} else {
+		delete(srv.closers, c)
+	}
+}
+
+// Close closes the listeners, packet conns and connections being served.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.closers {
+		c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,648 @@
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/searKing/golib/net/ice"
+	"github.com/searKing/golib/net/ice/stun"
+)
+
+var (
+	ErrClosed       = errors.New("turn: allocation closed")
+	ErrNoRelayed    = errors.New("turn: no XOR-RELAYED-ADDRESS in response")
+	errUnauthorized = errors.New("turn: no REALM or NONCE in 401 response")
+)
+
+// permissionTimeout bounds the CreatePermission sent by WriteTo to a new
+// peer, when no write deadline is set.
+const permissionTimeout = 10 * time.Second
+
+// Client allocates relayed transport addresses on TURN servers, with the
+// long-term credential mechanism.
+type Client struct {
+	// STUN dials the servers and sends the Allocate requests; its Dialer,
+	// TLSConfig, RTO and Retransmits apply. If nil, stun.DefaultClient is used.
+	STUN *stun.Client
+	// Username and Password are the long-term credentials.
+	Username string
+	Password string
+	// Lifetime is the lifetime requested for allocations. If zero, the
+	// server chooses.
+	Lifetime time.Duration
+}
+
+// DefaultClient is the Client used by Allocate.
+var DefaultClient = &Client{}
+
+func (c *Client) stun() *stun.Client {
+	if c.STUN == nil {
+		return stun.DefaultClient
+	}
+	return c.STUN
+}
+
+// Allocate allocates a UDP relayed transport address on the TURN server of u
+// with DefaultClient, which has no credentials.
+func Allocate(ctx context.Context, u *ice.URL) (*Allocation, error) {
+	return DefaultClient.Allocate(ctx, u)
+}
+
+// Allocate allocates a UDP relayed transport address on the TURN server of
+// u, over the transport of u. The allocation is refreshed until it is
+// closed.
+func (c *Client) Allocate(ctx context.Context, u *ice.URL) (*Allocation, error) {
+	conn, err := c.stun().Dial(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	a := &Allocation{
+		client:    c,
+		conn:      conn,
+		stream:    u.Proto != ice.TransportUDP,
+		pending:   make(map[[stun.TransactionIDSize]byte]chan *stun.Message),
+		perms:     make(map[string]bool),
+		channels:  make(map[string]uint16),
+		peers:     make(map[uint16]*net.UDPAddr),
+		next:      MinChannelNumber,
+		packets:   make(chan packet, 64),
+		closed:    make(chan struct{}),
+		deadlineC: make(chan struct{}),
+	}
+	if err := a.allocate(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go a.readLoop()
+	go a.refreshLoop()
+	return a, nil
+}
+
+// packet is a packet received from a peer through the relay.
+type packet struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// Allocation is a relayed transport address on a TURN server, used as a
+// net.PacketConn: packets written to peers are relayed by the server, and
+// packets the peers send to the relayed address are read.
+// Writing to a new peer installs a permission for its IP first; ChannelBind
+// makes the relay of the packets of a peer cheaper.
+type Allocation struct {
+	client *Client
+	conn   net.Conn
+	stream bool
+
+	relayed  *net.UDPAddr
+	mapped   net.Addr
+	lifetime time.Duration
+
+	mu       sync.Mutex
+	realm    string
+	nonce    string
+	key      []byte
+	pending  map[[stun.TransactionIDSize]byte]chan *stun.Message
+	perms    map[string]bool // by peer IP
+	channels map[string]uint16
+	peers    map[uint16]*net.UDPAddr // by channel
+	next     uint16                  // next channel number
+
+	packets       chan packet
+	closed        chan struct{}
+	closeOnce     sync.Once
+	err           error // why closed
+	readDeadline  time.Time
+	writeDeadline time.Time
+	deadlineC     chan struct{} // closed when readDeadline changes
+}
+
+// allocate sends the Allocate request, authenticated once the server sent
+// its realm and nonce.
+func (a *Allocation) allocate(ctx context.Context) error {
+	var resp *stun.Message
+	for attempt := 0; attempt < 3; attempt++ {
+		req := stun.NewMessage(MethodAllocate, stun.ClassRequest)
+		req.Add(AttrRequestedTransport, []byte{protoUDP, 0, 0, 0})
+		if a.client.Lifetime > 0 {
+			addLifetime(req, a.client.Lifetime)
+		}
+		a.authenticate(req)
+		var err error
+		resp, err = a.client.stun().Do(ctx, a.conn, req)
+		if e, ok := err.(*stun.Error); ok && a.retryAuth(resp, e) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	if resp.Type.Class != stun.ClassSuccessResponse {
+		return errUnauthorized
+	}
+	if err := a.checkIntegrity(resp); err != nil {
+		return err
+	}
+	ip, port, err := resp.XORAddress(AttrXORRelayedAddress)
+	if err != nil {
+		return ErrNoRelayed
+	}
+	a.relayed = &net.UDPAddr{IP: ip, Port: port}
+	if ip, port, err := resp.XORAddress(stun.AttrXORMappedAddress); err == nil {
+		if a.stream {
+			a.mapped = &net.TCPAddr{IP: ip, Port: port}
+		} else {
+			a.mapped = &net.UDPAddr{IP: ip, Port: port}
+		}
+	}
+	a.lifetime, _ = lifetime(resp)
+	if a.lifetime == 0 {
+		a.lifetime = DefaultLifetime
+	}
+	return nil
+}
+
+// authenticate adds the credentials to req, once the realm is known.
+func (a *Allocation) authenticate(req *stun.Message) {
+	a.mu.Lock()
+	realm, nonce, key := a.realm, a.nonce, a.key
+	a.mu.Unlock()
+	if realm == "" {
+		return
+	}
+	req.AddString(stun.AttrUsername, a.client.Username)
+	req.AddString(stun.AttrRealm, realm)
+	req.AddString(stun.AttrNonce, nonce)
+	req.AddMessageIntegrity(key)
+}
+
+// retryAuth takes the realm and nonce of a 401 or 438 response, and
+// reports whether the request is to be sent again with them.
+func (a *Allocation) retryAuth(resp *stun.Message, e *stun.Error) bool {
+	if e.Code != stun.CodeUnauthorized && e.Code != stun.CodeStaleNonce {
+		return false
+	}
+	realm, _ := resp.GetString(stun.AttrRealm)
+	nonce, ok := resp.GetString(stun.AttrNonce)
+	if !ok {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e.Code == stun.CodeUnauthorized && a.realm != "" && a.nonce == nonce {
+		// the credentials were rejected
+		return false
+	}
+	if realm != "" && realm != a.realm {
+		a.realm = realm
+		a.key = stun.LongTermKey(a.client.Username, realm, a.client.Password)
+	}
+	a.nonce = nonce
+	return a.realm != ""
+}
+
+// checkIntegrity checks the MESSAGE-INTEGRITY of resp, if any.
+func (a *Allocation) checkIntegrity(resp *stun.Message) error {
+	if _, ok := resp.Get(stun.AttrMessageIntegrity); !ok {
+		return nil
+	}
+	a.mu.Lock()
+	key := a.key
+	a.mu.Unlock()
+	return resp.CheckMessageIntegrity(key)
+}
+
+// do sends a request of method, with the attributes set by build, once
+// the allocation is made, authenticated.
+func (a *Allocation) do(ctx context.Context, method stun.Method, build func(req *stun.Message)) (*stun.Message, error) {
+	for attempt := 0; ; attempt++ {
+		req := stun.NewMessage(method, stun.ClassRequest)
+		build(req)
+		a.authenticate(req)
+		resp, err := a.roundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Type.Class == stun.ClassErrorResponse {
+			e, err := resp.ErrorCode()
+			if err != nil {
+				return nil, err
+			}
+			if attempt == 0 && a.retryAuth(resp, e) {
+				continue
+			}
+			return nil, e
+		}
+		if err := a.checkIntegrity(resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// roundTrip sends req and waits for its response from readLoop,
+// retransmitting req over UDP.
+func (a *Allocation) roundTrip(ctx context.Context, req *stun.Message) (*stun.Message, error) {
+	ch := make(chan *stun.Message, 1)
+	a.mu.Lock()
+	a.pending[req.TransactionID] = ch
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, req.TransactionID)
+		a.mu.Unlock()
+	}()
+
+	sc := a.client.stun()
+	rto, retransmits := sc.RTO, sc.Retransmits
+	if rto <= 0 {
+		rto = stun.DefaultRTO
+	}
+	if retransmits <= 0 {
+		retransmits = stun.DefaultRetransmits
+	}
+	wait := 16 * rto
+	if a.stream {
+		retransmits, wait = 1, stun.DefaultTimeout
+	}
+
+	b := req.Encode()
+	for i := 0; i < retransmits; i++ {
+		if _, err := a.conn.Write(b); err != nil {
+			return nil, err
+		}
+		d := rto << uint(i)
+		if i == retransmits-1 {
+			d = wait
+		}
+		timer := time.NewTimer(d)
+		select {
+		case resp := <-ch:
+			timer.Stop()
+			return resp, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-a.closed:
+			timer.Stop()
+			return nil, a.closeErr()
+		case <-timer.C:
+		}
+	}
+	return nil, stun.ErrTimeout
+}
+
+// readLoop dispatches the messages received from the server until the
+// connection fails.
+func (a *Allocation) readLoop() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		var b []byte
+		if a.stream {
+			frame, err := readFrame(a.conn)
+			if err != nil {
+				a.closeWithError(err)
+				return
+			}
+			b = frame
+		} else {
+			n, err := a.conn.Read(buf)
+			if err != nil {
+				a.closeWithError(err)
+				return
+			}
+			b = buf[:n]
+		}
+		a.dispatch(b)
+	}
+}
+
+func (a *Allocation) dispatch(b []byte) {
+	if isChannelData(b) {
+		ch, data, err := decodeChannelData(b)
+		if err != nil {
+			return
+		}
+		a.mu.Lock()
+		peer := a.peers[ch]
+		a.mu.Unlock()
+		if peer != nil {
+			a.deliver(data, peer)
+		}
+		return
+	}
+
+	m, err := stun.Decode(b)
+	if err != nil || m.CheckFingerprint() != nil {
+		return
+	}
+	switch m.Type.Class {
+	case stun.ClassIndication:
+		if m.Type.Method != MethodData {
+			return
+		}
+		ip, port, err := m.XORAddress(AttrXORPeerAddress)
+		data, ok := m.Get(AttrData)
+		if err != nil || !ok {
+			return
+		}
+		a.deliver(data, &net.UDPAddr{IP: ip, Port: port})
+	case stun.ClassSuccessResponse, stun.ClassErrorResponse:
+		a.mu.Lock()
+		ch := a.pending[m.TransactionID]
+		a.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- m:
+			default:
+			}
+		}
+	}
+}
+
+// deliver queues a packet for ReadFrom, dropping it if the queue is full.
+func (a *Allocation) deliver(data []byte, from *net.UDPAddr) {
+	p := packet{data: append([]byte(nil), data...), from: from}
+	select {
+	case a.packets <- p:
+	default:
+	}
+}
+
+// refreshInterval returns the interval between refreshes of an allocation
+// of lifetime, before permissions expire.
+func refreshInterval(lifetime time.Duration) time.Duration {
+	d := lifetime / 2
+	if d > PermissionLifetime-time.Minute {
+		d = PermissionLifetime - time.Minute
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// refreshLoop refreshes the allocation, its permissions and channels until
+// the allocation is closed.
+func (a *Allocation) refreshLoop() {
+	ticker := time.NewTicker(refreshInterval(a.lifetime))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.closed:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), refreshInterval(a.lifetime))
+		a.Refresh(ctx, a.client.Lifetime)
+		a.mu.Lock()
+		var ips []net.IP
+		for ip := range a.perms {
+			ips = append(ips, net.ParseIP(ip))
+		}
+		peers := make([]*net.UDPAddr, 0, len(a.peers))
+		for _, peer := range a.peers {
+			peers = append(peers, peer)
+		}
+		a.mu.Unlock()
+		if len(ips) > 0 {
+			a.CreatePermission(ctx, ips...)
+		}
+		for _, peer := range peers {
+			a.ChannelBind(ctx, peer)
+		}
+		cancel()
+	}
+}
+
+// Refresh refreshes the allocation for lifetime, or the lifetime the server
+// chooses if zero.
+func (a *Allocation) Refresh(ctx context.Context, lifetime time.Duration) error {
+	_, err := a.do(ctx, MethodRefresh, func(req *stun.Message) {
+		if lifetime > 0 {
+			addLifetime(req, lifetime)
+		}
+	})
+	return err
+}
+
+// CreatePermission installs or refreshes the permissions of the peers of
+// IP ips to send packets to the relayed address.
+func (a *Allocation) CreatePermission(ctx context.Context, ips ...net.IP) error {
+	_, err := a.do(ctx, MethodCreatePermission, func(req *stun.Message) {
+		for _, ip := range ips {
+			req.AddXORAddress(AttrXORPeerAddress, ip, 0)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	for _, ip := range ips {
+		a.perms[ip.String()] = true
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// ChannelBind binds a channel to peer, or refreshes its binding, and
+// returns its number. Packets from and to peer are then relayed in
+// ChannelData messages.
+func (a *Allocation) ChannelBind(ctx context.Context, peer *net.UDPAddr) (uint16, error) {
+	a.mu.Lock()
+	ch, ok := a.channels[peerKey(peer)]
+	if !ok {
+		if a.next > MaxChannelNumber {
+			a.mu.Unlock()
+			return 0, ErrNoChannelNumber
+		}
+		ch = a.next
+		a.next++
+	}
+	a.mu.Unlock()
+
+	_, err := a.do(ctx, MethodChannelBind, func(req *stun.Message) {
+		addChannelNumber(req, ch)
+		req.AddXORAddress(AttrXORPeerAddress, peer.IP, peer.Port)
+	})
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	a.channels[peerKey(peer)] = ch
+	a.peers[ch] = peer
+	a.perms[peer.IP.String()] = true
+	a.mu.Unlock()
+	return ch, nil
+}
+
+// ReadFrom reads a packet relayed from a peer.
+func (a *Allocation) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	for {
+		a.mu.Lock()
+		deadline, deadlineC := a.readDeadline, a.deadlineC
+		a.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, timeoutError{}
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		deadlineChanged := false
+		select {
+		case pkt := <-a.packets:
+			n, addr = copy(p, pkt.data), pkt.from
+		case <-a.closed:
+			err = a.closeErr()
+		case <-timeout:
+			err = timeoutError{}
+		case <-deadlineC:
+			deadlineChanged = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !deadlineChanged {
+			return n, addr, err
+		}
+	}
+}
+
+// WriteTo sends p to the peer addr through the relay, installing a
+// permission for the IP of addr first if there is none.
+func (a *Allocation) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	peer, ok := addr.(*net.UDPAddr)
+	if !ok {
+		if peer, err = net.ResolveUDPAddr("udp", addr.String()); err != nil {
+			return 0, err
+		}
+	}
+	select {
+	case <-a.closed:
+		return 0, a.closeErr()
+	default:
+	}
+
+	a.mu.Lock()
+	ch, bound := a.channels[peerKey(peer)]
+	permitted := a.perms[peer.IP.String()]
+	deadline := a.writeDeadline
+	a.mu.Unlock()
+
+	if bound {
+		if _, err := a.conn.Write(encodeChannelData(ch, p, a.stream)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if !permitted {
+		if deadline.IsZero() {
+			deadline = time.Now().Add(permissionTimeout)
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		err := a.CreatePermission(ctx, peer.IP)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return 0, timeoutError{}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	ind := stun.NewMessage(MethodSend, stun.ClassIndication)
+	ind.AddXORAddress(AttrXORPeerAddress, peer.IP, peer.Port)
+	ind.Add(AttrData, p)
+	if _, err := a.conn.Write(ind.Encode()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close deletes the allocation on the server and closes the connection to it.
+func (a *Allocation) Close() error {
+	select {
+	case <-a.closed:
+		return nil
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	a.do(ctx, MethodRefresh, func(req *stun.Message) { addLifetime(req, 0) })
+	a.closeWithError(ErrClosed)
+	return nil
+}
+
+func (a *Allocation) closeWithError(err error) {
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.err = err
+		a.mu.Unlock()
+		close(a.closed)
+		a.conn.Close()
+	})
+}
+
+func (a *Allocation) closeErr() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// LocalAddr returns the relayed transport address.
+func (a *Allocation) LocalAddr() net.Addr {
+	return a.relayed
+}
+
+// RelayedAddr returns the relayed transport address, to give to peers.
+func (a *Allocation) RelayedAddr() *net.UDPAddr {
+	return a.relayed
+}
+
+// ReflexiveAddr returns the server reflexive address of the client, as
+// the server sees it, or nil if it didn't tell.
+func (a *Allocation) ReflexiveAddr() net.Addr {
+	return a.mapped
+}
+
+// Lifetime returns the lifetime the server granted.
+func (a *Allocation) Lifetime() time.Duration {
+	return a.lifetime
+}
+
+func (a *Allocation) SetDeadline(t time.Time) error {
+	a.SetReadDeadline(t)
+	return a.SetWriteDeadline(t)
+}
+
+func (a *Allocation) SetReadDeadline(t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.readDeadline = t
+	close(a.deadlineC)
+	a.deadlineC = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the permissions WriteTo installs;
+// packets are sent without blocking.
+func (a *Allocation) SetWriteDeadline(t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writeDeadline = t
+	return nil
+}
+
+// timeoutError is the error of deadlines, a net.Error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "turn: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,508 @@
+package turn
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/searKing/golib/net/ice/stun"
+)
+
+// maxLifetime bounds the lifetime of the allocations of Server.
+const maxLifetime = time.Hour
+
+// Server is a minimal TURN server, for local tests: it relays UDP for the
+// clients authenticated with the long-term credentials of Credentials, from
+// relayed addresses on RelayIP. It answers Binding requests as a
+// stun.Server; EVEN-PORT, DONT-FRAGMENT and RESERVATION-TOKEN are not
+// supported.
+type Server struct {
+	// Realm is the realm of the credentials.
+	Realm string
+	// Credentials are the passwords of the users, by username.
+	Credentials map[string]string
+	// RelayIP is the IP of relayed addresses. If nil, 127.0.0.1 is used.
+	RelayIP net.IP
+	// Software, if not empty, is sent as the SOFTWARE of responses.
+	Software string
+
+	mu          sync.Mutex
+	nonce       string
+	allocations map[string]*allocation // by 5-tuple
+	closers     map[io.Closer]struct{} // listeners, conns and relays served
+}
+
+// knownAttributes are the comprehension-required attributes the server
+// understands.
+var knownAttributes = []stun.AttrType{stun.AttrMappedAddress, stun.AttrUsername,
+	stun.AttrMessageIntegrity, stun.AttrErrorCode, stun.AttrUnknownAttributes,
+	stun.AttrRealm, stun.AttrNonce, stun.AttrXORMappedAddress, AttrChannelNumber,
+	AttrLifetime, AttrXORPeerAddress, AttrData, AttrXORRelayedAddress,
+	AttrRequestedTransport}
+
+// transport is a client connection of the server, a 5-tuple.
+type transport struct {
+	key    string
+	from   net.Addr
+	stream bool
+	send   func(b []byte) error
+}
+
+// allocation is the state of an allocation on the server.
+type allocation struct {
+	t       *transport
+	relay   *net.UDPConn
+	expires time.Time
+
+	mu       sync.Mutex
+	perms    map[string]time.Time // expiry by peer IP
+	channels map[uint16]*channel
+	byPeer   map[string]uint16
+}
+
+type channel struct {
+	peer    *net.UDPAddr
+	expires time.Time
+}
+
+// ServePacket relays for the clients of conn, such as a UDP conn, until
+// conn is closed.
+func (srv *Server) ServePacket(conn net.PacketConn) error {
+	srv.track(conn, true)
+	defer srv.track(conn, false)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		t := &transport{
+			key:  "udp " + conn.LocalAddr().String() + " " + from.String(),
+			from: from,
+			send: func(b []byte) error {
+				_, err := conn.WriteTo(b, from)
+				return err
+			},
+		}
+		srv.handle(t, buf[:n])
+	}
+}
+
+// Serve relays for the clients of the connections accepted from l, such as
+// a TCP or TLS listener, until l is closed.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.track(l, true)
+	defer srv.track(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	srv.track(conn, true)
+	defer srv.track(conn, false)
+	defer conn.Close()
+
+	var mu sync.Mutex // serializes the writes of responses and relayed packets
+	t := &transport{
+		key:    "tcp " + conn.LocalAddr().String() + " " + conn.RemoteAddr().String(),
+		from:   conn.RemoteAddr(),
+		stream: true,
+		send: func(b []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			_, err := conn.Write(b)
+			return err
+		},
+	}
+	// the allocation dies with the connection
+	defer srv.deleteAllocation(t.key)
+	for {
+		b, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		srv.handle(t, b)
+	}
+}
+
+// handle handles the message b received over t.
+func (srv *Server) handle(t *transport, b []byte) {
+	if isChannelData(b) {
+		ch, data, err := decodeChannelData(b)
+		if err != nil {
+			return
+		}
+		a := srv.allocation(t.key)
+		if a == nil {
+			return
+		}
+		a.mu.Lock()
+		c := a.channels[ch]
+		a.mu.Unlock()
+		if c != nil && time.Now().Before(c.expires) {
+			a.relay.WriteTo(data, c.peer)
+		}
+		return
+	}
+
+	m, err := stun.Decode(b)
+	if err != nil || m.CheckFingerprint() != nil {
+		return
+	}
+	switch m.Type.Class {
+	case stun.ClassIndication:
+		if m.Type.Method == MethodSend {
+			srv.send(t, m)
+		}
+	case stun.ClassRequest:
+		if resp := srv.handleRequest(t, m); resp != nil {
+			t.send(resp.Encode())
+		}
+	}
+}
+
+// send relays the data of the Send indication m to its peer.
+func (srv *Server) send(t *transport, m *stun.Message) {
+	a := srv.allocation(t.key)
+	if a == nil {
+		return
+	}
+	ip, port, err := m.XORAddress(AttrXORPeerAddress)
+	data, ok := m.Get(AttrData)
+	if err != nil || !ok {
+		return
+	}
+	if a.permitted(ip) {
+		a.relay.WriteTo(data, &net.UDPAddr{IP: ip, Port: port})
+	}
+}
+
+// handleRequest returns the response to the request req received over t.
+func (srv *Server) handleRequest(t *transport, req *stun.Message) *stun.Message {
+	if req.Type.Method == stun.MethodBinding {
+		return (&stun.Server{Software: srv.Software}).Handle(req, t.from)
+	}
+	if unknown := req.UnknownRequiredAttributes(knownAttributes...); len(unknown) > 0 {
+		resp := srv.errorResponse(req, stun.CodeUnknownAttribute, "Unknown Attribute")
+		resp.AddUnknownAttributes(unknown)
+		return srv.finish(resp, nil)
+	}
+
+	key, resp := srv.authenticate(req)
+	if resp != nil {
+		return srv.finish(resp, nil)
+	}
+	switch req.Type.Method {
+	case MethodAllocate:
+		resp = srv.allocate(t, req)
+	case MethodRefresh:
+		resp = srv.refresh(t, req)
+	case MethodCreatePermission:
+		resp = srv.createPermission(t, req)
+	case MethodChannelBind:
+		resp = srv.channelBind(t, req)
+	default:
+		resp = srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	return srv.finish(resp, key)
+}
+
+// authenticate checks the long-term credentials of req, returning the key
+// of its user, or the error response to req.
+// https://tools.ietf.org/html/rfc5389#section-10.2.2
+func (srv *Server) authenticate(req *stun.Message) ([]byte, *stun.Message) {
+	nonce := srv.currentNonce()
+	challenge := func(code int, reason string) *stun.Message {
+		resp := srv.errorResponse(req, code, reason)
+		resp.AddString(stun.AttrRealm, srv.Realm)
+		resp.AddString(stun.AttrNonce, nonce)
+		return resp
+	}
+
+	if _, ok := req.Get(stun.AttrMessageIntegrity); !ok {
+		return nil, challenge(stun.CodeUnauthorized, "Unauthorized")
+	}
+	username, ok1 := req.GetString(stun.AttrUsername)
+	realm, ok2 := req.GetString(stun.AttrRealm)
+	reqNonce, ok3 := req.GetString(stun.AttrNonce)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	if reqNonce != nonce {
+		return nil, challenge(stun.CodeStaleNonce, "Stale Nonce")
+	}
+	password, ok := srv.Credentials[username]
+	if !ok || realm != srv.Realm {
+		return nil, challenge(stun.CodeUnauthorized, "Unauthorized")
+	}
+	key := stun.LongTermKey(username, realm, password)
+	if req.CheckMessageIntegrity(key) != nil {
+		return nil, challenge(stun.CodeUnauthorized, "Unauthorized")
+	}
+	return key, nil
+}
+
+// currentNonce returns the nonce of the server, generated on first use.
+func (srv *Server) currentNonce() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.nonce == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		srv.nonce = hex.EncodeToString(b)
+	}
+	return srv.nonce
+}
+
+func (srv *Server) errorResponse(req *stun.Message, code int, reason string) *stun.Message {
+	resp := stun.NewResponse(req, stun.ClassErrorResponse)
+	resp.AddErrorCode(code, reason)
+	return resp
+}
+
+// finish appends the SOFTWARE, the MESSAGE-INTEGRITY computed with key, if
+// any, and the FINGERPRINT of resp.
+func (srv *Server) finish(resp *stun.Message, key []byte) *stun.Message {
+	if srv.Software != "" {
+		resp.AddString(stun.AttrSoftware, srv.Software)
+	}
+	if key != nil {
+		resp.AddMessageIntegrity(key)
+	}
+	resp.AddFingerprint()
+	return resp
+}
+
+// requestedLifetime returns the lifetime requested by req, bounded.
+func requestedLifetime(req *stun.Message) time.Duration {
+	d, ok := lifetime(req)
+	switch {
+	case !ok:
+		return DefaultLifetime
+	case d > maxLifetime:
+		return maxLifetime
+	}
+	return d
+}
+
+// https://tools.ietf.org/html/rfc5766#section-6.2
+func (srv *Server) allocate(t *transport, req *stun.Message) *stun.Message {
+	if srv.allocation(t.key) != nil {
+		return srv.errorResponse(req, CodeAllocationMismatch, "Allocation Mismatch")
+	}
+	v, ok := req.Get(AttrRequestedTransport)
+	if !ok || len(v) != 4 {
+		return srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	if v[0] != protoUDP {
+		return srv.errorResponse(req, CodeUnsupportedTransportProtocol, "Unsupported Transport Protocol")
+	}
+	d := requestedLifetime(req)
+	if d < DefaultLifetime {
+		d = DefaultLifetime
+	}
+
+	ip := srv.RelayIP
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return srv.errorResponse(req, CodeInsufficientCapacity, "Insufficient Capacity")
+	}
+	a := &allocation{
+		t:        t,
+		relay:    relay,
+		expires:  time.Now().Add(d),
+		perms:    make(map[string]time.Time),
+		channels: make(map[uint16]*channel),
+		byPeer:   make(map[string]uint16),
+	}
+	srv.mu.Lock()
+	if srv.allocations == nil {
+		srv.allocations = make(map[string]*allocation)
+	}
+	srv.allocations[t.key] = a
+	srv.mu.Unlock()
+	srv.track(relay, true)
+	go srv.serveRelay(a)
+
+	resp := stun.NewResponse(req, stun.ClassSuccessResponse)
+	relayed := relay.LocalAddr().(*net.UDPAddr)
+	resp.AddXORAddress(AttrXORRelayedAddress, relayed.IP, relayed.Port)
+	addLifetime(resp, d)
+	switch from := t.from.(type) {
+	case *net.UDPAddr:
+		resp.AddXORAddress(stun.AttrXORMappedAddress, from.IP, from.Port)
+	case *net.TCPAddr:
+		resp.AddXORAddress(stun.AttrXORMappedAddress, from.IP, from.Port)
+	}
+	return resp
+}
+
+// https://tools.ietf.org/html/rfc5766#section-7.2
+func (srv *Server) refresh(t *transport, req *stun.Message) *stun.Message {
+	a := srv.allocation(t.key)
+	if a == nil {
+		return srv.errorResponse(req, CodeAllocationMismatch, "Allocation Mismatch")
+	}
+	d := requestedLifetime(req)
+	if d == 0 {
+		srv.deleteAllocation(t.key)
+	} else {
+		srv.mu.Lock()
+		a.expires = time.Now().Add(d)
+		srv.mu.Unlock()
+	}
+	resp := stun.NewResponse(req, stun.ClassSuccessResponse)
+	addLifetime(resp, d)
+	return resp
+}
+
+// https://tools.ietf.org/html/rfc5766#section-9.2
+func (srv *Server) createPermission(t *transport, req *stun.Message) *stun.Message {
+	a := srv.allocation(t.key)
+	if a == nil {
+		return srv.errorResponse(req, CodeAllocationMismatch, "Allocation Mismatch")
+	}
+	peers, err := req.XORAddresses(AttrXORPeerAddress)
+	if err != nil || len(peers) == 0 {
+		return srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	a.mu.Lock()
+	for _, peer := range peers {
+		a.perms[peer.IP.String()] = time.Now().Add(PermissionLifetime)
+	}
+	a.mu.Unlock()
+	return stun.NewResponse(req, stun.ClassSuccessResponse)
+}
+
+// https://tools.ietf.org/html/rfc5766#section-11.2
+func (srv *Server) channelBind(t *transport, req *stun.Message) *stun.Message {
+	a := srv.allocation(t.key)
+	if a == nil {
+		return srv.errorResponse(req, CodeAllocationMismatch, "Allocation Mismatch")
+	}
+	ch, ok := channelNumber(req)
+	ip, port, err := req.XORAddress(AttrXORPeerAddress)
+	if !ok || err != nil || ch < MinChannelNumber || ch > MaxChannelNumber {
+		return srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	peer := &net.UDPAddr{IP: ip, Port: port}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c := a.channels[ch]; c != nil && peerKey(c.peer) != peerKey(peer) {
+		return srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	if bound, ok := a.byPeer[peerKey(peer)]; ok && bound != ch {
+		return srv.errorResponse(req, stun.CodeBadRequest, "Bad Request")
+	}
+	a.channels[ch] = &channel{peer: peer, expires: time.Now().Add(ChannelLifetime)}
+	a.byPeer[peerKey(peer)] = ch
+	a.perms[ip.String()] = time.Now().Add(PermissionLifetime)
+	return stun.NewResponse(req, stun.ClassSuccessResponse)
+}
+
+// serveRelay relays the packets of the peers received on the relay of a to
+// its client, until the relay is closed.
+func (srv *Server) serveRelay(a *allocation) {
+	defer srv.track(a.relay, false)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, peer, err := a.relay.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if !a.permitted(peer.IP) {
+			continue
+		}
+		a.mu.Lock()
+		ch, bound := a.byPeer[peerKey(peer)]
+		if bound && time.Now().After(a.channels[ch].expires) {
+			bound = false
+		}
+		a.mu.Unlock()
+		if bound {
+			a.t.send(encodeChannelData(ch, buf[:n], a.t.stream))
+			continue
+		}
+		ind := stun.NewMessage(MethodData, stun.ClassIndication)
+		ind.AddXORAddress(AttrXORPeerAddress, peer.IP, peer.Port)
+		ind.Add(AttrData, buf[:n])
+		ind.AddFingerprint()
+		a.t.send(ind.Encode())
+	}
+}
+
+// permitted reports whether a has an unexpired permission for ip.
+func (a *allocation) permitted(ip net.IP) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return time.Now().Before(a.perms[ip.String()])
+}
+
+// allocation returns the allocation of the 5-tuple key, if unexpired.
+func (srv *Server) allocation(key string) *allocation {
+	srv.mu.Lock()
+	a := srv.allocations[key]
+	expired := a != nil && time.Now().After(a.expires)
+	srv.mu.Unlock()
+	if expired {
+		srv.deleteAllocation(key)
+		return nil
+	}
+	return a
+}
+
+func (srv *Server) deleteAllocation(key string) {
+	srv.mu.Lock()
+	a := srv.allocations[key]
+	delete(srv.allocations, key)
+	srv.mu.Unlock()
+	if a != nil {
+		a.relay.Close()
+	}
+}
+
+// track adds c to, or removes it from, the closers of srv.
+func (srv *Server) track(c io.Closer, add bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closers == nil {
+		srv.closers = make(map[io.Closer]struct{})
+	}
+	if add {
+		srv.closers[c] = struct{}{}
+	} else {
+		delete(srv.closers, c)
+	}
+}
+
+// Close closes the listeners, packet conns, connections and relays being
+// served.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.closers {
+		c.Close()
+	}
+	return nil
+}
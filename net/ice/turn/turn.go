@@ -0,0 +1,175 @@
+// https://tools.ietf.org/html/rfc5766
+package turn
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/searKing/golib/net/ice/stun"
+)
+
+// https://tools.ietf.org/html/rfc5766#section-13
+const (
+	MethodAllocate         stun.Method = 0x003
+	MethodRefresh          stun.Method = 0x004
+	MethodSend             stun.Method = 0x006
+	MethodData             stun.Method = 0x007
+	MethodCreatePermission stun.Method = 0x008
+	MethodChannelBind      stun.Method = 0x009
+)
+
+// https://tools.ietf.org/html/rfc5766#section-14
+const (
+	AttrChannelNumber      stun.AttrType = 0x000C
+	AttrLifetime           stun.AttrType = 0x000D
+	AttrXORPeerAddress     stun.AttrType = 0x0012
+	AttrData               stun.AttrType = 0x0013
+	AttrXORRelayedAddress  stun.AttrType = 0x0016
+	AttrEvenPort           stun.AttrType = 0x0018
+	AttrRequestedTransport stun.AttrType = 0x0019
+	AttrDontFragment       stun.AttrType = 0x001A
+	AttrReservationToken   stun.AttrType = 0x0022
+)
+
+// https://tools.ietf.org/html/rfc5766#section-15
+const (
+	CodeForbidden                    = 403
+	CodeAllocationMismatch           = 437
+	CodeWrongCredentials             = 441
+	CodeUnsupportedTransportProtocol = 442
+	CodeAllocationQuotaReached       = 486
+	CodeInsufficientCapacity         = 508
+)
+
+const (
+	// DefaultLifetime is the lifetime of allocations servers grant by default.
+	DefaultLifetime = 10 * time.Minute
+	// PermissionLifetime is the lifetime of permissions.
+	PermissionLifetime = 5 * time.Minute
+	// ChannelLifetime is the lifetime of channel bindings.
+	ChannelLifetime = 10 * time.Minute
+
+	// MinChannelNumber and MaxChannelNumber bound the channel numbers.
+	MinChannelNumber = 0x4000
+	MaxChannelNumber = 0x7FFF
+
+	// protoUDP is the REQUESTED-TRANSPORT of UDP relays, its IP protocol number.
+	protoUDP = 17
+
+	channelDataHeaderSize = 4
+	maxPacketSize         = 1 << 16
+)
+
+var (
+	ErrBadChannelData  = errors.New("turn: malformed ChannelData message")
+	ErrNoChannelNumber = errors.New("turn: no channel number left")
+)
+
+// addLifetime appends a LIFETIME attribute of d, in seconds.
+func addLifetime(m *stun.Message, d time.Duration) {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(d/time.Second))
+	m.Add(AttrLifetime, v)
+}
+
+// lifetime returns the LIFETIME of m.
+func lifetime(m *stun.Message) (time.Duration, bool) {
+	v, ok := m.Get(AttrLifetime)
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return time.Duration(binary.BigEndian.Uint32(v)) * time.Second, true
+}
+
+// addChannelNumber appends a CHANNEL-NUMBER attribute of ch.
+func addChannelNumber(m *stun.Message, ch uint16) {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint16(v, ch)
+	m.Add(AttrChannelNumber, v)
+}
+
+// channelNumber returns the CHANNEL-NUMBER of m.
+func channelNumber(m *stun.Message) (uint16, bool) {
+	v, ok := m.Get(AttrChannelNumber)
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+// isChannelData reports whether b starts like a ChannelData message, its
+// first two bits being 01.
+func isChannelData(b []byte) bool {
+	return len(b) >= channelDataHeaderSize && b[0]&0xc0 == 0x40
+}
+
+// https://tools.ietf.org/html/rfc5766#section-11.4
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|         Channel Number        |            Length             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	/                       Application Data                        /
+//	/                                                               /
+//	|                                                               |
+//	|                               +-------------------------------+
+//	|                               |
+//	+-------------------------------+
+//
+// Over streams, the message is padded to a multiple of four bytes.
+func encodeChannelData(ch uint16, data []byte, stream bool) []byte {
+	size := channelDataHeaderSize + len(data)
+	if stream {
+		size += (4 - len(data)%4) % 4
+	}
+	b := make([]byte, size)
+	binary.BigEndian.PutUint16(b, ch)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(data)))
+	copy(b[channelDataHeaderSize:], data)
+	return b
+}
+
+func decodeChannelData(b []byte) (ch uint16, data []byte, err error) {
+	if !isChannelData(b) {
+		return 0, nil, ErrBadChannelData
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if len(b) < channelDataHeaderSize+n {
+		return 0, nil, ErrBadChannelData
+	}
+	return binary.BigEndian.Uint16(b), b[channelDataHeaderSize : channelDataHeaderSize+n], nil
+}
+
+// readFrame reads a STUN or a ChannelData message from the stream r.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, channelDataHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(header[2:]))
+	switch {
+	case isChannelData(header):
+		n += (4 - n%4) % 4
+	case header[0]&0xc0 == 0:
+		// the rest of the STUN header
+		n += 20 - channelDataHeaderSize
+	default:
+		return nil, stun.ErrNotSTUNMessage
+	}
+	b := make([]byte, channelDataHeaderSize+n)
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[channelDataHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// peerKey returns the key of the peer addr in maps.
+func peerKey(addr *net.UDPAddr) string {
+	return addr.String()
+}
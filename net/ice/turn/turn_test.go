@@ -0,0 +1,136 @@
+package turn
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/searKing/golib/net/ice"
+	"github.com/searKing/golib/net/ice/stun"
+)
+
+func TestAllocation(t *testing.T) {
+	srv := &Server{Realm: "example.org", Credentials: map[string]string{"user": "pass"}}
+	defer srv.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServePacket(pc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	peerAddr := peer.LocalAddr().(*net.UDPAddr)
+
+	client := &Client{Username: "user", Password: "pass"}
+	for _, raw := range []string{
+		"turn:" + pc.LocalAddr().String(),
+		"turn:" + l.Addr().String() + "?transport=tcp",
+	} {
+		u, err := ice.ParseURL(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a, err := client.Allocate(ctx, u)
+		if err != nil {
+			cancel()
+			t.Fatalf("Allocate(%s): %v", raw, err)
+		}
+		if a.ReflexiveAddr() == nil || a.Lifetime() != DefaultLifetime {
+			t.Errorf("Allocate(%s): reflexive %v, lifetime %v", raw, a.ReflexiveAddr(), a.Lifetime())
+		}
+
+		// Send and Data indications, then ChannelData
+		exchange(t, a, peer, "indication")
+		if _, err := a.ChannelBind(ctx, peerAddr); err != nil {
+			t.Errorf("ChannelBind(%s): %v", raw, err)
+		}
+		exchange(t, a, peer, "channel")
+
+		if err := a.Refresh(ctx, time.Minute); err != nil {
+			t.Errorf("Refresh(%s): %v", raw, err)
+		}
+		a.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, _, err := a.ReadFrom(make([]byte, 1)); err == nil {
+			t.Errorf("ReadFrom(%s) after the deadline", raw)
+		} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("ReadFrom(%s) after the deadline = %v", raw, err)
+		}
+		a.Close()
+		cancel()
+		if _, err := a.WriteTo([]byte("x"), peerAddr); err != ErrClosed {
+			t.Errorf("WriteTo(%s) after Close = %v", raw, err)
+		}
+	}
+
+	u, _ := ice.ParseURL("turn:" + pc.LocalAddr().String())
+	bad := &Client{Username: "user", Password: "wrong"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := bad.Allocate(ctx, u); err == nil {
+		t.Error("Allocate with wrong credentials succeeded")
+	} else if e, ok := err.(*stun.Error); !ok || e.Code != stun.CodeUnauthorized {
+		t.Errorf("Allocate with wrong credentials = %v", err)
+	}
+}
+
+// exchange sends msg from a to peer, and back.
+func exchange(t *testing.T, a *Allocation, peer *net.UDPConn, msg string) {
+	t.Helper()
+	if _, err := a.WriteTo([]byte(msg), peer.LocalAddr()); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	buf := make([]byte, 64)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, from, err := peer.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("peer ReadFrom: %v", err)
+	}
+	if string(buf[:n]) != msg || !from.IP.Equal(a.RelayedAddr().IP) || from.Port != a.RelayedAddr().Port {
+		t.Errorf("peer got %q from %v, want %q from %v", buf[:n], from, msg, a.RelayedAddr())
+	}
+
+	reply := []byte("re " + msg)
+	if _, err := peer.WriteTo(reply, from); err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := a.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if !bytes.Equal(buf[:n], reply) || addr.String() != peer.LocalAddr().String() {
+		t.Errorf("ReadFrom = %q from %v, want %q from %v", buf[:n], addr, reply, peer.LocalAddr())
+	}
+}
+
+func TestChannelData(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		b := encodeChannelData(MinChannelNumber, []byte("hello"), stream)
+		if stream && len(b)%4 != 0 {
+			t.Errorf("ChannelData over streams of size %d not padded", len(b))
+		}
+		frame := b
+		if stream {
+			var err error
+			if frame, err = readFrame(bytes.NewReader(b)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ch, data, err := decodeChannelData(frame)
+		if err != nil || ch != MinChannelNumber || string(data) != "hello" {
+			t.Errorf("decodeChannelData = %#x, %q, %v", ch, data, err)
+		}
+	}
+}
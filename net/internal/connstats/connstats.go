@@ -0,0 +1,157 @@
+// Package connstats holds the connection statistics shared by the servers
+// of net/tcp and net/websocket_: error kinds and handler latency histograms.
+package connstats
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An ErrorKind classifies an error seen by a Server, for Stats.
+type ErrorKind int
+
+const (
+	// ErrorKindOther is any error not covered by the kinds below.
+	ErrorKindOther ErrorKind = iota
+	// ErrorKindEOF is io.EOF or io.ErrUnexpectedEOF, the peer went away.
+	ErrorKindEOF
+	// ErrorKindTimeout is a net.Error reporting a timeout.
+	ErrorKindTimeout
+	// ErrorKindTooLarge is a message exceeding Server.MaxBytes.
+	ErrorKindTooLarge
+	// ErrorKindNet is any other network error, such as a reset or a
+	// read on a closed connection.
+	ErrorKindNet
+	// ErrorKindPanic is a panic recovered while serving a connection.
+	ErrorKindPanic
+	// ErrorKindClose is a close frame received from the peer, for
+	// protocols that have one.
+	ErrorKindClose
+)
+
+var errorKindName = map[ErrorKind]string{
+	ErrorKindOther:    "other",
+	ErrorKindEOF:      "eof",
+	ErrorKindTimeout:  "timeout",
+	ErrorKindTooLarge: "too_large",
+	ErrorKindNet:      "net",
+	ErrorKindPanic:    "panic",
+	ErrorKindClose:    "close",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindName[k]
+}
+
+// KindOf classifies err as ErrorKindEOF, ErrorKindTimeout, ErrorKindNet or
+// ErrorKindOther. Servers check the errors of their protocol first.
+func KindOf(err error) ErrorKind {
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return ErrorKindEOF
+	}
+	if ne, ok := err.(net.Error); ok {
+		if ne.Timeout() {
+			return ErrorKindTimeout
+		}
+		return ErrorKindNet
+	}
+	return ErrorKindOther
+}
+
+// Errors counts errors by kind. The zero value is ready to use.
+type Errors struct {
+	mu     sync.Mutex
+	counts map[ErrorKind]int64
+}
+
+func (e *Errors) Add(kind ErrorKind) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[ErrorKind]int64)
+	}
+	e.counts[kind]++
+}
+
+// Snapshot returns a copy of the counts.
+func (e *Errors) Snapshot() map[ErrorKind]int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	counts := make(map[ErrorKind]int64, len(e.counts))
+	for k, v := range e.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// DefaultLatencyBuckets are the upper bounds of the handler latency
+// histogram used when Server.LatencyBuckets is empty.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// A LatencyHistogram is a snapshot of handler latencies.
+// Counts[i] is the number of observations in (Buckets[i-1], Buckets[i]];
+// the last element of Counts holds observations above every bucket.
+type LatencyHistogram struct {
+	Buckets []time.Duration
+	Counts  []int64
+	Count   int64
+	Sum     time.Duration
+}
+
+// Mean returns the average observed latency, or 0 if nothing was observed.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Histogram records latencies into a LatencyHistogram. Its buckets are the
+// ones of the first observation. The zero value is ready to use.
+type Histogram struct {
+	mu sync.Mutex
+	h  LatencyHistogram
+}
+
+func (h *Histogram) Observe(buckets []time.Duration, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.h.Counts == nil {
+		h.h.Buckets = buckets
+		h.h.Counts = make([]int64, len(buckets)+1)
+	}
+	i := sort.Search(len(h.h.Buckets), func(i int) bool { return d <= h.h.Buckets[i] })
+	h.h.Counts[i]++
+	h.h.Count++
+	h.h.Sum += d
+}
+
+// Snapshot returns a copy of the histogram, empty with buckets if nothing
+// was observed.
+func (h *Histogram) Snapshot(buckets []time.Duration) LatencyHistogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.h.Counts == nil {
+		return LatencyHistogram{Buckets: buckets, Counts: make([]int64, len(buckets)+1)}
+	}
+	s := h.h
+	s.Counts = append([]int64(nil), h.h.Counts...)
+	return s
+}
@@ -0,0 +1,67 @@
+package connstats
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	buckets := []time.Duration{time.Millisecond, 10 * time.Millisecond}
+	var h Histogram
+	if s := h.Snapshot(buckets); s.Count != 0 || len(s.Counts) != 3 || s.Mean() != 0 {
+		t.Fatalf("empty snapshot = %+v", s)
+	}
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 10 * time.Millisecond, time.Second} {
+		h.Observe(buckets, d)
+	}
+	s := h.Snapshot(buckets)
+	want := []int64{1, 2, 1}
+	for i := range want {
+		if s.Counts[i] != want[i] {
+			t.Errorf("Counts = %v, want %v", s.Counts, want)
+			break
+		}
+	}
+	if s.Count != 4 || s.Sum != 1013*time.Millisecond {
+		t.Errorf("Count, Sum = %d, %v; want 4, 1.013s", s.Count, s.Sum)
+	}
+	s.Counts[0] = 100
+	if h.Snapshot(buckets).Counts[0] != 1 {
+		t.Error("Snapshot shares its counts with the histogram")
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{io.EOF, ErrorKindEOF},
+		{io.ErrUnexpectedEOF, ErrorKindEOF},
+		{timeoutError{}, ErrorKindTimeout},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset")}, ErrorKindNet},
+		{errors.New("other"), ErrorKindOther},
+	}
+	for _, tt := range tests {
+		if got := KindOf(tt.err); got != tt.want {
+			t.Errorf("KindOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	var e Errors
+	e.Add(ErrorKindEOF)
+	e.Add(ErrorKindEOF)
+	e.Add(ErrorKindPanic)
+	if got := e.Snapshot(); got[ErrorKindEOF] != 2 || got[ErrorKindPanic] != 1 || len(got) != 2 {
+		t.Errorf("Errors.Snapshot() = %v", got)
+	}
+}
@@ -35,6 +35,9 @@ func httpMethod(req *http.Request) (string, error) {
 	return string(body), nil
 }
 
+// Get returns the body of a GET of url.
+//
+// Deprecated: use Client.Get, which decodes the response.
 func Get(url string) (string, error) {
 	req, err := httpRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -43,6 +46,9 @@ func Get(url string) (string, error) {
 	return httpMethod(req)
 }
 
+// Post returns the body of a POST of the JSON body to url.
+//
+// Deprecated: use Client.Post, which encodes the request and decodes the response.
 func Post(url string, body []byte) (string, error) {
 	req, err := httpRequest(http.MethodPost, url, strings.NewReader(string(body)))
 	if err != nil {
@@ -52,6 +58,9 @@ func Post(url string, body []byte) (string, error) {
 	return httpMethod(req)
 }
 
+// Put returns the body of a PUT of the JSON body to url.
+//
+// Deprecated: use Client.Put, which encodes the request and decodes the response.
 func Put(url string, body []byte) (string, error) {
 	req, err := httpRequest(http.MethodPut, url, strings.NewReader(string(body)))
 	if err != nil {
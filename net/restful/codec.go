@@ -0,0 +1,114 @@
+package restful
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A Codec encodes and decodes bodies of one media type.
+type Codec interface {
+	// ContentType returns the media type of the codec, such as application/json.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec Codec = jsonCodec{}
+	XMLCodec  Codec = xmlCodec{}
+
+	// DefaultCodecs are the codecs of a Handler, by preference.
+	DefaultCodecs = []Codec{JSONCodec, XMLCodec}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string                        { return "application/xml" }
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// codecFor returns the codec of codecs decoding the media type contentType,
+// a codec of application/json also decoding application/*+json.
+func codecFor(contentType string, codecs []Codec) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, codec := range codecs {
+		ct := codec.ContentType()
+		if mediaType == ct {
+			return codec
+		}
+		if i := strings.Index(ct, "/"); i >= 0 && strings.HasPrefix(mediaType, ct[:i+1]) &&
+			strings.HasSuffix(mediaType, "+"+ct[i+1:]) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// negotiate returns the codec of codecs preferred by the Accept header of r,
+// the first one if r has no Accept header, or nil if none is acceptable.
+func negotiate(r *http.Request, codecs []Codec) Codec {
+	if len(codecs) == 0 {
+		return nil
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return codecs[0]
+	}
+	var best Codec
+	bestQ := 0.0
+	for _, codec := range codecs {
+		if q := acceptQuality(accept, codec.ContentType()); q > bestQ {
+			best, bestQ = codec, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the Accept header value accept gives to
+// mediaType, from the most specific media range matching it.
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, elem := range strings.Split(accept, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+		mediaRange, params, err := mime.ParseMediaType(elem)
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case mediaRange == mediaType:
+			s = 2
+		case mediaRange == "*/*":
+			s = 0
+		case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+		rq := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				rq = f
+			}
+		}
+		q, specificity = rq, s
+	}
+	return q
+}
@@ -0,0 +1,418 @@
+package restful
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Validator validates a request decoded by a Handler. An error is sent as
+// a 400 Bad Request Problem, unless it is a Problem or has a StatusCode.
+type Validator interface {
+	Validate() error
+}
+
+// A StatusCoder sets the status of a response, or of an error.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	textType     = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Handler adapts a typed func
+//
+//	func(ctx context.Context, req *Req) (*Resp, error)
+//
+// to an http.Handler. Req is a struct filled from the request: its fields
+// tagged path, query or header take the path parameter of a Router, the
+// query parameter or the header of that name, the body is decoded into the
+// rest by the Codec of its Content-Type. ",required" rejects requests
+// missing the parameter:
+//
+//	type GetUserRequest struct {
+//		ID     int64    `path:"id"`
+//		Fields []string `query:"fields"`
+//		Token  string   `header:"X-Token,required"`
+//	}
+//
+// Parameters are strings, bools, numbers, time.Durations, encoding.TextUnmarshalers,
+// pointers to them or, from queries and headers, slices of them.
+// Then Req is validated if it is a Validator.
+//
+// Resp, if not nil, is encoded by the Codec the request accepts best, with
+// status 200 OK, or its StatusCode if it is a StatusCoder; a nil Resp is
+// sent as 204 No Content.
+//
+// Errors are sent as Problems: a Problem as is, an error with a StatusCode
+// with its message as detail, others as 500 Internal Server Error without
+// detail.
+type Handler struct {
+	// Codecs are the media types of requests and responses, by preference.
+	Codecs []Codec
+	// MaxBodyBytes limits the size of request bodies, if positive.
+	MaxBodyBytes int64
+	// ErrorLog, if non-nil, is called with the errors of 500 responses.
+	ErrorLog func(r *http.Request, err error)
+
+	fn      reflect.Value
+	reqType reflect.Type
+}
+
+// NewHandler returns the Handler of fn, or an error if fn is not a func of
+// the form of a Handler.
+func NewHandler(fn interface{}) (*Handler, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 ||
+		t.In(0) != contextType || t.In(1).Kind() != reflect.Ptr || t.In(1).Elem().Kind() != reflect.Struct ||
+		t.Out(1) != errorType {
+		return nil, fmt.Errorf("restful: %v is not a func(context.Context, *Req) (Resp, error)", t)
+	}
+	if err := checkParams(t.In(1).Elem()); err != nil {
+		return nil, err
+	}
+	return &Handler{Codecs: DefaultCodecs, fn: v, reqType: t.In(1).Elem()}, nil
+}
+
+// MustHandler is like NewHandler but panics if fn is not a func of the form
+// of a Handler.
+func MustHandler(fn interface{}) *Handler {
+	h, err := NewHandler(fn)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+type requestKey struct{}
+type responseHeaderKey struct{}
+
+// Request returns the http.Request of the context of a typed handler.
+func Request(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return r
+}
+
+// ResponseHeader returns the header of the response of the context of a
+// typed handler, to set headers such as Location.
+func ResponseHeader(ctx context.Context) http.Header {
+	h, _ := ctx.Value(responseHeaderKey{}).(http.Header)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	codec := negotiate(r, h.Codecs)
+	if codec == nil {
+		writeProblem(w, NewProblem(http.StatusNotAcceptable, "acceptable media types are "+h.contentTypes()), nil)
+		return
+	}
+
+	req := reflect.New(h.reqType)
+	if err := h.decode(r, req.Interface()); err != nil {
+		h.writeError(w, r, err, codec)
+		return
+	}
+	if err := bindParams(req.Elem(), r); err != nil {
+		h.writeError(w, r, err, codec)
+		return
+	}
+	if v, ok := req.Interface().(Validator); ok {
+		if err := v.Validate(); err != nil {
+			if _, ok := err.(StatusCoder); !ok {
+				err = NewProblem(http.StatusBadRequest, err.Error())
+			}
+			h.writeError(w, r, err, codec)
+			return
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), requestKey{}, r)
+	ctx = context.WithValue(ctx, responseHeaderKey{}, w.Header())
+	out := h.fn.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+	if err, _ := out[1].Interface().(error); err != nil {
+		h.writeError(w, r, err, codec)
+		return
+	}
+
+	resp := out[0]
+	if isNil(resp) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	body, err := codec.Marshal(resp.Interface())
+	if err != nil {
+		h.writeError(w, r, err, codec)
+		return
+	}
+	status := http.StatusOK
+	if sc, ok := resp.Interface().(StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func (h *Handler) contentTypes() string {
+	types := make([]string, 0, len(h.Codecs))
+	for _, codec := range h.Codecs {
+		types = append(types, codec.ContentType())
+	}
+	return strings.Join(types, ", ")
+}
+
+// decode decodes the body of r, if any, into req.
+func (h *Handler) decode(r *http.Request, req interface{}) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	codec := codecFor(r.Header.Get("Content-Type"), h.Codecs)
+	if codec == nil {
+		return NewProblem(http.StatusUnsupportedMediaType, "supported media types are "+h.contentTypes())
+	}
+	body := r.Body
+	if h.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(nil, body, h.MaxBodyBytes)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		if h.MaxBodyBytes > 0 && int64(len(data)) >= h.MaxBodyBytes {
+			return NewProblem(http.StatusRequestEntityTooLarge, "")
+		}
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := codec.Unmarshal(data, req); err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error, codec Codec) {
+	writeProblem(w, h.problem(r, err), codec)
+}
+
+// problem returns the Problem sent for err.
+func (h *Handler) problem(r *http.Request, err error) *Problem {
+	if p, ok := err.(*Problem); ok {
+		return p
+	}
+	if sc, ok := err.(StatusCoder); ok && sc.StatusCode() < http.StatusInternalServerError {
+		return NewProblem(sc.StatusCode(), err.Error())
+	}
+	status := http.StatusInternalServerError
+	if sc, ok := err.(StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+	if h.ErrorLog != nil {
+		h.ErrorLog(r, err)
+	}
+	return NewProblem(status, "")
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+var paramSources = []string{"path", "query", "header"}
+
+// paramTag returns the source, name and required option of the parameter
+// tag of a field.
+func paramTag(field reflect.StructField) (source, name string, required, ok bool) {
+	if field.PkgPath != "" { // unexported
+		return "", "", false, false
+	}
+	for _, source := range paramSources {
+		tag, ok := field.Tag.Lookup(source)
+		if !ok || tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+		return source, name, opts == "required", true
+	}
+	return "", "", false, false
+}
+
+// checkParams returns an error if a parameter field of struct t has a type
+// bindParams can't set.
+func checkParams(t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := checkParams(field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		source, _, _, ok := paramTag(field)
+		if !ok {
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 && source != "path" {
+			ft = ft.Elem()
+		}
+		if !isParamType(ft) {
+			return fmt.Errorf("restful: unsupported type %v of parameter %s.%s", field.Type, t, field.Name)
+		}
+	}
+	return nil
+}
+
+func isParamType(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textType) {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		return isParamType(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// bindParams sets the parameter fields of struct v from r. A parameter
+// absent from r zeroes its field, so that the body can't set it.
+func bindParams(v reflect.Value, r *http.Request) error {
+	var query map[string][]string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindParams(v.Field(i), r); err != nil {
+				return err
+			}
+			continue
+		}
+		source, name, required, ok := paramTag(field)
+		if !ok {
+			continue
+		}
+		var values []string
+		switch source {
+		case "path":
+			if value, ok := PathParams(r.Context())[name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			if query == nil {
+				query = r.URL.Query()
+			}
+			values = query[name]
+		case "header":
+			values = r.Header[http.CanonicalHeaderKey(name)]
+		}
+		if len(values) == 0 {
+			if required {
+				return NewProblem(http.StatusBadRequest, fmt.Sprintf("missing %s parameter %q", source, name))
+			}
+			v.Field(i).Set(reflect.Zero(field.Type))
+			continue
+		}
+		if err := setParam(v.Field(i), values); err != nil {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("invalid %s parameter %q: %v", source, name, err))
+		}
+	}
+	return nil
+}
+
+// setParam sets v from the values of a parameter, all of them if v is a
+// slice, else the first one.
+func setParam(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !reflect.PtrTo(v.Type()).Implements(textType) {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+var errUnsupportedParam = errors.New("unsupported type")
+
+func setValue(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return errUnsupportedParam
+	}
+	return nil
+}
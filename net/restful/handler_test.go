@@ -0,0 +1,217 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type user struct {
+	ID   int64  `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+type createdUser struct {
+	user
+}
+
+func (createdUser) StatusCode() int { return http.StatusCreated }
+
+type getUserRequest struct {
+	ID     int64    `path:"id"`
+	Fields []string `query:"fields"`
+	Token  string   `header:"X-Token,required"`
+}
+
+type createUserRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *createUserRequest) Validate() error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func newTestRouter() *Router {
+	rt := NewRouter()
+	rt.Get("/users/{id}", func(ctx context.Context, req *getUserRequest) (*user, error) {
+		if req.ID == 0 {
+			return nil, &Problem{Type: "https://example.com/no-such-user", Title: "No such user", Status: http.StatusNotFound}
+		}
+		if req.Token != "secret" {
+			return nil, errors.New("database is down")
+		}
+		return &user{ID: req.ID, Name: strings.Join(req.Fields, "+")}, nil
+	})
+	rt.Post("/users", func(ctx context.Context, req *createUserRequest) (*createdUser, error) {
+		ResponseHeader(ctx).Set("Location", "/users/1")
+		return &createdUser{user{ID: 1, Name: req.Name}}, nil
+	})
+	rt.Delete("/users/{id}", func(ctx context.Context, req *struct {
+		ID int64 `path:"id"`
+	}) (*user, error) {
+		return nil, nil
+	})
+	return rt
+}
+
+func TestHandler(t *testing.T) {
+	table := []struct {
+		method, target, body string
+		header               http.Header
+		wantStatus           int
+		wantContentType      string
+		wantBody             string
+	}{
+		{
+			method: http.MethodGet, target: "/users/7?fields=a&fields=b",
+			header:     http.Header{"X-Token": {"secret"}},
+			wantStatus: http.StatusOK, wantContentType: "application/json", wantBody: `{"id":7,"name":"a+b"}`,
+		},
+		{
+			method: http.MethodGet, target: "/users/7",
+			header:     http.Header{"X-Token": {"secret"}, "Accept": {"application/json;q=0.5, application/xml"}},
+			wantStatus: http.StatusOK, wantContentType: "application/xml", wantBody: `<user><id>7</id><name></name></user>`,
+		},
+		{
+			method: http.MethodGet, target: "/users/7",
+			header:     http.Header{"X-Token": {"secret"}, "Accept": {"text/html"}},
+			wantStatus: http.StatusNotAcceptable, wantContentType: ContentTypeProblemJSON,
+		},
+		{
+			method: http.MethodGet, target: "/users/7",
+			wantStatus: http.StatusBadRequest, wantContentType: ContentTypeProblemJSON,
+			wantBody: `{"title":"Bad Request","status":400,"detail":"missing header parameter \"X-Token\""}`,
+		},
+		{
+			method: http.MethodGet, target: "/users/x",
+			header:     http.Header{"X-Token": {"secret"}},
+			wantStatus: http.StatusBadRequest, wantContentType: ContentTypeProblemJSON,
+		},
+		{
+			method: http.MethodGet, target: "/users/0",
+			header:     http.Header{"X-Token": {"secret"}},
+			wantStatus: http.StatusNotFound, wantContentType: ContentTypeProblemJSON,
+			wantBody: `{"type":"https://example.com/no-such-user","title":"No such user","status":404}`,
+		},
+		{
+			method: http.MethodGet, target: "/users/7",
+			header:     http.Header{"X-Token": {"wrong"}},
+			wantStatus: http.StatusInternalServerError, wantContentType: ContentTypeProblemJSON,
+			wantBody: `{"title":"Internal Server Error","status":500}`,
+		},
+		{
+			method: http.MethodPost, target: "/users", body: `{"name":"gopher"}`,
+			header:     http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+			wantStatus: http.StatusCreated, wantContentType: "application/json", wantBody: `{"id":1,"name":"gopher"}`,
+		},
+		{
+			method: http.MethodPost, target: "/users", body: `{}`,
+			header:     http.Header{"Content-Type": {"application/json"}},
+			wantStatus: http.StatusBadRequest, wantContentType: ContentTypeProblemJSON,
+			wantBody: `{"title":"Bad Request","status":400,"detail":"name is required"}`,
+		},
+		{
+			method: http.MethodPost, target: "/users", body: `name=gopher`,
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			wantStatus: http.StatusUnsupportedMediaType, wantContentType: ContentTypeProblemJSON,
+		},
+		{
+			method: http.MethodDelete, target: "/users/7",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			method: http.MethodPut, target: "/users/7",
+			wantStatus: http.StatusMethodNotAllowed, wantContentType: ContentTypeProblemJSON,
+		},
+		{
+			method: http.MethodGet, target: "/groups",
+			wantStatus: http.StatusNotFound, wantContentType: ContentTypeProblemJSON,
+		},
+	}
+
+	rt := newTestRouter()
+	for i, test := range table {
+		r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		for k, vs := range test.header {
+			r.Header[k] = vs
+		}
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		if w.Code != test.wantStatus {
+			t.Errorf("#%d: %s %s: status = %d, want %d: %s", i, test.method, test.target, w.Code, test.wantStatus, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != test.wantContentType {
+			t.Errorf("#%d: Content-Type = %q, want %q", i, got, test.wantContentType)
+		}
+		if test.wantBody != "" && w.Body.String() != test.wantBody {
+			t.Errorf("#%d: body = %s, want %s", i, w.Body, test.wantBody)
+		}
+	}
+}
+
+func TestNewHandlerInvalid(t *testing.T) {
+	for i, fn := range []interface{}{
+		func(r *http.Request) {},
+		func(ctx context.Context, req user) (*user, error) { return nil, nil },
+		func(ctx context.Context, req *struct {
+			C chan int `query:"c"`
+		}) (*user, error) {
+			return nil, nil
+		},
+	} {
+		if _, err := NewHandler(fn); err == nil {
+			t.Errorf("#%d: NewHandler(%T) succeeded", i, fn)
+		}
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	p := &Problem{Title: "Out of credit", Status: http.StatusForbidden, Extensions: map[string]interface{}{"balance": 30.0}}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"balance":30,"status":403,"title":"Out of credit"}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	var got Problem
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != p.Title || got.Status != p.Status || got.Extensions["balance"] != 30.0 {
+		t.Errorf("Unmarshal = %+v, want %+v", got, p)
+	}
+}
+
+func TestHandlerParamsNotFromBody(t *testing.T) {
+	type request struct {
+		Name  string `json:"name"`
+		ID    int64  `json:"id" path:"id"`
+		Token string `json:"token" header:"X-Token"`
+	}
+	var got request
+	rt := NewRouter()
+	rt.Put("/users/{id}", func(ctx context.Context, req *request) (*user, error) {
+		got = *req
+		return nil, nil
+	})
+
+	r := httptest.NewRequest(http.MethodPut, "/users/7", strings.NewReader(`{"name":"gopher","id":8,"token":"forged"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if want := (request{Name: "gopher", ID: 7}); got != want {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package restful
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+	ContentTypeProblemXML  = "application/problem+xml"
+)
+
+// Problem is a problem details object of RFC 7807, the body of error
+// responses. A Problem returned as the error of a handler is sent as is.
+type Problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	// Type is a URI identifying the problem type; "about:blank" if empty.
+	Type string `json:"type,omitempty" xml:"type,omitempty"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title,omitempty" xml:"title,omitempty"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status,omitempty" xml:"status,omitempty"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty" xml:"instance,omitempty"`
+	// Extensions are additional members, sent in JSON only.
+	Extensions map[string]interface{} `json:"-" xml:"-"`
+}
+
+// NewProblem returns a Problem of status, titled by its status text.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	msg := p.Title
+	if msg == "" {
+		msg = http.StatusText(p.Status)
+	}
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// StatusCode returns the status of p, 500 if it is not set.
+func (p *Problem) StatusCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+type problemJSON Problem
+
+// MarshalJSON encodes p with its Extensions as members of the object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*problemJSON)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON decodes p, keeping unknown members in Extensions.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*problemJSON)(p)); err != nil {
+		return err
+	}
+	var members map[string]interface{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, k)
+	}
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return nil
+}
+
+// problemContentType returns the problem media type of the same syntax as
+// the media type contentType, such as application/problem+json for
+// application/json.
+func problemContentType(contentType string) string {
+	switch {
+	case strings.HasSuffix(contentType, "xml"):
+		return ContentTypeProblemXML
+	default:
+		return ContentTypeProblemJSON
+	}
+}
+
+// WriteProblem writes p as the response to r, in XML if r accepts it
+// only, else in JSON.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	writeProblem(w, p, negotiate(r, DefaultCodecs))
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem, codec Codec) {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	body, err := codec.Marshal(p)
+	contentType := problemContentType(codec.ContentType())
+	if err != nil {
+		body, _ = json.Marshal(NewProblem(http.StatusInternalServerError, ""))
+		p, contentType = &Problem{Status: http.StatusInternalServerError}, ContentTypeProblemJSON
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.StatusCode())
+	w.Write(body)
+}
@@ -0,0 +1,227 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPError is the error of a response with a status other than 2xx.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body is the body of the response, up to maxErrorBody bytes.
+	Body []byte
+	// Problem is the decoded body, if it is a problem+json or problem+xml.
+	Problem *Problem
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("restful: %s %s: %s", e.Method, e.URL, e.Status)
+	if e.Problem != nil && e.Problem.Detail != "" {
+		msg += ": " + e.Problem.Detail
+	}
+	return msg
+}
+
+// maxErrorBody is the size of the bodies kept by HTTPError.
+const maxErrorBody = 64 << 10
+
+// A CallOption sets an option of a call of a Client.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	header  http.Header
+	query   url.Values
+	timeout time.Duration
+}
+
+// WithHeader adds the header key: value to the request.
+func WithHeader(key, value string) CallOption {
+	return func(o *callOptions) { o.header.Add(key, value) }
+}
+
+// WithQuery adds the query parameters to the URL of the request.
+func WithQuery(query url.Values) CallOption {
+	return func(o *callOptions) {
+		for k, vs := range query {
+			o.query[k] = append(o.query[k], vs...)
+		}
+	}
+}
+
+// WithTimeout limits the time of the call, reading the response included.
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = timeout }
+}
+
+// Client calls a REST API, encoding requests and decoding responses with
+// Codec. Responses with a status other than 2xx are returned as *HTTPError.
+type Client struct {
+	// BaseURL is prepended to the paths of the calls.
+	BaseURL string
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// Codec encodes requests and decodes responses. If nil, JSONCodec is used.
+	Codec Codec
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// Get decodes the response of a GET of path into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}, opts ...CallOption) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out, opts...)
+}
+
+// Post sends in to path and decodes the response into out.
+func (c *Client) Post(ctx context.Context, path string, in, out interface{}, opts ...CallOption) error {
+	return c.Do(ctx, http.MethodPost, path, in, out, opts...)
+}
+
+// Put sends in to path and decodes the response into out.
+func (c *Client) Put(ctx context.Context, path string, in, out interface{}, opts ...CallOption) error {
+	return c.Do(ctx, http.MethodPut, path, in, out, opts...)
+}
+
+// Patch sends in to path and decodes the response into out.
+func (c *Client) Patch(ctx context.Context, path string, in, out interface{}, opts ...CallOption) error {
+	return c.Do(ctx, http.MethodPatch, path, in, out, opts...)
+}
+
+// Delete deletes path and decodes the response, if any, into out.
+func (c *Client) Delete(ctx context.Context, path string, out interface{}, opts ...CallOption) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, out, opts...)
+}
+
+func (c *Client) codec() Codec {
+	if c.Codec == nil {
+		return JSONCodec
+	}
+	return c.Codec
+}
+
+// Do sends a request of method to path with the body in, if not nil, and
+// decodes the body of the response into out, if not nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}, opts ...CallOption) error {
+	o := callOptions{header: make(http.Header), query: make(url.Values)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if c.BaseURL == "" {
+		u = path
+	}
+	if len(o.query) > 0 {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + o.query.Encode()
+	}
+
+	codec := c.codec()
+	var body io.Reader
+	if in != nil {
+		data, err := codec.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	for k, vs := range o.header {
+		req.Header[k] = vs
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", codec.ContentType())
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", codec.ContentType()+", "+problemContentType(codec.ContentType()))
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return newHTTPError(req, resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	respCodec := codecFor(resp.Header.Get("Content-Type"), append([]Codec{codec}, DefaultCodecs...))
+	if respCodec == nil {
+		respCodec = codec
+	}
+	if err := respCodec.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("restful: %s %s: decoding response: %v", method, u, err)
+	}
+	return nil
+}
+
+func newHTTPError(req *http.Request, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &HTTPError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+	contentType := resp.Header.Get("Content-Type")
+	var codec Codec
+	switch {
+	case strings.HasPrefix(contentType, ContentTypeProblemJSON):
+		codec = JSONCodec
+	case strings.HasPrefix(contentType, ContentTypeProblemXML):
+		codec = XMLCodec
+	}
+	if codec != nil {
+		var p Problem
+		if err := codec.Unmarshal(body, &p); err == nil {
+			e.Problem = &p
+		}
+	}
+	return e
+}
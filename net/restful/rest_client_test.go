@@ -0,0 +1,62 @@
+package restful
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	rt := newTestRouter()
+	rt.Get("/slow", func(ctx context.Context, req *struct{}) (*user, error) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+		return &user{}, nil
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.Header = http.Header{"X-Token": {"secret"}}
+	ctx := context.Background()
+
+	var u user
+	if err := c.Get(ctx, "/users/7", &u, WithQuery(map[string][]string{"fields": {"a"}})); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{ID: 7, Name: "a"}) {
+		t.Errorf("Get = %+v", u)
+	}
+
+	if err := c.Post(ctx, "/users", createUserRequest{Name: "gopher"}, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{ID: 1, Name: "gopher"}) {
+		t.Errorf("Post = %+v", u)
+	}
+
+	if err := c.Delete(ctx, "/users/7", &u); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.Get(ctx, "/users/0", &u, WithHeader("X-Token", "other"))
+	e, ok := err.(*HTTPError)
+	if !ok {
+		t.Fatalf("Get error = %v, want *HTTPError", err)
+	}
+	if e.StatusCode != http.StatusNotFound || e.Problem == nil || e.Problem.Type != "https://example.com/no-such-user" {
+		t.Errorf("Get error = %+v, problem %+v", e, e.Problem)
+	}
+
+	start := time.Now()
+	if err := c.Get(ctx, "/slow", &u, WithTimeout(50*time.Millisecond)); err == nil {
+		t.Error("Get with timeout succeeded")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Get with timeout took %v", time.Since(start))
+	}
+}
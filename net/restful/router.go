@@ -0,0 +1,161 @@
+package restful
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type pathParamsKey struct{}
+
+// PathParams returns the path parameters of the route matched by a Router,
+// by name.
+func PathParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(pathParamsKey{}).(map[string]string)
+	return params
+}
+
+// PathParam returns the path parameter name of the route matching r.
+func PathParam(r *http.Request, name string) string {
+	return PathParams(r.Context())[name]
+}
+
+// Router dispatches requests by method and path pattern. A pattern is a
+// path whose segments may be parameters, such as
+//
+//	/users/{id}/files/{path...}
+//
+// where {id} matches one segment and {path...}, last, the rest of the path.
+// The first route registered matching a request wins. A GET route also
+// serves HEAD requests.
+//
+// Requests matching no route are answered 404 Not Found, or 405 Method Not
+// Allowed if the path matches routes of other methods, as Problems.
+type Router struct {
+	// NotFound, if non-nil, serves the requests matching no route.
+	NotFound http.Handler
+
+	routes []route
+}
+
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers h for the requests of method matching pattern.
+func (rt *Router) Handle(method, pattern string, h http.Handler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("restful: pattern must begin with '/': " + pattern)
+	}
+	segments := strings.Split(pattern[1:], "/")
+	for i, seg := range segments {
+		if strings.HasSuffix(seg, "...}") && i != len(segments)-1 {
+			panic("restful: {name...} must be the last segment of pattern: " + pattern)
+		}
+	}
+	rt.routes = append(rt.routes, route{method: method, segments: segments, handler: h})
+}
+
+// Get registers the typed handler fn, see NewHandler, for GET requests of pattern.
+func (rt *Router) Get(pattern string, fn interface{}) {
+	rt.Handle(http.MethodGet, pattern, MustHandler(fn))
+}
+
+// Post registers the typed handler fn, see NewHandler, for POST requests of pattern.
+func (rt *Router) Post(pattern string, fn interface{}) {
+	rt.Handle(http.MethodPost, pattern, MustHandler(fn))
+}
+
+// Put registers the typed handler fn, see NewHandler, for PUT requests of pattern.
+func (rt *Router) Put(pattern string, fn interface{}) {
+	rt.Handle(http.MethodPut, pattern, MustHandler(fn))
+}
+
+// Patch registers the typed handler fn, see NewHandler, for PATCH requests of pattern.
+func (rt *Router) Patch(pattern string, fn interface{}) {
+	rt.Handle(http.MethodPatch, pattern, MustHandler(fn))
+}
+
+// Delete registers the typed handler fn, see NewHandler, for DELETE requests of pattern.
+func (rt *Router) Delete(pattern string, fn interface{}) {
+	rt.Handle(http.MethodDelete, pattern, MustHandler(fn))
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	segments := strings.Split(path[1:], "/")
+
+	var allow []string
+	for _, rte := range rt.routes {
+		params, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+		if rte.method != r.Method && !(rte.method == http.MethodGet && r.Method == http.MethodHead) {
+			allow = append(allow, rte.method)
+			continue
+		}
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+		}
+		rte.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if len(allow) > 0 {
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		WriteProblem(w, r, NewProblem(http.StatusMethodNotAllowed, ""))
+		return
+	}
+	if rt.NotFound != nil {
+		rt.NotFound.ServeHTTP(w, r)
+		return
+	}
+	WriteProblem(w, r, NewProblem(http.StatusNotFound, ""))
+}
+
+// match returns the path parameters of the route if it matches the segments
+// of a path.
+func (rte *route) match(segments []string) (map[string]string, bool) {
+	var params map[string]string
+	setParam := func(name, value string) {
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
+	}
+	for i, seg := range rte.segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}") {
+			if i > len(segments) {
+				return nil, false
+			}
+			setParam(seg[1:len(seg)-len("...}")], strings.Join(segments[i:], "/"))
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			setParam(seg[1:len(seg)-1], segments[i])
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(rte.segments)
+}
@@ -8,6 +8,9 @@ import (
 	"strings"
 )
 
+// HttpGetHandler writes v as an indented JSON response.
+//
+// Deprecated: use Handler, which negotiates the media type and reports errors as Problems.
 func HttpGetHandler(v interface{}, w http.ResponseWriter, r *http.Request) {
 	body, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
@@ -22,6 +25,10 @@ func HttpGetHandler(v interface{}, w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// HttpPostHandler decodes the JSON body of a POST request into v, or
+// answers r and returns true.
+//
+// Deprecated: use Handler, which decodes requests into typed values.
 func HttpPostHandler(v interface{}, w http.ResponseWriter, r *http.Request) (finished bool) {
 	if r.Method == http.MethodPost {
 		r.ParseForm()
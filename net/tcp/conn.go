@@ -51,6 +51,25 @@ type conn struct {
 	w *checkConnErrorWriter
 
 	curState struct{ atomic uint64 } // packed (unixtime<<8|uint8(ConnState))
+
+	// id identifies the connection in Server.Conns and Server.CloseConn.
+	// Immutable; unique per Server.
+	id        uint64
+	createdAt time.Time
+
+	// ctx is the connection-level context, see Context.
+	ctx   context.Context
+	stats connStats
+}
+
+// Context returns the connection-level context, which carries
+// ServerContextKey, LocalAddrContextKey and ConnIDContextKey, and is
+// canceled when the connection is closed.
+func (c *conn) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
 }
 
 func (c *conn) finalFlush() {
@@ -184,9 +203,11 @@ func (c *conn) readRequest(ctx context.Context) (req interface{}, err error) {
 func (c *conn) serve(ctx context.Context) {
 	c.remoteAddr = c.rwc.RemoteAddr().String()
 	ctx = context.WithValue(ctx, LocalAddrContextKey, c.rwc.LocalAddr())
+	ctx = context.WithValue(ctx, ConnIDContextKey, c.id)
 	// handle close
 	defer func() {
 		if err := recover(); err != nil && err != ErrAbortHandler {
+			c.server.stats.errors.Add(ErrorKindPanic)
 			const size = 64 << 10
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
@@ -200,6 +221,7 @@ func (c *conn) serve(ctx context.Context) {
 	// cancel after this connection is handled
 	ctx, cancelCtx := context.WithCancel(ctx)
 	c.cancelCtx = cancelCtx
+	c.ctx = ctx
 	defer cancelCtx()
 
 	// wrap original conn itself with buffer
@@ -212,6 +234,7 @@ func (c *conn) serve(ctx context.Context) {
 		if c.r.remain != c.server.initialReadLimitSize() {
 			// If we read any bytes off the wire, we're active.
 			c.setState(c.rwc, StateActive)
+			c.stats.idle.Store(false)
 		}
 		if err = c.server.CheckError(c.w, c.r, err); err != nil {
 			if isCommonNetReadError(err) {
@@ -221,9 +244,16 @@ func (c *conn) serve(ctx context.Context) {
 			c.closeWriteAndWait()
 			return nil, err
 		}
+		if msg != nil {
+			c.addMsgIn()
+		}
 		return msg, nil
 	}), dispatch.HandlerFunc(func(ctx context.Context, msg interface{}) error {
-		return c.server.CheckError(c.w, c.r, c.server.onMsgHandleHandler.OnMsgHandle(c.w, msg))
+		t0 := time.Now()
+		err := c.server.onMsgHandleHandler.OnMsgHandle(c.w, msg)
+		c.server.stats.handleLatency.Observe(c.server.latencyBuckets(), time.Since(t0))
+		c.stats.idle.Store(true)
+		return c.server.CheckError(c.w, c.r, err)
 	})).WithContext(ctx).Start()
 	// after onMsgHandle, read all left data
 	c.r.startBackgroundRead()
@@ -238,9 +268,15 @@ type checkConnErrorWriter struct {
 
 func (w checkConnErrorWriter) Write(p []byte) (n int, err error) {
 	n, err = w.c.rwc.Write(p)
+	if n > 0 {
+		w.c.addBytesOut(n)
+	}
 	if err != nil && w.c.werr == nil {
 		w.c.werr = err
 		w.c.cancelCtx()
 	}
 	return
 }
+
+// Context returns the connection-level context, see conn.Context.
+func (w checkConnErrorWriter) Context() context.Context { return w.c.Context() }
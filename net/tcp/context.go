@@ -1,5 +1,7 @@
 package tcp
 
+import "context"
+
 var (
 	// ServerContextKey is a context key. It can be used in TCP
 	// handlers with context.WithValue to access the server that
@@ -17,6 +19,12 @@ var (
 	// address the connection arrived on.
 	// The associated value will be of type net.Addr.
 	LocalAddrContextKey = &contextKey{"local-addr"}
+
+	// ConnIDContextKey is a context key. It can be used in
+	// TCP handlers with context.WithValue to access the ID of
+	// the connection, as listed by Server.Conns.
+	// The associated value will be of type uint64.
+	ConnIDContextKey = &contextKey{"conn-id"}
 )
 
 type contextKey struct {
@@ -24,3 +32,13 @@ type contextKey struct {
 }
 
 func (k *contextKey) String() string { return "net/http context value " + k.name }
+
+// ConnContext returns the connection-level context of the reader or writer
+// handed to a handler, or context.Background() if v carries none.
+// The context is canceled when the connection is closed.
+func ConnContext(v interface{}) context.Context {
+	if c, ok := v.(interface{ Context() context.Context }); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
@@ -1,6 +1,7 @@
 package tcp
 
 import (
+	"context"
 	"io"
 	"net"
 	"sync"
@@ -50,6 +51,7 @@ func (cr *connReader) startBackgroundRead() {
 // conn -> byteBuf -> p
 func (cr *connReader) backgroundRead() {
 	n, err := cr.conn.rwc.Read(cr.byteBuf[:])
+	cr.conn.addBytesIn(n)
 	cr.lock()
 	if n == 1 {
 		cr.hasByte = true
@@ -120,6 +122,9 @@ func (cr *connReader) handleReadError(_ error) {
 	cr.conn.cancelCtx()
 }
 
+// Context returns the connection-level context, see conn.Context.
+func (cr *connReader) Context() context.Context { return cr.conn.Context() }
+
 func (cr *connReader) Read(p []byte) (n int, err error) {
 	cr.lock()
 	if cr.inRead {
@@ -146,6 +151,7 @@ func (cr *connReader) Read(p []byte) (n int, err error) {
 	cr.inRead = true
 	cr.unlock()
 	n, err = cr.conn.rwc.Read(p)
+	cr.conn.addBytesIn(n)
 
 	cr.lock()
 	cr.inRead = false
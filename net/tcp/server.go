@@ -66,12 +66,20 @@ type Server struct {
 	// called when a client connection changes state. See the
 	// ConnState type and associated constants for details.
 	ConnState func(net.Conn, ConnState)
+
+	// LatencyBuckets specifies the upper bounds of the handler latency
+	// histogram reported by Stats. If empty, DefaultLatencyBuckets is used.
+	LatencyBuckets []time.Duration
+
+	nextConnID atomic.Uint64
+	stats      serverStats
 }
 
 func (srv *Server) CheckError(w io.Writer, r io.Reader, err error) error {
 	if err == nil {
 		return nil
 	}
+	srv.stats.errors.Add(errorKindOf(err))
 	return srv.onErrorHandler.OnError(w, r, err)
 }
 
@@ -138,6 +146,7 @@ func (s *Server) trackConn(c *conn, add bool) {
 	}
 	if add {
 		s.activeConn[c] = struct{}{}
+		s.stats.total.Inc()
 	} else {
 		delete(s.activeConn, c)
 	}
@@ -146,8 +155,10 @@ func (s *Server) trackConn(c *conn, add bool) {
 // Create new connection from rwc.
 func (srv *Server) newConn(rwc net.Conn) *conn {
 	c := &conn{
-		server: srv,
-		rwc:    rwc,
+		server:    srv,
+		rwc:       rwc,
+		id:        srv.nextConnID.Inc(),
+		createdAt: time.Now(),
 	}
 	return c
 }
@@ -0,0 +1,198 @@
+package tcp
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/searKing/golib/net/internal/connstats"
+	"go.uber.org/atomic"
+)
+
+// ErrConnNotFound is returned by Server.CloseConn when no tracked
+// connection has the given ID.
+var ErrConnNotFound = errors.New("tcp: connection not found")
+
+// An ErrorKind classifies an error seen by the Server, for Stats.
+type ErrorKind = connstats.ErrorKind
+
+// Kinds of errors, see connstats for their meaning.
+const (
+	ErrorKindOther    = connstats.ErrorKindOther
+	ErrorKindEOF      = connstats.ErrorKindEOF
+	ErrorKindTimeout  = connstats.ErrorKindTimeout
+	ErrorKindTooLarge = connstats.ErrorKindTooLarge
+	ErrorKindNet      = connstats.ErrorKindNet
+	ErrorKindPanic    = connstats.ErrorKindPanic
+)
+
+func errorKindOf(err error) ErrorKind {
+	if err == errTooLarge {
+		return ErrorKindTooLarge
+	}
+	return connstats.KindOf(err)
+}
+
+// DefaultLatencyBuckets are the upper bounds of the handler latency
+// histogram used when Server.LatencyBuckets is empty.
+var DefaultLatencyBuckets = connstats.DefaultLatencyBuckets
+
+// A LatencyHistogram is a snapshot of handler latencies.
+// Counts[i] is the number of observations in (Buckets[i-1], Buckets[i]];
+// the last element of Counts holds observations above every bucket.
+type LatencyHistogram = connstats.LatencyHistogram
+
+// Stats is a point-in-time snapshot of a Server's connections and traffic.
+type Stats struct {
+	Open   int64 // connections currently tracked
+	Active int64 // open connections reading or handling a message
+	Idle   int64 // open connections waiting for the next message
+	Total  int64 // connections accepted since the Server started
+
+	BytesIn  int64
+	BytesOut int64
+	MsgsIn   int64 // messages returned by OnMsgRead
+	MsgsOut  int64 // writes issued through the connection's writer
+
+	HandleLatency LatencyHistogram // time spent in OnMsgHandle
+	Errors        map[ErrorKind]int64
+}
+
+// ConnInfo describes a live connection, as listed by Server.Conns.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr string
+	LocalAddr  string
+	State      ConnState
+	StateSince time.Time
+	CreatedAt  time.Time
+	Age        time.Duration
+
+	BytesIn  int64
+	BytesOut int64
+	MsgsIn   int64
+	MsgsOut  int64
+}
+
+// connStats counts the traffic of one connection.
+type connStats struct {
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	msgsIn   atomic.Int64
+	msgsOut  atomic.Int64
+
+	// idle reports whether the connection waits for its next message, for
+	// Stats only: its ConnState stays StateActive, so Shutdown does not
+	// close it between two messages.
+	idle atomic.Bool
+}
+
+// serverStats aggregates counters over every connection of a Server.
+type serverStats struct {
+	connStats
+	total         atomic.Int64
+	handleLatency connstats.Histogram
+	errors        connstats.Errors
+}
+
+func (c *conn) addBytesIn(n int) {
+	c.stats.bytesIn.Add(int64(n))
+	c.server.stats.bytesIn.Add(int64(n))
+}
+
+func (c *conn) addBytesOut(n int) {
+	c.stats.bytesOut.Add(int64(n))
+	c.server.stats.bytesOut.Add(int64(n))
+	c.stats.msgsOut.Inc()
+	c.server.stats.msgsOut.Inc()
+}
+
+func (c *conn) addMsgIn() {
+	c.stats.msgsIn.Inc()
+	c.server.stats.msgsIn.Inc()
+}
+
+func (c *conn) info(now time.Time) ConnInfo {
+	st, unixSec := c.getState()
+	return ConnInfo{
+		ID:         c.id,
+		RemoteAddr: c.rwc.RemoteAddr().String(),
+		LocalAddr:  c.rwc.LocalAddr().String(),
+		State:      st,
+		StateSince: time.Unix(unixSec, 0),
+		CreatedAt:  c.createdAt,
+		Age:        now.Sub(c.createdAt),
+		BytesIn:    c.stats.bytesIn.Load(),
+		BytesOut:   c.stats.bytesOut.Load(),
+		MsgsIn:     c.stats.msgsIn.Load(),
+		MsgsOut:    c.stats.msgsOut.Load(),
+	}
+}
+
+func (srv *Server) latencyBuckets() []time.Duration {
+	if len(srv.LatencyBuckets) > 0 {
+		return srv.LatencyBuckets
+	}
+	return DefaultLatencyBuckets
+}
+
+// Stats returns a snapshot of the Server's connection counts, traffic,
+// handler latencies and errors.
+func (srv *Server) Stats() Stats {
+	s := Stats{
+		Total:         srv.stats.total.Load(),
+		BytesIn:       srv.stats.bytesIn.Load(),
+		BytesOut:      srv.stats.bytesOut.Load(),
+		MsgsIn:        srv.stats.msgsIn.Load(),
+		MsgsOut:       srv.stats.msgsOut.Load(),
+		HandleLatency: srv.stats.handleLatency.Snapshot(srv.latencyBuckets()),
+		Errors:        srv.stats.errors.Snapshot(),
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.activeConn {
+		s.Open++
+		switch st, _ := c.getState(); st {
+		case StateActive:
+			if c.stats.idle.Load() {
+				s.Idle++
+			} else {
+				s.Active++
+			}
+		case StateNew, StateIdle:
+			s.Idle++
+		}
+	}
+	return s
+}
+
+// Conns lists the Server's live connections, oldest first.
+func (srv *Server) Conns() []ConnInfo {
+	now := time.Now()
+	srv.mu.Lock()
+	infos := make([]ConnInfo, 0, len(srv.activeConn))
+	for c := range srv.activeConn {
+		infos = append(infos, c.info(now))
+	}
+	srv.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CloseConn closes the live connection with the given ID, as reported by
+// Conns. The connection's OnCloseHandler runs once its serve loop exits.
+func (srv *Server) CloseConn(id uint64) error {
+	srv.mu.Lock()
+	var target *conn
+	for c := range srv.activeConn {
+		if c.id == id {
+			target = c
+			break
+		}
+	}
+	srv.mu.Unlock()
+	if target == nil {
+		return ErrConnNotFound
+	}
+	return target.rwc.Close()
+}
@@ -0,0 +1,87 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerStats(t *testing.T) {
+	srv := NewServerFunc(nil,
+		OnMsgReadHandlerFunc(func(r io.Reader) (msg interface{}, err error) {
+			return bufio.NewReader(r).ReadString('\n')
+		}),
+		OnMsgHandleHandlerFunc(func(w io.Writer, msg interface{}) error {
+			_, err := io.WriteString(w, msg.(string))
+			return err
+		}), nil, nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer ln.Close()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := io.WriteString(c, "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello\n" {
+		t.Fatalf("echo = %q, want %q", line, "hello\n")
+	}
+
+	conns := srv.Conns()
+	if len(conns) != 1 {
+		t.Fatalf("len(Conns()) = %d, want 1", len(conns))
+	}
+	if got, want := conns[0].RemoteAddr, c.LocalAddr().String(); got != want {
+		t.Errorf("RemoteAddr = %q, want %q", got, want)
+	}
+
+	// the connection waits for its next message, idle for Stats only
+	deadline := time.Now().Add(5 * time.Second)
+	for s := srv.Stats(); s.Idle != 1 || s.Active != 0; s = srv.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Active, Idle = %d, %d; want 0, 1", s.Active, s.Idle)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := srv.Conns()[0].State; st != StateActive {
+		t.Errorf("State = %v, want %v", st, StateActive)
+	}
+
+	s := srv.Stats()
+	if s.Open != 1 || s.Total != 1 {
+		t.Errorf("Open, Total = %d, %d; want 1, 1", s.Open, s.Total)
+	}
+	if s.BytesIn != 6 || s.BytesOut != 6 {
+		t.Errorf("BytesIn, BytesOut = %d, %d; want 6, 6", s.BytesIn, s.BytesOut)
+	}
+	if s.MsgsIn != 1 || s.HandleLatency.Count != 1 {
+		t.Errorf("MsgsIn, HandleLatency.Count = %d, %d; want 1, 1", s.MsgsIn, s.HandleLatency.Count)
+	}
+
+	if err := srv.CloseConn(conns[0].ID); err != nil {
+		t.Fatalf("CloseConn: %v", err)
+	}
+	if err := srv.CloseConn(conns[0].ID + 1); err != ErrConnNotFound {
+		t.Errorf("CloseConn(unknown) = %v, want %v", err, ErrConnNotFound)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for len(srv.Conns()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection still tracked after CloseConn")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,7 +2,6 @@ package websocket_
 
 import (
 	"context"
-	"github.com/gorilla/websocket"
 	"github.com/searKing/golib/util/object"
 	"net/http"
 	"time"
@@ -41,36 +40,57 @@ func (cli *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	return ErrUnImplement
 }
 
-// OnHandshake takes over the http handler
+// DialAndServe dials urlStr and serves the connection until it is closed.
+// PingInterval, PongTimeout and IdleTimeout of the embedded Server keep
+// the connection alive as they do on the server side.
 func (cli *Client) DialAndServe(urlStr string, requestHeader http.Header) error {
+	c, err := cli.dial(context.Background(), urlStr, requestHeader, cli.sendQueueSize())
+	if err != nil {
+		return err
+	}
+	defer c.rwc.Close()
+	ctx := context.WithValue(context.Background(), ClientContextKey, cli)
+	c.serve(ctx)
+	return nil
+}
+
+// dial connects to urlStr and runs the HTTP response and open handlers,
+// leaving the connection in StateNew, ready to serve, with a send queue of
+// queueSize messages.
+func (cli *Client) dial(ctx context.Context, urlStr string, requestHeader http.Header, queueSize int) (*conn, error) {
 	if cli.shuttingDown() {
-		return ErrClientClosed
+		return nil, ErrClientClosed
 	}
 	// transfer http to websocket
-	dialer := *websocket.DefaultDialer
+	dialer := cli.Server.newDialer()
 	dialer.HandshakeTimeout = time.Second
-	ws, resp, err := dialer.Dial(urlStr, requestHeader)
+	ws, resp, err := dialer.DialContext(ctx, urlStr, requestHeader)
+	if err != nil {
+		cli.Server.CheckError(nil, err)
+		return nil, err
+	}
+	err = cli.Server.configureConn(ws)
 	if cli.Server.CheckError(nil, err) != nil {
-		return err
+		ws.Close()
+		return nil, err
 	}
 	// Handle HTTP Response
 	err = cli.httpRespHandler.OnHTTPResponse(resp)
 	if cli.Server.CheckError(nil, err) != nil {
-		return err
+		ws.Close()
+		return nil, err
 	}
 
-	defer ws.Close()
-	ctx := context.WithValue(context.Background(), ClientContextKey, cli)
-
 	// takeover the connect
-	c := cli.Server.newConn(ws)
+	c := cli.Server.newConn(ws, queueSize)
+	// tracked before OnOpen, so that it may Join rooms
+	c.setState(c.rwc, StateNew)
 	// Handle websocket On
 	err = cli.Server.onOpenHandler.OnOpen(c.rwc)
 	if err = cli.Server.CheckError(c.rwc, err); err != nil {
 		c.close()
-		return err
+		c.setState(c.rwc, StateClosed)
+		return nil, err
 	}
-	c.setState(c.rwc, StateNew) // before Serve can return
-	c.serve(ctx)
-	return nil
+	return c, nil
 }
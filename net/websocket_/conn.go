@@ -2,18 +2,17 @@ package websocket_
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/gorilla/websocket"
 	"github.com/searKing/golib/x/dispatch"
+	atomic_ "go.uber.org/atomic"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// maxInt64 is the effective "infinite" value for the Server and
-// Transport's byte-limiting readers.
-const maxInt64 = 1<<63 - 1
-
 // A conn represents the server side of an HTTP connection.
 type conn struct {
 	// server is the server on which the connection arrived.
@@ -35,22 +34,89 @@ type conn struct {
 	// This is the value of a onMsgHandleHandler's (*Request).RemoteAddr.
 	remoteAddr string
 
-	// werr is set to the first write error to rwc.
-	// It is set via checkConnErrorWriter{w}, where bufw writes.
-	werr error
+	// werr is set to the first read or write error to rwc, via
+	// checkConnErrorWebSocket{c}. Handlers, writeLoop and keepAlive write
+	// concurrently, so it is guarded by werrMu; see setErr.
+	werrMu sync.Mutex
+	werr   error
 
 	curState struct{ atomic uint64 } // packed (unixtime<<8|uint8(ConnState))
+
+	// id identifies the connection in Server.Conns and Server.CloseConn.
+	// Immutable; unique per Server.
+	id        uint64
+	createdAt time.Time
+
+	// ctx is the connection-level context, see Context.
+	ctx   context.Context
+	stats connStats
+
+	// send queues messages for writeLoop; see Server.Broadcast.
+	send chan queuedMessage
+	// writeDone is closed once writeLoop returns, leaving in unsent the
+	// message it failed to write, if any.
+	writeDone chan struct{}
+	unsent    *queuedMessage
+	// rooms the connection joined; guarded by server.mu.
+	rooms map[string]struct{}
+
+	// lastSeen is the UnixNano time of the last message or pong read,
+	// lastActive of the last message read or written; see keepAlive.
+	lastSeen   atomic_.Int64
+	lastActive atomic_.Int64
+	// closeReason is set when keepAlive closes the connection.
+	closeReason atomic_.Error
+}
+
+// Context returns the connection-level context, which carries
+// ServerContextKey, LocalAddrContextKey and ConnIDContextKey, and is
+// canceled when the connection is closed.
+func (c *conn) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// setErr records err if it is the first error of rwc, and then cancels
+// the connection-level context.
+func (c *conn) setErr(err error) {
+	c.werrMu.Lock()
+	first := c.werr == nil
+	if first {
+		c.werr = err
+	}
+	c.werrMu.Unlock()
+	if first && c.cancelCtx != nil {
+		c.cancelCtx()
+	}
+}
+
+// err returns the first error of rwc, if any.
+func (c *conn) err() error {
+	c.werrMu.Lock()
+	defer c.werrMu.Unlock()
+	return c.werr
 }
 
 // Close the connection.
 func (c *conn) close() error {
 	err := c.server.onCloseHandler.OnClose(checkConnErrorWebSocket{c: c})
 	c.rwc.Close()
+	c.server.mu.Lock()
+	c.server.leaveAllLocked(c)
+	c.server.mu.Unlock()
 	return err
 }
 
 func (c *conn) setState(nc *WebSocketConn, state ConnState) {
 	srv := c.server
+	switch state {
+	case StateNew:
+		srv.trackConn(c, true)
+	case StateHijacked, StateClosed:
+		srv.trackConn(c, false)
+	}
 	if state > 0xff || state < 0 {
 		panic("internal error")
 	}
@@ -71,7 +137,10 @@ func (c *conn) getState() (state ConnState, unixSec int64) {
 // panicking with ErrAbortHandler also suppresses logging of a stack
 // trace to the server's error log.
 var ErrAbortHandler = errors.New("net/websocket: abort onMsgHandleHandler")
-var errTooLarge = errors.New("websocket: read too large")
+
+// ErrMessageTooLarge is the close reason of a connection that read a message
+// larger than Server.MaxBytes.
+var ErrMessageTooLarge = errors.New("websocket: read too large")
 
 // isCommonNetReadError reports whether err is a common error
 // encountered during reading a request off the network when the
@@ -104,18 +173,17 @@ func (c *conn) readRequest(ctx context.Context) (req interface{}, err error) {
 			c.rwc.SetWriteDeadline(time.Now().Add(d))
 		}()
 	}
-	c.rwc.SetReadLimit(c.server.initialReadLimitSize())
+	// the MaxBytes read limit is set once per connection, see newConn
 	req, err = c.server.onMsgReadHandler.OnMsgRead(checkConnErrorWebSocket{c: c})
 	if err != nil {
 		if err == websocket.ErrReadLimit {
-			return nil, errTooLarge
+			// the websocket package has already sent close code 1009
+			c.closeReason.Store(ErrMessageTooLarge)
+			return nil, ErrMessageTooLarge
 		}
 		return nil, err
 	}
 
-	//c.rwc.setInfiniteReadLimit()
-	c.rwc.SetReadLimit(maxInt64)
-
 	// Adjust the read deadline if necessary.
 	if !hdrDeadline.Equal(wholeReqDeadline) {
 		c.rwc.SetReadDeadline(wholeReqDeadline)
@@ -128,9 +196,11 @@ func (c *conn) readRequest(ctx context.Context) (req interface{}, err error) {
 func (c *conn) serve(ctx context.Context) {
 	c.remoteAddr = c.rwc.RemoteAddr().String()
 	ctx = context.WithValue(ctx, LocalAddrContextKey, c.rwc.LocalAddr())
+	ctx = context.WithValue(ctx, ConnIDContextKey, c.id)
 	// handle close
 	defer func() {
 		if err := recover(); err != nil && err != ErrAbortHandler {
+			c.server.stats.errors.Add(ErrorKindPanic)
 			const size = 64 << 10
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
@@ -144,8 +214,17 @@ func (c *conn) serve(ctx context.Context) {
 	// cancel after this connection is handled
 	ctx, cancelCtx := context.WithCancel(ctx)
 	c.cancelCtx = cancelCtx
+	c.ctx = ctx
 	defer cancelCtx()
 
+	go c.writeLoop(ctx)
+
+	c.rwc.SetPongHandler(func(string) error {
+		c.touch()
+		return nil
+	})
+	go c.keepAlive(ctx)
+
 	// read and handle the msg
 	dispatch.NewDispatch(dispatch.ReaderFunc(func(ctx context.Context) (interface{}, error) {
 		msg, err := c.readRequest(ctx)
@@ -158,7 +237,11 @@ func (c *conn) serve(ctx context.Context) {
 		c.setState(c.rwc, StateActive)
 		return msg, nil
 	}), dispatch.HandlerFunc(func(ctx context.Context, msg interface{}) error {
-		return c.server.CheckError(c.rwc, c.server.onMsgHandleHandler.OnMsgHandle(checkConnErrorWebSocket{c: c}, msg))
+		t0 := time.Now()
+		err := c.server.onMsgHandleHandler.OnMsgHandle(checkConnErrorWebSocket{c: c}, msg)
+		c.server.stats.handleLatency.Observe(c.server.latencyBuckets(), time.Since(t0))
+		c.setState(c.rwc, StateIdle)
+		return c.server.CheckError(c.rwc, err)
 	})).WithContext(ctx).Start()
 	return
 }
@@ -183,7 +266,7 @@ type WebSocketReadWriteCloser interface {
 	WebSocketCloser
 }
 
-// checkConnErrorWriter writes to c.rwc and records any write errors to c.werr.
+// checkConnErrorWebSocket writes to c.rwc and records any errors to c.werr.
 // It only contains one field (and a pointer field at that), so it
 // fits in an interface value without an extra allocation.
 type checkConnErrorWebSocket struct {
@@ -193,58 +276,73 @@ type checkConnErrorWebSocket struct {
 
 func (w checkConnErrorWebSocket) WriteControl(messageType int, data []byte, deadline time.Time) error {
 	err := w.c.rwc.WriteControl(messageType, data, deadline)
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	if err != nil {
+		w.c.setErr(err)
 	}
 	return err
 }
 func (w checkConnErrorWebSocket) WritePreparedMessage(pm *websocket.PreparedMessage) error {
 	err := w.c.rwc.WritePreparedMessage(pm)
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	if err != nil {
+		w.c.setErr(err)
+	}
+	if err == nil {
+		w.c.addMsgOut(0)
+	}
+	return err
+}
+func (w checkConnErrorWebSocket) writeQueued(msg queuedMessage) error {
+	err := w.c.rwc.WritePreparedMessage(msg.pm)
+	if err != nil {
+		w.c.setErr(err)
+	}
+	if err == nil {
+		w.c.addMsgOut(msg.n)
 	}
 	return err
 }
 func (w checkConnErrorWebSocket) WriteMessage(messageType int, data []byte) error {
 	err := w.c.rwc.WriteMessage(messageType, data)
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	if err != nil {
+		w.c.setErr(err)
+	}
+	if err == nil {
+		w.c.addMsgOut(len(data))
 	}
 	return err
 }
 func (w checkConnErrorWebSocket) WriteJSON(v interface{}) (err error) {
-	err = w.c.rwc.WriteJSON(v)
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
-	return
+	return w.WriteMessage(websocket.TextMessage, p)
 }
 func (w checkConnErrorWebSocket) ReadMessage() (messageType int, p []byte, err error) {
 	messageType, p, err = w.c.rwc.ReadMessage()
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	if err != nil {
+		w.c.setErr(err)
+	}
+	if err == nil {
+		w.c.addMsgIn(len(p))
 	}
 	return messageType, p, err
 }
 func (w checkConnErrorWebSocket) ReadJSON(v interface{}) error {
-	err := w.c.rwc.ReadJSON(v)
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	_, p, err := w.ReadMessage()
+	if err != nil {
+		return err
 	}
-	return err
+	return json.Unmarshal(p, v)
 }
 
 func (w checkConnErrorWebSocket) Close() error {
 	err := w.c.rwc.Close()
-	if err != nil && w.c.werr == nil {
-		w.c.werr = err
-		w.c.cancelCtx()
+	if err != nil {
+		w.c.setErr(err)
 	}
 	return err
 }
+
+// Context returns the connection-level context, see conn.Context.
+func (w checkConnErrorWebSocket) Context() context.Context { return w.c.Context() }
@@ -37,7 +37,19 @@ const (
 	// StateClosed represents a closed connection.
 	// This is a terminal state. Hijacked connections do not
 	// transition to StateClosed.
+	// For a ReconnectingClient, StateClosed is terminal only once the
+	// client stops; otherwise it transitions to StateReconnecting.
 	StateClosed
+
+	// StateConnecting represents a ReconnectingClient dialing its
+	// server. It transitions to StateNew on success, and to
+	// StateReconnecting or StateClosed on failure.
+	StateConnecting
+
+	// StateReconnecting represents a ReconnectingClient waiting out
+	// its backoff before the next dial. It transitions to
+	// StateConnecting or StateClosed.
+	StateReconnecting
 )
 
 var stateName = map[ConnState]string{
@@ -46,6 +58,9 @@ var stateName = map[ConnState]string{
 	StateIdle:     "idle",
 	StateHijacked: "hijacked",
 	StateClosed:   "closed",
+
+	StateConnecting:   "connecting",
+	StateReconnecting: "reconnecting",
 }
 
 func (c ConnState) String() string {
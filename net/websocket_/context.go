@@ -1,5 +1,7 @@
 package websocket_
 
+import "context"
+
 var (
 	// ServerContextKey is a context key. It can be used in Websocket
 	// handlers with context.WithValue to access the server that
@@ -17,6 +19,12 @@ var (
 	// address the connection arrived on.
 	// The associated value will be of type net.Addr.
 	LocalAddrContextKey = &contextKey{"local-addr"}
+
+	// ConnIDContextKey is a context key. It can be used in
+	// Websocket handlers with context.WithValue to access the ID of
+	// the connection, as listed by Server.Conns.
+	// The associated value will be of type uint64.
+	ConnIDContextKey = &contextKey{"conn-id"}
 )
 
 type contextKey struct {
@@ -24,3 +32,13 @@ type contextKey struct {
 }
 
 func (k *contextKey) String() string { return "net/http context value " + k.name }
+
+// ConnContext returns the connection-level context of the connection handed
+// to a handler, or context.Background() if conn carries none.
+// The context is canceled when the connection is closed.
+func ConnContext(conn WebSocketReadWriteCloser) context.Context {
+	if c, ok := conn.(interface{ Context() context.Context }); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
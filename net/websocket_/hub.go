@@ -0,0 +1,274 @@
+package websocket_
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrSendQueueFull is reported to the OnErrorHandler of a connection that
+// is disconnected because its send queue overflowed under OverflowDisconnect.
+var ErrSendQueueFull = errors.New("websocket: send queue full")
+
+// An OverflowPolicy tells the Server what to do when a message is queued
+// for a connection whose send queue is already full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDisconnect closes the slow connection.
+	OverflowDisconnect
+)
+
+var overflowPolicyName = map[OverflowPolicy]string{
+	OverflowDropOldest: "drop_oldest",
+	OverflowDisconnect: "disconnect",
+}
+
+func (p OverflowPolicy) String() string {
+	return overflowPolicyName[p]
+}
+
+// DefaultSendQueueSize is the per-connection send queue capacity used when
+// Server.SendQueueSize is not positive.
+const DefaultSendQueueSize = 256
+
+// closeGracePeriod bounds the write of the close frame sent to a peer
+// while the Server shuts down.
+const closeGracePeriod = time.Second
+
+func (srv *Server) sendQueueSize() int {
+	if srv.SendQueueSize > 0 {
+		return srv.SendQueueSize
+	}
+	return DefaultSendQueueSize
+}
+
+// Broadcast queues a message for every connection of the Server.
+func (srv *Server) Broadcast(messageType int, data []byte) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	conns := make([]*conn, 0, len(srv.activeConn))
+	for c := range srv.activeConn {
+		conns = append(conns, c)
+	}
+	srv.mu.Unlock()
+	for _, c := range conns {
+		c.enqueue(pm, len(data))
+	}
+	return nil
+}
+
+// BroadcastJSON queues the JSON encoding of v as a text message for every
+// connection of the Server.
+func (srv *Server) BroadcastJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return srv.Broadcast(websocket.TextMessage, p)
+}
+
+// Publish queues a message for every connection that joined room.
+func (srv *Server) Publish(room string, messageType int, data []byte) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	members := srv.rooms[room]
+	conns := make([]*conn, 0, len(members))
+	for c := range members {
+		conns = append(conns, c)
+	}
+	srv.mu.Unlock()
+	for _, c := range conns {
+		c.enqueue(pm, len(data))
+	}
+	return nil
+}
+
+// PublishJSON queues the JSON encoding of v as a text message for every
+// connection that joined room.
+func (srv *Server) PublishJSON(room string, v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return srv.Publish(room, websocket.TextMessage, p)
+}
+
+// Send queues a message for a single connection, as handed to a handler.
+func (srv *Server) Send(rw WebSocketReadWriteCloser, messageType int, data []byte) error {
+	c, err := srv.lookupConn(rw)
+	if err != nil {
+		return err
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	c.enqueue(pm, len(data))
+	return nil
+}
+
+// Join adds the connection, as handed to a handler, to room.
+// It may be called from OnOpen. A connection leaves all its rooms when it
+// is closed, and can't join any afterwards: Join returns ErrConnNotFound.
+func (srv *Server) Join(rw WebSocketReadWriteCloser, room string) error {
+	c, err := srv.lookupConn(rw)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	// a closed connection has left all its rooms already
+	if _, ok := srv.activeConn[c]; !ok {
+		return ErrConnNotFound
+	}
+	if srv.rooms == nil {
+		srv.rooms = make(map[string]map[*conn]struct{})
+	}
+	members := srv.rooms[room]
+	if members == nil {
+		members = make(map[*conn]struct{})
+		srv.rooms[room] = members
+	}
+	members[c] = struct{}{}
+	if c.rooms == nil {
+		c.rooms = make(map[string]struct{})
+	}
+	c.rooms[room] = struct{}{}
+	return nil
+}
+
+// Leave removes the connection, as handed to a handler, from room.
+func (srv *Server) Leave(rw WebSocketReadWriteCloser, room string) error {
+	c, err := srv.lookupConn(rw)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.leaveLocked(c, room)
+	return nil
+}
+
+// Rooms returns the names of the rooms that have at least one member.
+func (srv *Server) Rooms() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	rooms := make([]string, 0, len(srv.rooms))
+	for room := range srv.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+func (srv *Server) leaveLocked(c *conn, room string) {
+	if members := srv.rooms[room]; members != nil {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(srv.rooms, room)
+		}
+	}
+	delete(c.rooms, room)
+}
+
+func (srv *Server) leaveAllLocked(c *conn) {
+	for room := range c.rooms {
+		srv.leaveLocked(c, room)
+	}
+}
+
+// connOf returns the conn serving the connection handed to a handler,
+// or nil if rw was not handed out by this package.
+func connOf(rw WebSocketReadWriteCloser) *conn {
+	switch rw := rw.(type) {
+	case checkConnErrorWebSocket:
+		return rw.c
+	case *checkConnErrorWebSocket:
+		return rw.c
+	case *WebSocketConn:
+		return rw.conn
+	}
+	return nil
+}
+
+// lookupConn resolves the connection handed to a handler to the conn
+// serving it.
+func (srv *Server) lookupConn(rw WebSocketReadWriteCloser) (*conn, error) {
+	c := connOf(rw)
+	if c == nil || c.server != srv {
+		return nil, ErrConnNotFound
+	}
+	return c, nil
+}
+
+// enqueue puts pm on the connection's send queue, applying the Server's
+// OverflowPolicy if the queue is full.
+func (c *conn) enqueue(pm *websocket.PreparedMessage, n int) {
+	msg := queuedMessage{pm: pm, n: n}
+	for {
+		select {
+		case c.send <- msg:
+			return
+		default:
+		}
+		if c.server.SendQueueOverflow == OverflowDisconnect {
+			c.server.CheckError(c.rwc, ErrSendQueueFull)
+			c.rwc.Close()
+			return
+		}
+		select {
+		case <-c.send:
+			c.stats.msgsDropped.Inc()
+			c.server.stats.msgsDropped.Inc()
+		default:
+		}
+	}
+}
+
+type queuedMessage struct {
+	pm *websocket.PreparedMessage
+	n  int // payload size, for Stats
+}
+
+// writeLoop drains the send queue until the connection's context is done.
+func (c *conn) writeLoop(ctx context.Context) {
+	defer close(c.writeDone)
+	w := checkConnErrorWebSocket{c: c}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-c.send:
+			if err := w.writeQueued(msg); err != nil {
+				c.unsent = &msg
+				c.server.CheckError(c.rwc, err)
+				return
+			}
+		}
+	}
+}
+
+// closeGoingAway tells the peer the Server is going away, then closes
+// the connection.
+func (c *conn) closeGoingAway() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	c.rwc.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeGracePeriod))
+	c.rwc.Close()
+}
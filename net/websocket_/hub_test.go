@@ -0,0 +1,177 @@
+package websocket_
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// readText reads the next message of c, failing the test on error.
+func readText(t *testing.T, c *websocket.Conn) string {
+	t.Helper()
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(p)
+}
+
+// newSinkServer returns a Server discarding the messages it reads, which
+// hands the connections it opens to opened.
+func newSinkServer(opened chan<- WebSocketReadWriteCloser) *Server {
+	return NewServerFunc(nil,
+		OnOpenHandlerFunc(func(conn WebSocketReadWriteCloser) error {
+			opened <- conn
+			return nil
+		}),
+		OnMsgReadHandlerFunc(func(conn WebSocketReadWriteCloser) (msg interface{}, err error) {
+			_, p, err := conn.ReadMessage()
+			return p, err
+		}), nil, nil, nil)
+}
+
+func TestServerBroadcast(t *testing.T) {
+	opened := make(chan WebSocketReadWriteCloser, 3)
+	srv := newSinkServer(opened)
+	url, stop := newTestServer(t, srv)
+	defer stop()
+
+	var clients []*websocket.Conn
+	var conns []WebSocketReadWriteCloser
+	for i := 0; i < 3; i++ {
+		c, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+		conns = append(conns, <-opened)
+	}
+	// the first and the third are odd
+	for _, i := range []int{0, 2} {
+		if err := srv.Join(conns[i], "odd"); err != nil {
+			t.Fatalf("Join: %v", err)
+		}
+	}
+	if err := srv.Join(conns[1], "even"); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	rooms := srv.Rooms()
+	sort.Strings(rooms)
+	if want := []string{"even", "odd"}; !reflect.DeepEqual(rooms, want) {
+		t.Errorf("Rooms() = %v, want %v", rooms, want)
+	}
+
+	if err := srv.Broadcast(websocket.TextMessage, []byte("all")); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Publish("odd", websocket.TextMessage, []byte("odd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Send(conns[1], websocket.TextMessage, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"all", "odd"}, {"all", "one"}, {"all", "odd"}}
+	for i, c := range clients {
+		for _, w := range want[i] {
+			if got := readText(t, c); got != w {
+				t.Errorf("client %d read %q, want %q", i, got, w)
+			}
+		}
+	}
+
+	if err := srv.Leave(conns[0], "odd"); err != nil {
+		t.Fatalf("Leave: %v", err)
+	}
+	if err := srv.Publish("odd", websocket.TextMessage, []byte("odd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Broadcast(websocket.TextMessage, []byte("end")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readText(t, clients[0]); got != "end" {
+		t.Errorf("client 0 read %q after leaving, want %q", got, "end")
+	}
+
+	// a closed connection leaves its rooms and can't join again
+	clients[1].Close()
+	waitFor(t, "the connection to be untracked", func() bool { return len(srv.Conns()) == 2 })
+	if rooms := srv.Rooms(); !reflect.DeepEqual(rooms, []string{"odd"}) {
+		t.Errorf("Rooms() = %v after close, want [odd]", rooms)
+	}
+	if err := srv.Join(conns[1], "even"); err != ErrConnNotFound {
+		t.Errorf("Join(closed) = %v, want %v", err, ErrConnNotFound)
+	}
+}
+
+func TestServerSendQueueOverflow(t *testing.T) {
+	// messages sent from OnOpen wait in the queue, as writeLoop only
+	// starts once OnOpen returns
+	const queueSize, sent = 4, 10
+	newServer := func(policy OverflowPolicy, errs chan<- error) *Server {
+		var srv *Server
+		srv = NewServerFunc(nil,
+			OnOpenHandlerFunc(func(conn WebSocketReadWriteCloser) error {
+				for i := 0; i < sent; i++ {
+					if err := srv.Send(conn, websocket.TextMessage, []byte(fmt.Sprint(i))); err != nil {
+						return err
+					}
+				}
+				return nil
+			}),
+			OnMsgReadHandlerFunc(func(conn WebSocketReadWriteCloser) (msg interface{}, err error) {
+				_, p, err := conn.ReadMessage()
+				return p, err
+			}), nil, nil,
+			OnErrorHandlerFunc(func(conn WebSocketReadWriteCloser, err error) error {
+				select {
+				case errs <- err:
+				default:
+				}
+				return err
+			}))
+		srv.SendQueueSize = queueSize
+		srv.SendQueueOverflow = policy
+		return srv
+	}
+
+	t.Run(OverflowDropOldest.String(), func(t *testing.T) {
+		srv := newServer(OverflowDropOldest, make(chan error, 1))
+		url, stop := newTestServer(t, srv)
+		defer stop()
+		c, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		for i := sent - queueSize; i < sent; i++ {
+			if got, want := readText(t, c), fmt.Sprint(i); got != want {
+				t.Errorf("read %q, want %q", got, want)
+			}
+		}
+		if got := srv.Stats().MsgsDropped; got != sent-queueSize {
+			t.Errorf("MsgsDropped = %d, want %d", got, sent-queueSize)
+		}
+	})
+
+	t.Run(OverflowDisconnect.String(), func(t *testing.T) {
+		errs := make(chan error, 1)
+		srv := newServer(OverflowDisconnect, errs)
+		url, stop := newTestServer(t, srv)
+		defer stop()
+		c, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if _, _, err := c.ReadMessage(); err == nil {
+			t.Error("read a message from a connection closed on overflow")
+		}
+		if err := <-errs; err != ErrSendQueueFull {
+			t.Errorf("first error = %v, want %v", err, ErrSendQueueFull)
+		}
+	})
+}
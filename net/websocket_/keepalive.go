@@ -0,0 +1,132 @@
+package websocket_
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrPeerTimeout is the close reason of a connection whose peer did not
+// answer a ping within Server.PongTimeout.
+var ErrPeerTimeout = errors.New("websocket: peer did not answer ping in time")
+
+// ErrIdleTimeout is the close reason of a connection that exchanged no
+// message for Server.IdleTimeout.
+var ErrIdleTimeout = errors.New("websocket: connection idle for too long")
+
+// OnPeerTimeoutHandler is notified when a peer fails a liveness check,
+// before the connection is closed. See Server.PeerTimeoutHandler.
+type OnPeerTimeoutHandler interface {
+	OnPeerTimeout(conn WebSocketReadWriteCloser, reason error)
+}
+type OnPeerTimeoutHandlerFunc func(conn WebSocketReadWriteCloser, reason error)
+
+func (f OnPeerTimeoutHandlerFunc) OnPeerTimeout(conn WebSocketReadWriteCloser, reason error) {
+	f(conn, reason)
+}
+
+// CloseReason reports why the connection handed to a handler was closed,
+// typically from an OnCloseHandler. It returns ErrPeerTimeout or
+// ErrIdleTimeout after a failed liveness check, ErrMessageTooLarge after
+// an oversized message, the first read or write error otherwise, and nil
+// if the connection is still open or was closed without error.
+func CloseReason(conn WebSocketReadWriteCloser) error {
+	c := connOf(conn)
+	if c == nil {
+		return nil
+	}
+	if err := c.closeReason.Load(); err != nil {
+		return err
+	}
+	return c.err()
+}
+
+func (s *Server) pongTimeout() time.Duration {
+	if s.PongTimeout > 0 {
+		return s.PongTimeout
+	}
+	return s.PingInterval
+}
+
+// keepAliveInterval returns how often keepAlive must wake up, or 0 if
+// neither pings nor idle timeouts are configured.
+func (s *Server) keepAliveInterval() time.Duration {
+	var d time.Duration
+	ts := []time.Duration{s.IdleTimeout}
+	if s.PingInterval > 0 {
+		ts = append(ts, s.PingInterval, s.pongTimeout())
+	}
+	for _, t := range ts {
+		if t > 0 && (d == 0 || t < d) {
+			d = t
+		}
+	}
+	return d / 2
+}
+
+// keepAlive pings the peer every Server.PingInterval and closes the
+// connection once the peer stops answering, or once no message was
+// exchanged for Server.IdleTimeout. It returns when ctx is done.
+func (c *conn) keepAlive(ctx context.Context) {
+	srv := c.server
+	interval := srv.keepAliveInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// unanswered is the time of the ping awaiting an answer, zero if none.
+	// No other ping is sent meanwhile, so that the peer has PongTimeout to
+	// answer even if it is longer than PingInterval.
+	var lastPing, unanswered time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			lastSeen := time.Unix(0, c.lastSeen.Load())
+			if srv.PingInterval > 0 {
+				if !unanswered.IsZero() && lastSeen.After(unanswered) {
+					unanswered = time.Time{}
+				}
+				if !unanswered.IsZero() {
+					if now.Sub(unanswered) >= srv.pongTimeout() {
+						c.peerTimeout(ErrPeerTimeout)
+						return
+					}
+				} else if now.Sub(lastPing) >= srv.PingInterval {
+					lastPing, unanswered = now, now
+					err := c.rwc.WriteControl(websocket.PingMessage, nil, now.Add(srv.pongTimeout()))
+					if err != nil {
+						srv.CheckError(c.rwc, err)
+						return
+					}
+				}
+			}
+			if srv.IdleTimeout > 0 {
+				lastActive := time.Unix(0, c.lastActive.Load())
+				if st, _ := c.getState(); st != StateActive && now.Sub(lastActive) > srv.IdleTimeout {
+					c.peerTimeout(ErrIdleTimeout)
+					return
+				}
+			}
+		}
+	}
+}
+
+// peerTimeout records reason, notifies Server.PeerTimeoutHandler and closes
+// the connection, which makes serve run the OnCloseHandler.
+func (c *conn) peerTimeout(reason error) {
+	c.closeReason.Store(reason)
+	w := checkConnErrorWebSocket{c: c}
+	if h := c.server.PeerTimeoutHandler; h != nil {
+		h.OnPeerTimeout(w, reason)
+	}
+	c.server.CheckError(c.rwc, reason)
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason.Error())
+	c.rwc.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeGracePeriod))
+	c.rwc.UnderlyingConn().Close()
+}
@@ -0,0 +1,69 @@
+package websocket_
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestServerKeepAlive(t *testing.T) {
+	reasons := make(chan error, 2)
+	srv := NewServerFunc(nil, nil,
+		OnMsgReadHandlerFunc(func(conn WebSocketReadWriteCloser) (msg interface{}, err error) {
+			_, p, err := conn.ReadMessage()
+			return p, err
+		}), nil,
+		OnCloseHandlerFunc(func(conn WebSocketReadWriteCloser) error {
+			reasons <- CloseReason(conn)
+			return nil
+		}), nil)
+	// a PongTimeout longer than PingInterval leaves time for several
+	// pings before a silent peer is closed
+	srv.PingInterval = 20 * time.Millisecond
+	srv.PongTimeout = 100 * time.Millisecond
+	url, stop := newTestServer(t, srv)
+	defer stop()
+
+	// serve reads c in the background, so that pings are answered
+	serve := func(c *websocket.Conn) {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+
+	alive, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alive.Close()
+	go serve(alive)
+
+	silent, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	pings := make(chan struct{}, 100)
+	silent.SetPingHandler(func(string) error {
+		pings <- struct{}{}
+		return nil
+	})
+	go serve(silent)
+
+	select {
+	case reason := <-reasons:
+		if reason != ErrPeerTimeout {
+			t.Errorf("CloseReason = %v, want %v", reason, ErrPeerTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a peer ignoring pings was not closed")
+	}
+	if n := len(pings); n != 1 {
+		t.Errorf("sent %d pings to a silent peer, want 1", n)
+	}
+	// the peer answering pings stays
+	waitFor(t, "the silent connection to be untracked", func() bool { return len(srv.Conns()) == 1 })
+}
@@ -0,0 +1,305 @@
+package websocket_
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/searKing/golib/time_"
+)
+
+// DefaultReconnectBufferSize is the number of outgoing messages a
+// ReconnectingClient keeps while disconnected, if BufferSize is not positive.
+const DefaultReconnectBufferSize = 256
+
+// OnReplayHandler runs on every reconnect of a ReconnectingClient, after
+// OnOpen and before buffered messages are flushed, e.g. to re-subscribe
+// streaming channels.
+type OnReplayHandler interface {
+	OnReplay(conn WebSocketReadWriteCloser) error
+}
+type OnReplayHandlerFunc func(conn WebSocketReadWriteCloser) error
+
+func (f OnReplayHandlerFunc) OnReplay(conn WebSocketReadWriteCloser) error { return f(conn) }
+
+// NewDefaultReconnectDelay returns the backoff used by a ReconnectingClient
+// without Backoff: 100ms doubling up to 30s.
+func NewDefaultReconnectDelay() *time_.Delay {
+	return &time_.Delay{
+		InitDuration: 100 * time.Millisecond,
+		MaxDuration:  30 * time.Second,
+		DelayAgainHandler: func(delay time.Duration) time.Duration {
+			return delay * time_.DefaultStepTimes
+		},
+	}
+}
+
+// A ReconnectingClient keeps a websocket connection to a server up,
+// redialing with backoff whenever it drops.
+type ReconnectingClient struct {
+	*Client
+
+	// HeaderFunc, if non-nil, returns the request header of each dial
+	// attempt, so credentials can be refreshed before every reconnect.
+	// An error counts as a failed attempt.
+	HeaderFunc func(ctx context.Context) (http.Header, error)
+
+	// Backoff paces dial attempts. It is reset once a connection is up.
+	// If nil, NewDefaultReconnectDelay is used.
+	Backoff *time_.Delay
+
+	// MaxAttempts is the number of consecutive failed dials after which
+	// DialAndServe gives up. If zero, it retries forever.
+	MaxAttempts int
+
+	// ReplayHandler, if non-nil, runs on every reconnect, not on the first
+	// connect. If it fails, the connection is dropped and redialed.
+	ReplayHandler OnReplayHandler
+
+	// BufferSize is the number of outgoing messages kept while
+	// disconnected, including the ones a dropped connection left unsent;
+	// the oldest are dropped beyond it. The send queue of each connection
+	// holds SendQueueSize plus BufferSize messages, so that the buffered
+	// ones are flushed whatever SendQueueOverflow.
+	// If zero, DefaultReconnectBufferSize is used.
+	BufferSize int
+
+	// StateHook specifies an optional callback function that is
+	// called on every state transition of the client, including
+	// StateConnecting and StateReconnecting.
+	StateHook func(ConnState)
+
+	mu      sync.Mutex
+	state   ConnState
+	conn    *conn
+	pending []queuedMessage
+	closed  bool
+	cancel  context.CancelFunc
+}
+
+func NewReconnectingClient(cli *Client) *ReconnectingClient {
+	return &ReconnectingClient{Client: cli, state: StateClosed}
+}
+
+// State returns the current state of the client.
+func (rc *ReconnectingClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+func (rc *ReconnectingClient) setState(state ConnState) {
+	rc.mu.Lock()
+	if rc.state == state {
+		rc.mu.Unlock()
+		return
+	}
+	rc.state = state
+	rc.mu.Unlock()
+	if hook := rc.StateHook; hook != nil {
+		hook(state)
+	}
+}
+
+func (rc *ReconnectingClient) bufferSize() int {
+	if rc.BufferSize > 0 {
+		return rc.BufferSize
+	}
+	return DefaultReconnectBufferSize
+}
+
+// Send queues a message for the server. While disconnected, the message
+// is buffered and sent after the next reconnect.
+func (rc *ReconnectingClient) Send(messageType int, data []byte) error {
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	msg := queuedMessage{pm: pm, n: len(data)}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		return ErrClientClosed
+	}
+	if c := rc.conn; c != nil {
+		c.enqueue(msg.pm, msg.n)
+		return nil
+	}
+	rc.bufferLocked(msg)
+	return nil
+}
+
+// bufferLocked adds msgs to the messages sent after the next reconnect,
+// dropping the oldest beyond BufferSize; the caller must hold rc.mu.
+func (rc *ReconnectingClient) bufferLocked(msgs ...queuedMessage) {
+	rc.pending = append(rc.pending, msgs...)
+	if n := len(rc.pending) - rc.bufferSize(); n > 0 {
+		rc.pending = rc.pending[n:]
+	}
+}
+
+// dropped forgets the connection c, once served, and buffers the messages
+// it left unsent, first the one whose write failed, which may have reached
+// the server, then its send queue.
+func (rc *ReconnectingClient) dropped(c *conn) {
+	<-c.writeDone
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.conn = nil
+	var unsent []queuedMessage
+	if c.unsent != nil {
+		unsent = append(unsent, *c.unsent)
+	}
+drain:
+	for {
+		select {
+		case msg := <-c.send:
+			unsent = append(unsent, msg)
+		default:
+			break drain
+		}
+	}
+	rc.pending = append(unsent, rc.pending...)
+	rc.bufferLocked()
+}
+
+// SendJSON queues the JSON encoding of v as a text message, see Send.
+func (rc *ReconnectingClient) SendJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return rc.Send(websocket.TextMessage, p)
+}
+
+// Close stops reconnecting and closes the current connection, if any.
+func (rc *ReconnectingClient) Close() error {
+	rc.mu.Lock()
+	rc.closed = true
+	cancel := rc.cancel
+	rc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// closeOnDone closes the current connection once ctx is done.
+func (rc *ReconnectingClient) closeOnDone(ctx context.Context) {
+	<-ctx.Done()
+	rc.mu.Lock()
+	c := rc.conn
+	rc.mu.Unlock()
+	if c != nil {
+		c.rwc.Close()
+	}
+}
+
+// DialAndServe connects to urlStr and serves the connection, redialing
+// whenever it drops, until ctx is done, Close or Shutdown is called, or
+// MaxAttempts consecutive dials fail. It returns the error that stopped it.
+func (rc *ReconnectingClient) DialAndServe(ctx context.Context, urlStr string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return ErrClientClosed
+	}
+	rc.cancel = cancel
+	rc.mu.Unlock()
+	defer rc.setState(StateClosed)
+	go rc.closeOnDone(ctx)
+
+	backoff := rc.Backoff
+	if backoff == nil {
+		backoff = NewDefaultReconnectDelay()
+	}
+	serveCtx := context.WithValue(context.Background(), ClientContextKey, rc.Client)
+
+	var connected bool // whether any attempt succeeded, to tell reconnects apart
+	var failures int
+	for {
+		rc.setState(StateConnecting)
+		c, err := rc.connect(ctx, urlStr, connected)
+		if err == nil {
+			connected = true
+			failures = 0
+			backoff.Reset()
+			rc.setState(StateNew)
+			c.serve(serveCtx)
+			c.rwc.Close()
+			rc.dropped(c)
+			rc.setState(StateClosed)
+		} else {
+			failures++
+			if rc.MaxAttempts > 0 && failures >= rc.MaxAttempts {
+				return err
+			}
+		}
+		if err := rc.stopped(ctx); err != nil {
+			return err
+		}
+		rc.setState(StateReconnecting)
+		select {
+		case <-ctx.Done():
+			return rc.stopped(ctx)
+		case <-backoff.Delay():
+		}
+	}
+}
+
+// stopped returns why DialAndServe must stop, or nil to keep going.
+func (rc *ReconnectingClient) stopped(ctx context.Context) error {
+	rc.mu.Lock()
+	closed := rc.closed
+	rc.mu.Unlock()
+	if closed || rc.shuttingDown() {
+		return ErrClientClosed
+	}
+	return ctx.Err()
+}
+
+// connect dials urlStr, replays subscriptions on reconnect and flushes the
+// messages buffered while disconnected.
+func (rc *ReconnectingClient) connect(ctx context.Context, urlStr string, reconnect bool) (*conn, error) {
+	var header http.Header
+	if rc.HeaderFunc != nil {
+		h, err := rc.HeaderFunc(ctx)
+		if err != nil {
+			rc.CheckError(nil, err)
+			return nil, err
+		}
+		header = h
+	}
+	c, err := rc.dial(ctx, urlStr, header, rc.sendQueueSize()+rc.bufferSize())
+	if err != nil {
+		return nil, err
+	}
+	if h := rc.ReplayHandler; reconnect && h != nil {
+		err = h.OnReplay(c.rwc)
+		if err = rc.CheckError(c.rwc, err); err != nil {
+			c.close()
+			c.setState(c.rwc, StateClosed)
+			return nil, err
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed || ctx.Err() != nil {
+		c.close()
+		c.setState(c.rwc, StateClosed)
+		return nil, ErrClientClosed
+	}
+	for _, msg := range rc.pending {
+		c.enqueue(msg.pm, msg.n)
+	}
+	rc.pending = nil
+	rc.conn = c
+	return c, nil
+}
@@ -0,0 +1,196 @@
+package websocket_
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/searKing/golib/time_"
+)
+
+type acceptedConn struct {
+	c      *websocket.Conn
+	header http.Header
+}
+
+// newUpgradeServer accepts websocket connections, handed to the test
+// through the returned channel.
+func newUpgradeServer(t *testing.T) (url string, accepted <-chan acceptedConn, stop func()) {
+	ch := make(chan acceptedConn, 4)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ch <- acceptedConn{c: c, header: r.Header}
+	}))
+	return "ws" + strings.TrimPrefix(ts.URL, "http"), ch, ts.Close
+}
+
+func accept(t *testing.T, accepted <-chan acceptedConn) acceptedConn {
+	t.Helper()
+	select {
+	case a := <-accepted:
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a connection")
+	}
+	return acceptedConn{}
+}
+
+func TestReconnectingClient(t *testing.T) {
+	url, accepted, stop := newUpgradeServer(t)
+	defer stop()
+
+	cli := NewClientFunc(nil, nil,
+		OnMsgReadHandlerFunc(func(conn WebSocketReadWriteCloser) (msg interface{}, err error) {
+			_, p, err := conn.ReadMessage()
+			return p, err
+		}), nil, nil, nil)
+	// a queue smaller than the buffer doesn't disconnect on the flush
+	cli.SendQueueSize = 1
+	cli.SendQueueOverflow = OverflowDisconnect
+	rc := NewReconnectingClient(cli)
+	var token int32
+	rc.HeaderFunc = func(ctx context.Context) (http.Header, error) {
+		return http.Header{"X-Token": {fmt.Sprint(atomic.AddInt32(&token, 1))}}, nil
+	}
+	rc.Backoff = &time_.Delay{InitDuration: 10 * time.Millisecond, MaxDuration: 10 * time.Millisecond}
+	rc.ReplayHandler = OnReplayHandlerFunc(func(conn WebSocketReadWriteCloser) error {
+		return conn.WriteJSON("replay")
+	})
+	rc.BufferSize = 2
+	var mu sync.Mutex
+	var states []ConnState
+	rc.StateHook = func(state ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	}
+
+	// buffered before the first connect, beyond BufferSize for the oldest
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := rc.Send(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- rc.DialAndServe(context.Background(), url) }()
+
+	first := accept(t, accepted)
+	if got := first.header.Get("X-Token"); got != "1" {
+		t.Errorf("first dial: X-Token = %q, want 1", got)
+	}
+	for _, want := range []string{"b", "c"} {
+		if got := readText(t, first.c); got != want {
+			t.Errorf("first connection read %q, want %q", got, want)
+		}
+	}
+	first.c.Close()
+
+	second := accept(t, accepted)
+	defer second.c.Close()
+	if got := second.header.Get("X-Token"); got != "2" {
+		t.Errorf("second dial: X-Token = %q, want 2", got)
+	}
+	if err := rc.Send(websocket.TextMessage, []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"replay"`, "d"} {
+		if got := strings.TrimSpace(readText(t, second.c)); got != want {
+			t.Errorf("second connection read %q, want %q", got, want)
+		}
+	}
+
+	rc.Close()
+	if err := <-done; err != ErrClientClosed {
+		t.Errorf("DialAndServe = %v, want %v", err, ErrClientClosed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var reconnecting bool
+	for _, state := range states {
+		reconnecting = reconnecting || state == StateReconnecting
+	}
+	if !reconnecting || states[len(states)-1] != StateClosed {
+		t.Errorf("states = %v, want a reconnect and to end closed", states)
+	}
+}
+
+func TestReconnectingClientBackoff(t *testing.T) {
+	// a closed server refuses every dial
+	url, _, stop := newUpgradeServer(t)
+	stop()
+
+	rc := NewReconnectingClient(NewClientFunc(nil, nil, nil, nil, nil, nil))
+	rc.Backoff = &time_.Delay{
+		InitDuration: 10 * time.Millisecond,
+		MaxDuration:  20 * time.Millisecond,
+		DelayAgainHandler: func(delay time.Duration) time.Duration {
+			return delay * 2
+		},
+	}
+	rc.MaxAttempts = 4
+	var reconnects int
+	rc.StateHook = func(state ConnState) {
+		if state == StateReconnecting {
+			reconnects++
+		}
+	}
+	start := time.Now()
+	if err := rc.DialAndServe(context.Background(), url); err == nil {
+		t.Fatal("DialAndServe of a closed server succeeded")
+	}
+	if reconnects != 3 {
+		t.Errorf("reconnected %d times before giving up, want 3", reconnects)
+	}
+	// 10ms, then 20ms twice
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("gave up after %v, want at least 50ms of backoff", elapsed)
+	}
+}
+
+func TestReconnectingClientDropped(t *testing.T) {
+	newMessage := func(data string) queuedMessage {
+		pm, err := websocket.NewPreparedMessage(websocket.TextMessage, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return queuedMessage{pm: pm, n: len(data)}
+	}
+	msgs := []queuedMessage{newMessage("a"), newMessage("b"), newMessage("c"), newMessage("d")}
+
+	rc := NewReconnectingClient(NewClientFunc(nil, nil, nil, nil, nil, nil))
+	rc.BufferSize = 3
+	// a failed to be written, b, c and d were still queued
+	c := &conn{send: make(chan queuedMessage, 4), writeDone: make(chan struct{})}
+	c.unsent = &msgs[0]
+	for _, msg := range msgs[1:] {
+		c.send <- msg
+	}
+	close(c.writeDone)
+	rc.conn = c
+	rc.dropped(c)
+
+	if rc.conn != nil {
+		t.Error("dropped connection still current")
+	}
+	// the oldest is dropped beyond BufferSize
+	want := msgs[1:]
+	if len(rc.pending) != len(want) {
+		t.Fatalf("buffered %d messages, want %d", len(rc.pending), len(want))
+	}
+	for i := range want {
+		if rc.pending[i].pm != want[i].pm {
+			t.Errorf("buffered message %d is not the one queued", i)
+		}
+	}
+}
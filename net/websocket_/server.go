@@ -40,7 +40,6 @@ func NewServer(h ServerHandler) *Server {
 }
 
 type Server struct {
-	upgrader           websocket.Upgrader // use default options
 	onHandshakeHandler OnHandshakeHandler
 	onOpenHandler      OnOpenHandler
 	onMsgReadHandler   OnMsgReadHandler
@@ -50,13 +49,56 @@ type Server struct {
 
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
-	MaxBytes     int
+	// IdleTimeout is the maximum amount of time a connection may go
+	// without reading or writing a message before it is closed with
+	// ErrIdleTimeout. If zero, there is no idle timeout.
+	IdleTimeout time.Duration
+	// MaxBytes limits the size of each message read from the peer.
+	// A larger message closes the connection with code 1009
+	// (message too big). If zero, DefaultMaxBytes is used.
+	MaxBytes int
+
+	// CheckOrigin returns true if the handshake request Origin header is
+	// acceptable, see AllowAllOrigins, SameOrigin and AllowOrigins.
+	// If nil, AllowAllOrigins is used.
+	CheckOrigin func(r *http.Request) bool
+	// Subprotocols lists the supported subprotocols in order of
+	// preference. A Server picks the first one the client also offers;
+	// a Client offers them all. The negotiated subprotocol is reported
+	// by WebSocketConn.Subprotocol.
+	Subprotocols []string
+	// EnableCompression negotiates permessage-deflate (RFC 7692) with the
+	// peer. Messages are only compressed if the peer agrees.
+	EnableCompression bool
+	// CompressionLevel is the flate level of compressed messages, from
+	// flate.BestSpeed to flate.BestCompression, or flate.HuffmanOnly.
+	// If zero, the websocket package default is used.
+	CompressionLevel int
+
+	// PingInterval, if positive, makes the Server ping each peer at that
+	// interval. A peer that answers no ping within PongTimeout is closed
+	// with ErrPeerTimeout. This also applies to Client.DialAndServe.
+	PingInterval time.Duration
+	// PongTimeout is how long to wait for a pong after a ping.
+	// If zero, PingInterval is used.
+	PongTimeout time.Duration
+	// PeerTimeoutHandler, if non-nil, is notified when a connection fails
+	// a liveness check, before it is closed and its OnCloseHandler runs.
+	PeerTimeoutHandler OnPeerTimeoutHandler
 
 	ErrorLog *log.Logger
 
+	// SendQueueSize is the capacity of each connection's send queue,
+	// used by Broadcast, Publish and Send.
+	// If zero, DefaultSendQueueSize is used.
+	SendQueueSize int
+	// SendQueueOverflow decides what happens to a connection whose send
+	// queue is full. The zero value is OverflowDropOldest.
+	SendQueueOverflow OverflowPolicy
+
 	mu         sync.Mutex
-	activeConn *conn
+	activeConn map[*conn]struct{}
+	rooms      map[string]map[*conn]struct{}
 	onShutdown []func()
 
 	// server state
@@ -66,12 +108,20 @@ type Server struct {
 	// called when a client connection changes state. See the
 	// ConnState type and associated constants for details.
 	ConnState func(*WebSocketConn, ConnState)
+
+	// LatencyBuckets specifies the upper bounds of the handler latency
+	// histogram reported by Stats. If empty, DefaultLatencyBuckets is used.
+	LatencyBuckets []time.Duration
+
+	nextConnID atomic.Uint64
+	stats      serverStats
 }
 
 func (srv *Server) CheckError(conn WebSocketReadWriteCloser, err error) error {
 	if err == nil {
 		return nil
 	}
+	srv.stats.errors.Add(errorKindOf(err))
 	return srv.onErrorHandler.OnError(conn, err)
 }
 
@@ -81,12 +131,15 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		return ErrServerClosed
 	}
 	// transfer http to websocket
-	srv.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-	ws, err := srv.upgrader.Upgrade(w, r, nil)
+	ws, err := srv.newUpgrader().Upgrade(w, r, nil)
 	if srv.CheckError(nil, err) != nil {
 		return err
 	}
 	defer ws.Close()
+	err = srv.configureConn(ws)
+	if srv.CheckError(nil, err) != nil {
+		return err
+	}
 	ctx := context.WithValue(context.Background(), ServerContextKey, srv)
 	// Handle HTTP Handshake
 	err = srv.onHandshakeHandler.OnHandshake(w, r)
@@ -94,29 +147,54 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 	// takeover the connect
-	c := srv.newConn(ws)
+	c := srv.newConn(ws, srv.sendQueueSize())
+	// tracked before OnOpen, so that it may Join rooms
+	c.setState(c.rwc, StateNew)
 	// Handle websocket On
 	err = srv.onOpenHandler.OnOpen(c.rwc)
 	if err = srv.CheckError(c.rwc, err); err != nil {
 		c.close()
+		c.setState(c.rwc, StateClosed)
 		return err
 	}
-	c.setState(c.rwc, StateNew) // before Serve can return
 
 	c.serve(ctx)
 	return nil
 }
 
-// Create new connection from rwc.
-func (srv *Server) newConn(wc *websocket.Conn) *conn {
+// Create new connection from rwc, with a send queue of queueSize messages.
+func (srv *Server) newConn(wc *websocket.Conn, queueSize int) *conn {
 	c := &conn{
-		server: srv,
-		rwc: &WebSocketConn{
-			Conn: wc,
-		},
+		server:    srv,
+		id:        srv.nextConnID.Inc(),
+		createdAt: time.Now(),
+		send:      make(chan queuedMessage, queueSize),
+		writeDone: make(chan struct{}),
+	}
+	c.lastSeen.Store(c.createdAt.UnixNano())
+	c.lastActive.Store(c.createdAt.UnixNano())
+	c.rwc = &WebSocketConn{
+		Conn: wc,
+		conn: c,
 	}
+	c.rwc.SetReadLimit(int64(srv.maxBytes()))
 	return c
 }
+
+func (s *Server) trackConn(c *conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activeConn == nil {
+		s.activeConn = make(map[*conn]struct{})
+	}
+	if add {
+		s.activeConn[c] = struct{}{}
+		s.stats.total.Inc()
+	} else {
+		delete(s.activeConn, c)
+		s.leaveAllLocked(c)
+	}
+}
 func (s *Server) logf(format string, args ...interface{}) {
 	if s.ErrorLog != nil {
 		s.ErrorLog.Printf(format, args...)
@@ -36,14 +36,13 @@ func (srv *Server) RegisterOnShutdown(f func()) {
 	srv.mu.Unlock()
 }
 
-// closeIdleConns closes all idle connections and reports whether the
-// server is quiescent.
+// closeIdleConns closes all idle connections whose send queue has been
+// drained and reports whether the server is quiescent.
 func (s *Server) closeIdleConns() bool {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	quiescent := true
-
-	if c := s.activeConn; c != nil {
+	var idle []*conn
+	for c := range s.activeConn {
 		st, unixSec := c.getState()
 		// Issue 22682: treat StateNew connections as if
 		// they're idle if we haven't read the first request's
@@ -51,14 +50,20 @@ func (s *Server) closeIdleConns() bool {
 		if st == StateNew && unixSec < time.Now().Unix()-5 {
 			st = StateIdle
 		}
-		if st != StateIdle || unixSec == 0 {
+		if st != StateIdle || unixSec == 0 || len(c.send) > 0 {
 			// Assume unixSec == 0 means it's a very new
 			// connection, without state set yet.
 			quiescent = false
-			return quiescent
+			continue
 		}
-		c.rwc.Close()
-		s.activeConn = nil
+		idle = append(idle, c)
+		delete(s.activeConn, c)
+		s.leaveAllLocked(c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range idle {
+		c.closeGoingAway()
 	}
 	return quiescent
 }
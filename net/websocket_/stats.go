@@ -0,0 +1,216 @@
+package websocket_
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/searKing/golib/net/internal/connstats"
+	"go.uber.org/atomic"
+)
+
+// ErrConnNotFound is returned by Server.CloseConn when no tracked
+// connection has the given ID.
+var ErrConnNotFound = errors.New("websocket: connection not found")
+
+// An ErrorKind classifies an error seen by the Server, for Stats.
+type ErrorKind = connstats.ErrorKind
+
+// Kinds of errors, see connstats for their meaning.
+const (
+	ErrorKindOther    = connstats.ErrorKindOther
+	ErrorKindEOF      = connstats.ErrorKindEOF
+	ErrorKindTimeout  = connstats.ErrorKindTimeout
+	ErrorKindTooLarge = connstats.ErrorKindTooLarge
+	ErrorKindNet      = connstats.ErrorKindNet
+	ErrorKindPanic    = connstats.ErrorKindPanic
+	ErrorKindClose    = connstats.ErrorKindClose
+)
+
+func errorKindOf(err error) ErrorKind {
+	switch err {
+	case ErrMessageTooLarge, websocket.ErrReadLimit:
+		return ErrorKindTooLarge
+	}
+	if _, ok := err.(*websocket.CloseError); ok {
+		return ErrorKindClose
+	}
+	return connstats.KindOf(err)
+}
+
+// DefaultLatencyBuckets are the upper bounds of the handler latency
+// histogram used when Server.LatencyBuckets is empty.
+var DefaultLatencyBuckets = connstats.DefaultLatencyBuckets
+
+// A LatencyHistogram is a snapshot of handler latencies.
+// Counts[i] is the number of observations in (Buckets[i-1], Buckets[i]];
+// the last element of Counts holds observations above every bucket.
+type LatencyHistogram = connstats.LatencyHistogram
+
+// Stats is a point-in-time snapshot of a Server's connections and traffic.
+type Stats struct {
+	Open   int64 // connections currently tracked
+	Active int64 // open connections reading or handling a message
+	Idle   int64 // open connections waiting for the next message
+	Total  int64 // connections accepted since the Server started
+
+	BytesIn  int64 // payload bytes of messages read
+	BytesOut int64 // payload bytes of messages written
+	MsgsIn   int64 // data messages read
+	MsgsOut  int64 // data messages written
+	// MsgsDropped counts queued messages discarded under OverflowDropOldest.
+	MsgsDropped int64
+
+	HandleLatency LatencyHistogram // time spent in OnMsgHandle
+	Errors        map[ErrorKind]int64
+}
+
+// ConnInfo describes a live connection, as listed by Server.Conns.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr string
+	LocalAddr  string
+	State      ConnState
+	StateSince time.Time
+	CreatedAt  time.Time
+	Age        time.Duration
+
+	BytesIn     int64
+	BytesOut    int64
+	MsgsIn      int64
+	MsgsOut     int64
+	MsgsDropped int64
+	Queued      int // messages waiting in the send queue
+	Rooms       []string
+}
+
+// connStats counts the traffic of one connection.
+type connStats struct {
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	msgsIn   atomic.Int64
+	msgsOut  atomic.Int64
+
+	msgsDropped atomic.Int64
+}
+
+// serverStats aggregates counters over every connection of a Server.
+type serverStats struct {
+	connStats
+	total         atomic.Int64
+	handleLatency connstats.Histogram
+	errors        connstats.Errors
+}
+
+func (c *conn) touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+func (c *conn) addMsgIn(n int) {
+	c.touch()
+	c.lastActive.Store(time.Now().UnixNano())
+	c.stats.bytesIn.Add(int64(n))
+	c.server.stats.bytesIn.Add(int64(n))
+	c.stats.msgsIn.Inc()
+	c.server.stats.msgsIn.Inc()
+}
+
+func (c *conn) addMsgOut(n int) {
+	c.lastActive.Store(time.Now().UnixNano())
+	c.stats.bytesOut.Add(int64(n))
+	c.server.stats.bytesOut.Add(int64(n))
+	c.stats.msgsOut.Inc()
+	c.server.stats.msgsOut.Inc()
+}
+
+// info describes c; the caller must hold c.server.mu.
+func (c *conn) info(now time.Time) ConnInfo {
+	st, unixSec := c.getState()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return ConnInfo{
+		ID:          c.id,
+		RemoteAddr:  c.rwc.RemoteAddr().String(),
+		LocalAddr:   c.rwc.LocalAddr().String(),
+		State:       st,
+		StateSince:  time.Unix(unixSec, 0),
+		CreatedAt:   c.createdAt,
+		Age:         now.Sub(c.createdAt),
+		BytesIn:     c.stats.bytesIn.Load(),
+		BytesOut:    c.stats.bytesOut.Load(),
+		MsgsIn:      c.stats.msgsIn.Load(),
+		MsgsOut:     c.stats.msgsOut.Load(),
+		MsgsDropped: c.stats.msgsDropped.Load(),
+		Queued:      len(c.send),
+		Rooms:       rooms,
+	}
+}
+
+func (srv *Server) latencyBuckets() []time.Duration {
+	if len(srv.LatencyBuckets) > 0 {
+		return srv.LatencyBuckets
+	}
+	return DefaultLatencyBuckets
+}
+
+// Stats returns a snapshot of the Server's connection counts, traffic,
+// handler latencies and errors.
+func (srv *Server) Stats() Stats {
+	s := Stats{
+		Total:         srv.stats.total.Load(),
+		BytesIn:       srv.stats.bytesIn.Load(),
+		BytesOut:      srv.stats.bytesOut.Load(),
+		MsgsIn:        srv.stats.msgsIn.Load(),
+		MsgsOut:       srv.stats.msgsOut.Load(),
+		MsgsDropped:   srv.stats.msgsDropped.Load(),
+		HandleLatency: srv.stats.handleLatency.Snapshot(srv.latencyBuckets()),
+		Errors:        srv.stats.errors.Snapshot(),
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.activeConn {
+		s.Open++
+		switch st, _ := c.getState(); st {
+		case StateActive:
+			s.Active++
+		case StateNew, StateIdle:
+			s.Idle++
+		}
+	}
+	return s
+}
+
+// Conns lists the Server's live connections, oldest first.
+func (srv *Server) Conns() []ConnInfo {
+	now := time.Now()
+	srv.mu.Lock()
+	infos := make([]ConnInfo, 0, len(srv.activeConn))
+	for c := range srv.activeConn {
+		infos = append(infos, c.info(now))
+	}
+	srv.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CloseConn closes the live connection with the given ID, as reported by
+// Conns. The connection's OnCloseHandler runs once its serve loop exits.
+func (srv *Server) CloseConn(id uint64) error {
+	srv.mu.Lock()
+	var target *conn
+	for c := range srv.activeConn {
+		if c.id == id {
+			target = c
+			break
+		}
+	}
+	srv.mu.Unlock()
+	if target == nil {
+		return ErrConnNotFound
+	}
+	return target.rwc.Close()
+}
@@ -0,0 +1,94 @@
+package websocket_
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves srv over HTTP and returns its ws:// URL.
+func newTestServer(t *testing.T, srv *Server) (url string, stop func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.ServeHTTP(w, r)
+	}))
+	return "ws" + strings.TrimPrefix(ts.URL, "http"), ts.Close
+}
+
+// waitFor polls cond until it holds, failing the test after 5s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newEchoServer returns a Server writing back each text message read as
+// a JSON string.
+func newEchoServer() *Server {
+	return NewServerFunc(nil, nil,
+		OnMsgReadHandlerFunc(func(conn WebSocketReadWriteCloser) (msg interface{}, err error) {
+			_, p, err := conn.ReadMessage()
+			return string(p), err
+		}),
+		OnMsgHandleHandlerFunc(func(conn WebSocketReadWriteCloser, msg interface{}) error {
+			return conn.WriteJSON(msg)
+		}), nil, nil)
+}
+
+func TestServerStats(t *testing.T) {
+	srv := newEchoServer()
+	url, closeServer := newTestServer(t, srv)
+	defer closeServer()
+
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	var echo string
+	if err := c.ReadJSON(&echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo != "hello" {
+		t.Fatalf("echo = %q, want %q", echo, "hello")
+	}
+
+	conns := srv.Conns()
+	if len(conns) != 1 {
+		t.Fatalf("len(Conns()) = %d, want 1", len(conns))
+	}
+	if got, want := conns[0].RemoteAddr, c.LocalAddr().String(); got != want {
+		t.Errorf("RemoteAddr = %q, want %q", got, want)
+	}
+
+	waitFor(t, "the handler latency", func() bool { return srv.Stats().HandleLatency.Count == 1 })
+	s := srv.Stats()
+	if s.Open != 1 || s.Total != 1 {
+		t.Errorf("Open, Total = %d, %d; want 1, 1", s.Open, s.Total)
+	}
+	if s.MsgsIn != 1 || s.MsgsOut != 1 {
+		t.Errorf("MsgsIn, MsgsOut = %d, %d; want 1, 1", s.MsgsIn, s.MsgsOut)
+	}
+	if s.BytesIn != 5 || s.BytesOut != int64(len(`"hello"`)) {
+		t.Errorf("BytesIn, BytesOut = %d, %d; want 5, %d", s.BytesIn, s.BytesOut, len(`"hello"`))
+	}
+
+	if err := srv.CloseConn(conns[0].ID); err != nil {
+		t.Fatalf("CloseConn: %v", err)
+	}
+	if err := srv.CloseConn(conns[0].ID + 1); err != ErrConnNotFound {
+		t.Errorf("CloseConn(unknown) = %v, want %v", err, ErrConnNotFound)
+	}
+	waitFor(t, "the connection to be untracked", func() bool { return len(srv.Conns()) == 0 })
+}
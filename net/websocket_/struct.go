@@ -2,10 +2,6 @@ package websocket_
 
 import "time"
 
-func (srv *Server) initialReadLimitSize() int64 {
-	return int64(srv.maxBytes()) + 4096 // bufio slop
-}
-
 const DefaultMaxBytes = 1 << 20 // 1 MB
 func (srv *Server) maxBytes() int {
 	if srv.MaxBytes > 0 {
@@ -0,0 +1,95 @@
+package websocket_
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// AllowAllOrigins accepts every handshake, whatever its Origin header.
+// It is the policy used when Server.CheckOrigin is nil.
+func AllowAllOrigins(r *http.Request) bool { return true }
+
+// SameOrigin accepts handshakes without an Origin header, or whose Origin
+// host equals the request Host, like a websocket.Upgrader with a nil
+// CheckOrigin.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// AllowOrigins returns an origin policy that accepts handshakes without
+// an Origin header, or whose Origin matches one of patterns.
+// A pattern is either a full origin such as "https://example.com", matched
+// exactly, or a host pattern such as "example.com" or "*.example.com",
+// matched against the Origin host with path.Match.
+func AllowOrigins(patterns ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		for _, pattern := range patterns {
+			if strings.Contains(pattern, "://") {
+				if strings.EqualFold(strings.TrimSuffix(pattern, "/"), origin) {
+					return true
+				}
+				continue
+			}
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(u.Host)); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (srv *Server) checkOrigin() func(r *http.Request) bool {
+	if srv.CheckOrigin != nil {
+		return srv.CheckOrigin
+	}
+	return AllowAllOrigins
+}
+
+// newUpgrader returns the websocket.Upgrader configured by the Server's
+// origin, subprotocol and compression options.
+func (srv *Server) newUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		Subprotocols:      srv.Subprotocols,
+		CheckOrigin:       srv.checkOrigin(),
+		EnableCompression: srv.EnableCompression,
+	}
+}
+
+// newDialer returns the websocket.Dialer configured by the Server's
+// subprotocol and compression options, for use by a Client.
+func (srv *Server) newDialer() *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = srv.Subprotocols
+	dialer.EnableCompression = srv.EnableCompression
+	return &dialer
+}
+
+// configureConn applies the compression level of the Server to ws.
+func (srv *Server) configureConn(ws *websocket.Conn) error {
+	if srv.EnableCompression && srv.CompressionLevel != 0 {
+		if err := ws.SetCompressionLevel(srv.CompressionLevel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
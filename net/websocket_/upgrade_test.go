@@ -0,0 +1,144 @@
+package websocket_
+
+import (
+	"compress/flate"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOriginPolicies(t *testing.T) {
+	allow := AllowOrigins("https://example.com", "*.example.org")
+	tests := []struct {
+		origin, host  string
+		same, allowed bool
+	}{
+		{"", "example.com", true, true},
+		{"https://example.com", "example.com", true, true},
+		{"http://example.com", "example.com", true, false},
+		{"https://EXAMPLE.com", "example.com", true, true},
+		{"https://a.example.org", "example.com", false, true},
+		{"https://example.org", "example.org", true, false},
+		{"https://evil.com", "example.com", false, false},
+		{"://bad", "example.com", false, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := SameOrigin(r); got != tt.same {
+			t.Errorf("SameOrigin(Origin %q, Host %q) = %t, want %t", tt.origin, tt.host, got, tt.same)
+		}
+		if got := allow(r); got != tt.allowed {
+			t.Errorf("AllowOrigins(Origin %q) = %t, want %t", tt.origin, got, tt.allowed)
+		}
+	}
+
+	// the policy of a Server applies to its handshakes
+	srv := newEchoServer()
+	srv.CheckOrigin = SameOrigin
+	url, stop := newTestServer(t, srv)
+	defer stop()
+	c, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.com"}})
+	if err == nil {
+		c.Close()
+		t.Fatal("handshake from another origin succeeded")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("handshake from another origin: response %v, want %d", resp, http.StatusForbidden)
+	}
+}
+
+func TestServerCompression(t *testing.T) {
+	srv := newEchoServer()
+	srv.EnableCompression = true
+	srv.CompressionLevel = flate.BestCompression
+	url, stop := newTestServer(t, srv)
+	defer stop()
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	c, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("Sec-Websocket-Extensions = %q, want permessage-deflate", ext)
+	}
+	data := strings.Repeat("compressible ", 1000)
+	if err := c.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	var echo string
+	if err := c.ReadJSON(&echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo != data {
+		t.Errorf("echo of %d bytes, want %d", len(echo), len(data))
+	}
+}
+
+func TestWebSocketConnReadLimit(t *testing.T) {
+	const limit = 64
+	errs := make(chan error, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		c := &WebSocketConn{Conn: ws}
+		c.SetReadLimit(limit)
+		for {
+			var v string
+			err := c.ReadJSON(&v)
+			errs <- err
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	c, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	next := func() error {
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ReadJSON")
+		}
+		return nil
+	}
+	if err := c.WriteJSON("small"); err != nil {
+		t.Fatal(err)
+	}
+	if err := next(); err != nil {
+		t.Fatalf("ReadJSON of a message within the limit: %v", err)
+	}
+	// compressed, the message is well within the limit
+	if err := c.WriteJSON(strings.Repeat("a", 10*limit)); err != nil {
+		t.Fatal(err)
+	}
+	if err := next(); err != websocket.ErrReadLimit {
+		t.Errorf("ReadJSON of a message beyond the limit = %v, want %v", err, websocket.ErrReadLimit)
+	}
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("peer read %v, want close %d", err, websocket.CloseMessageTooBig)
+	}
+}
@@ -1,10 +1,14 @@
 package websocket_
 
 import (
+	"encoding/json"
 	"github.com/gorilla/websocket"
 	"github.com/searKing/golib/util/object"
 	"gitlab.hobot.cc/haixin.chen/go-mvc/transport"
+	"io"
+	"io/ioutil"
 	"sync"
+	"time"
 )
 
 // make websocket concurrent safe
@@ -13,6 +17,11 @@ type WebSocketConn struct {
 	*websocket.Conn
 	muRead  sync.Mutex
 	muWrite sync.Mutex
+
+	// conn is the Server side state of the connection, if any.
+	conn *conn
+	// readLimit is the payload limit of ReadMessage, see SetReadLimit.
+	readLimit int64
 }
 
 func NewWebSocketConn(rw *websocket.Conn) transport.ReadWriteCloser {
@@ -21,15 +30,66 @@ func NewWebSocketConn(rw *websocket.Conn) transport.ReadWriteCloser {
 		Conn: rw,
 	}
 }
+
+// SetReadLimit sets the maximum size of a message read from the peer.
+// Unlike websocket.Conn, the limit applies to the decompressed payload
+// of ReadMessage, so compressed messages cannot exceed it either.
+// If a message exceeds the limit, the connection sends a close message
+// with code 1009 (message too big) and returns websocket.ErrReadLimit.
+func (c *WebSocketConn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+	if limit > 0 {
+		// deflate expands incompressible data by 5 bytes per stored block
+		limit += (limit/0xffff+1)*5 + 8
+	}
+	c.Conn.SetReadLimit(limit)
+}
 func (c *WebSocketConn) ReadMessage() (messageType int, p []byte, err error) {
 	c.muRead.Lock()
 	defer c.muRead.Unlock()
-	return c.Conn.ReadMessage()
+	messageType, r, err := c.Conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	if c.readLimit > 0 {
+		r = io.LimitReader(r, c.readLimit+1)
+	}
+	p, err = ioutil.ReadAll(r)
+	if err == nil && c.readLimit > 0 && int64(len(p)) > c.readLimit {
+		msg := websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "")
+		c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return messageType, nil, websocket.ErrReadLimit
+	}
+	return messageType, p, err
 }
-func (c *WebSocketConn) WriteJSON(v interface{}) error {
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	c.muWrite.Lock()
+	defer c.muWrite.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+func (c *WebSocketConn) WritePreparedMessage(pm *websocket.PreparedMessage) error {
 	c.muWrite.Lock()
 	defer c.muWrite.Unlock()
-	return c.Conn.WriteJSON(v)
+	return c.Conn.WritePreparedMessage(pm)
+}
+
+// ReadJSON reads the next message with ReadMessage, so that the read limit
+// applies, and decodes it into v.
+func (c *WebSocketConn) ReadJSON(v interface{}) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteJSON writes the JSON encoding of v as a text message.
+func (c *WebSocketConn) WriteJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, p)
 }
 func (c *WebSocketConn) Close() error {
 	c.muWrite.Lock()
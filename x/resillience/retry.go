@@ -26,19 +26,21 @@ import (
 	"context"
 	"time"
 
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // Retry executes a f until no error is returned or failAfter is reached.
 // A failAfter Timeout of zero means no timeout.
-// maxWait max interval of two f
+// maxWait max interval of two f; the interval starts at 100ms, capped by
+// maxWait, so that a maxWait <= 0 retries at once, and doubles while f and
+// the wait take less than 2*maxWait.
+// Use RetryPolicy for jitter, attempts limits, error classification or
+// retries not logged to logger.
 func Retry(ctx context.Context, logger logrus.FieldLogger, maxWait time.Duration, failAfter time.Duration, f func() error) (err error) {
 	if logger == nil {
 		logger = logrus.StandardLogger()
 	}
 
-	err = errors.New("did not connect")
 	waitReform := func(wait time.Duration) time.Duration {
 		if wait > maxWait {
 			wait = maxWait
@@ -46,17 +48,12 @@ func Retry(ctx context.Context, logger logrus.FieldLogger, maxWait time.Duration
 		return wait
 	}
 
-	loopWait := waitReform(time.Millisecond * 100)
+	loopWait := waitReform(DefaultRetryInitialInterval)
 	if failAfter != 0 {
 		cancelCtx, cancelFn := context.WithTimeout(ctx, failAfter)
 		defer cancelFn()
 		ctx = cancelCtx
-	} else {
-		cancelCtx, cancelFn := context.WithCancel(ctx)
-		defer cancelFn()
-		ctx = cancelCtx
 	}
-L:
 	for {
 		start := time.Now()
 
@@ -64,17 +61,17 @@ L:
 			return nil
 		}
 		logger.WithError(err).Warnf("retrying in %s seconds...", loopWait)
+		timer := time.NewTimer(loopWait)
 		select {
 		case <-ctx.Done():
-			break L
-		case <-time.After(loopWait):
+			timer.Stop()
+			return err
+		case <-timer.C:
 		}
 
 		// task takes too much time, keep the step
 		if time.Now().Before(start.Add(maxWait * 2)) {
-			loopWait = waitReform(loopWait * 2)
+			loopWait = waitReform(loopWait * DefaultRetryMultiplier)
 		}
-
 	}
-	return err
 }
@@ -0,0 +1,252 @@
+package resilience
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/searKing/golib/crypto/rand_"
+)
+
+// Jitter randomizes the waits between retries, so that the clients of a
+// recovering service do not retry in lockstep.
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type Jitter int
+
+const (
+	// JitterNone waits the exponential backoff itself.
+	JitterNone Jitter = iota
+	// JitterFull waits a random duration in [0, backoff).
+	JitterFull
+	// JitterEqual waits half the backoff plus a random duration in
+	// [0, backoff/2).
+	JitterEqual
+	// JitterDecorrelated waits a random duration in
+	// [InitialInterval, 3 * previous wait), capped by MaxInterval.
+	JitterDecorrelated
+)
+
+const (
+	DefaultRetryInitialInterval = 100 * time.Millisecond
+	DefaultRetryMultiplier      = 2
+)
+
+// RetryPolicy retries a function with exponential backoff until it
+// succeeds, returns a non retryable error, or the attempts, time or context
+// run out. The zero value retries forever, from 100ms, doubling.
+type RetryPolicy struct {
+	// InitialInterval is the wait after the first attempt;
+	// DefaultRetryInitialInterval if zero.
+	InitialInterval time.Duration
+	// MaxInterval caps the waits, if positive.
+	MaxInterval time.Duration
+	// Multiplier multiplies the wait after each attempt;
+	// DefaultRetryMultiplier if zero.
+	Multiplier float64
+	Jitter     Jitter
+
+	// MaxAttempts is the maximum number of attempts, if positive.
+	MaxAttempts int
+	// MaxElapsedTime bounds the time spent, waits and attempts, if positive.
+	MaxElapsedTime time.Duration
+	// AttemptTimeout bounds each attempt, through its context, if positive.
+	AttemptTimeout time.Duration
+
+	// Retryable reports whether the error err of an attempt is retryable;
+	// all are if nil. Errors marked by Permanent or Transient are
+	// classified as such, whatever Retryable reports.
+	Retryable func(err error) bool
+	// OnRetry, if not nil, is called before waiting wait after the failed
+	// attempt attempt, counted from 1.
+	OnRetry func(attempt int, err error, wait time.Duration)
+
+	// Rand draws the jitter; a Rand seeded with the current time if nil.
+	Rand *rand_.Rand
+}
+
+// RetryResult reports the attempts of RetryPolicy.Do.
+type RetryResult struct {
+	Attempts int
+	Elapsed  time.Duration
+}
+
+// Do calls f until it returns nil or a non retryable error, or the policy
+// or ctx stop the retries, and returns the last error of f, unwrapped of
+// Permanent and Transient.
+func (p *RetryPolicy) Do(ctx context.Context, f func(ctx context.Context) error) (RetryResult, error) {
+	start := time.Now()
+	var res RetryResult
+	if p.MaxElapsedTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.MaxElapsedTime)
+		defer cancel()
+	}
+	r := p.Rand
+	if r == nil {
+		r = rand_.NewMath(time.Now().UnixNano())
+	}
+
+	var wait time.Duration
+	for {
+		res.Attempts++
+		err := p.attempt(ctx, f)
+		if err == nil {
+			res.Elapsed = time.Since(start)
+			return res, nil
+		}
+		if !p.retryable(err) || (p.MaxAttempts > 0 && res.Attempts >= p.MaxAttempts) || ctx.Err() != nil {
+			res.Elapsed = time.Since(start)
+			return res, unwrapRetryError(err)
+		}
+
+		wait = p.backoff(res.Attempts, wait, r)
+		if p.OnRetry != nil {
+			p.OnRetry(res.Attempts, unwrapRetryError(err), wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			res.Elapsed = time.Since(start)
+			return res, unwrapRetryError(err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) attempt(ctx context.Context, f func(ctx context.Context) error) error {
+	if p.AttemptTimeout <= 0 {
+		return f(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	return f(ctx)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	if isTransient(err) {
+		return true
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff returns the wait after the attempt attempt, following the wait
+// prev.
+func (p *RetryPolicy) backoff(attempt int, prev time.Duration, r *rand_.Rand) time.Duration {
+	initial := p.InitialInterval
+	if initial <= 0 {
+		initial = DefaultRetryInitialInterval
+	}
+	max := time.Duration(math.MaxInt64)
+	if p.MaxInterval > 0 {
+		max = p.MaxInterval
+	}
+	if initial > max {
+		initial = max
+	}
+
+	if p.Jitter == JitterDecorrelated {
+		if prev < initial {
+			prev = initial
+		}
+		upper := 3 * float64(prev)
+		wait := float64(initial) + r.Float64()*(upper-float64(initial))
+		if wait >= float64(max) {
+			return max
+		}
+		return time.Duration(wait)
+	}
+
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+	backoff := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if backoff >= float64(max) {
+		backoff = float64(max)
+	}
+	switch p.Jitter {
+	case JitterFull:
+		return time.Duration(r.Float64() * backoff)
+	case JitterEqual:
+		return time.Duration(backoff/2 + r.Float64()*backoff/2)
+	}
+	return time.Duration(backoff)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Cause() error  { return e.err }
+
+type transientError struct{ err error }
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Cause() error  { return e.err }
+
+// Permanent marks err as not retryable; RetryPolicy.Do returns err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Transient marks err as retryable, whatever RetryPolicy.Retryable reports.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsPermanent reports whether err, or its cause, is marked by Permanent.
+func IsPermanent(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *permanentError:
+			return true
+		case *transientError:
+			return false
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// isTransient reports whether err, or its cause, is marked by Transient.
+func isTransient(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *transientError:
+			return true
+		case *permanentError:
+			return false
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// unwrapRetryError returns err unwrapped of Permanent and Transient.
+func unwrapRetryError(err error) error {
+	for {
+		switch e := err.(type) {
+		case *permanentError:
+			err = e.err
+		case *transientError:
+			err = e.err
+		default:
+			return err
+		}
+	}
+}
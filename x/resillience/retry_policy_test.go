@@ -0,0 +1,99 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/searKing/golib/crypto/rand_"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	errFatal := errors.New("fatal")
+	wrapped := errors.Wrap(Permanent(errFatal), "query")
+	fail := func(errs ...error) func(context.Context) error {
+		return func(context.Context) error {
+			if len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		}
+	}
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		f            func(context.Context) error
+		wantAttempts int
+		wantErr      error
+	}{
+		{"success after retries", RetryPolicy{}, fail(errFlaky, errFlaky), 3, nil},
+		{"max attempts", RetryPolicy{MaxAttempts: 2}, fail(errFlaky, errFlaky, errFlaky), 2, errFlaky},
+		{"permanent", RetryPolicy{}, fail(wrapped), 1, wrapped},
+		{"classifier", RetryPolicy{Retryable: func(err error) bool { return err != errFatal }}, fail(errFlaky, errFatal), 2, errFatal},
+		{"transient overrides the classifier", RetryPolicy{Retryable: func(error) bool { return false }}, fail(Transient(errFlaky)), 2, nil},
+	}
+	if !IsPermanent(wrapped) || IsPermanent(errFatal) {
+		t.Error("IsPermanent misses the causes")
+	}
+	for _, tt := range tests {
+		tt.policy.InitialInterval = time.Millisecond
+		var retries int
+		tt.policy.OnRetry = func(attempt int, err error, wait time.Duration) { retries++ }
+		res, err := tt.policy.Do(context.Background(), tt.f)
+		if err != tt.wantErr {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if res.Attempts != tt.wantAttempts || retries != tt.wantAttempts-1 {
+			t.Errorf("%s: %d attempts, %d retries, want %d attempts", tt.name, res.Attempts, retries, tt.wantAttempts)
+		}
+	}
+}
+
+func TestRetryPolicyTimeouts(t *testing.T) {
+	p := RetryPolicy{InitialInterval: time.Millisecond, AttemptTimeout: 5 * time.Millisecond, MaxElapsedTime: 50 * time.Millisecond}
+	res, err := p.Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != context.DeadlineExceeded || res.Attempts < 2 || res.Elapsed < 50*time.Millisecond || res.Elapsed > time.Second {
+		t.Errorf("Do = %+v, %v", res, err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	r := rand_.NewMath(1)
+	tests := []struct {
+		jitter   Jitter
+		min, max time.Duration // of the 4th wait
+	}{
+		{JitterNone, 800 * time.Millisecond, 800 * time.Millisecond},
+		{JitterFull, 0, 800 * time.Millisecond},
+		{JitterEqual, 400 * time.Millisecond, 800 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		p := RetryPolicy{Jitter: tt.jitter}
+		for i := 0; i < 100; i++ {
+			if w := p.backoff(4, 0, r); w < tt.min || w > tt.max {
+				t.Fatalf("jitter %d: wait %s not in [%s, %s]", tt.jitter, w, tt.min, tt.max)
+			}
+		}
+	}
+
+	p := RetryPolicy{Jitter: JitterDecorrelated, MaxInterval: time.Second}
+	var wait time.Duration
+	for i := 1; i < 100; i++ {
+		next := p.backoff(i, wait, r)
+		if next < DefaultRetryInitialInterval || next > time.Second || (wait > 0 && next > 3*wait) {
+			t.Fatalf("decorrelated wait %s after %s", next, wait)
+		}
+		wait = next
+	}
+	if w := (&RetryPolicy{MaxInterval: time.Second}).backoff(100, 0, r); w != time.Second {
+		t.Errorf("capped wait %s", w)
+	}
+}
@@ -0,0 +1,58 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	tests := []struct {
+		name      string
+		maxWait   time.Duration
+		slow      time.Duration
+		wantWaits []string
+	}{
+		{"zero maxWait retries at once", 0, 0, []string{"0s", "0s", "0s"}},
+		{"doubling capped by maxWait", 110 * time.Millisecond, 0, []string{"100ms", "110ms", "110ms"}},
+		// f and the wait take more than 2*maxWait
+		{"slow task keeps the step", 110 * time.Millisecond, 200 * time.Millisecond, []string{"100ms", "100ms", "100ms"}},
+	}
+	for _, tt := range tests {
+		logger, hook := test.NewNullLogger()
+		attempts := 0
+		err := Retry(context.Background(), logger, tt.maxWait, 0, func() error {
+			attempts++
+			time.Sleep(tt.slow)
+			if attempts <= len(tt.wantWaits) {
+				return errFlaky
+			}
+			return nil
+		})
+		if err != nil || attempts != len(tt.wantWaits)+1 {
+			t.Errorf("%s: Retry = %v after %d attempts", tt.name, err, attempts)
+			continue
+		}
+		if n := len(hook.AllEntries()); n != len(tt.wantWaits) {
+			t.Errorf("%s: logged %d retries, want %d", tt.name, n, len(tt.wantWaits))
+			continue
+		}
+		for i, entry := range hook.AllEntries() {
+			if want := "retrying in " + tt.wantWaits[i] + " seconds..."; entry.Message != want {
+				t.Errorf("%s: #%d: logged %q, want %q", tt.name, i, entry.Message, want)
+			}
+		}
+	}
+
+	start := time.Now()
+	if err := Retry(context.Background(), nil, time.Hour, 50*time.Millisecond, func() error { return errFlaky }); err != errFlaky {
+		t.Errorf("Retry after failAfter = %v, want %v", err, errFlaky)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry returned after %v, failAfter is 50ms", elapsed)
+	}
+}